@@ -0,0 +1,43 @@
+package main
+
+import (
+	"autonfs/internal/agent"
+	"autonfs/internal/deployer"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// AgentOptions defines flags for the agent command
+type AgentOptions struct {
+	ConfigPath string
+}
+
+// RunAgent runs the client agent until ctx is done or the process is told to stop
+func RunAgent(ctx context.Context, opts AgentOptions) error {
+	cfg, err := agent.LoadConfig(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	a := agent.New(cfg)
+	a.Wake = agentWake
+	return a.Run(ctx)
+}
+
+// agentWake wakes a host for the agent like `autonfs wake <alias>` does,
+// with the settings of the last apply
+func agentWake(ctx context.Context, req agent.Request) (string, error) {
+	cache, err := deployer.LoadHostCache(req.Host)
+	if err != nil {
+		return "", err
+	}
+	opts, err := hostWakeOptions(cache.Host, cache)
+	if err != nil {
+		return "", err
+	}
+	opts.Mount, opts.Unit = req.Mount, req.Unit
+	return runWake(ctx, opts)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"autonfs/internal/busy"
+	"autonfs/internal/deployer"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// BusyOptions defines flags for the busy command
+type BusyOptions struct {
+	Path    string // Mount point, default every AutoNFS mount
+	Release bool   // Free the mounts after confirmation
+	Lazy    bool   // Release by lazy unmount instead of signalling the processes
+	Signal  string // Signal sent on release
+	Yes     bool   // Do not ask for confirmation
+}
+
+// RunBusy lists the processes keeping AutoNFS mounts busy and optionally
+// releases the mounts
+func RunBusy(opts BusyOptions) error {
+	mounts, err := mountPoints(opts.Path)
+	if err != nil {
+		return err
+	}
+	sig, err := busy.ParseSignal(opts.Signal)
+	if err != nil {
+		return err
+	}
+	holders, err := busy.Scanner{}.Scan(mounts)
+	if err != nil {
+		return err
+	}
+	if len(holders) == 0 {
+		fmt.Printf("No process is using %s\n", strings.Join(mounts, ", "))
+		return nil
+	}
+	printHolders(os.Stdout, holders)
+	if !opts.Release {
+		return nil
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	r := busy.NewReleaser()
+	if opts.Lazy {
+		mounts := busy.Mounts(holders)
+		if !opts.Yes && !confirm(stdin, fmt.Sprintf("Lazily unmount %s? The processes keep their open files until they exit", strings.Join(mounts, ", "))) {
+			return nil
+		}
+		return r.Lazy(mounts)
+	}
+	pids := busy.PIDs(holders)
+	if !opts.Yes && !confirm(stdin, fmt.Sprintf("Send SIG%s to %d process(es)?", strings.TrimPrefix(strings.ToUpper(opts.Signal), "SIG"), len(pids))) {
+		return nil
+	}
+	return r.Signal(holders, sig)
+}
+
+// mountPoints returns the mount points to act on: the given paths, or the
+// mounts of every applied host
+func mountPoints(paths ...string) ([]string, error) {
+	var mounts []string
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, abs)
+	}
+	if len(mounts) > 0 {
+		return mounts, nil
+	}
+	caches, err := deployer.LoadHostCaches()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range caches {
+		for _, m := range c.Host.Mounts {
+			mounts = append(mounts, m.Local)
+		}
+	}
+	if len(mounts) == 0 {
+		return nil, fmt.Errorf("no AutoNFS mounts known, run `autonfs apply` first or give a path")
+	}
+	return mounts, nil
+}
+
+func printHolders(w io.Writer, holders []busy.Holder) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MOUNT\tPID\tUSER\tCOMMAND\tUSING")
+	for _, h := range holders {
+		command := h.Command
+		if len(command) > 40 {
+			command = command[:37] + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", h.Mount, h.PID, h.User, command, strings.Join(h.Uses, ", "))
+	}
+	tw.Flush()
+}
+
+// confirm asks a yes/no question, anything but y/yes is no
+func confirm(r *bufio.Reader, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := r.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
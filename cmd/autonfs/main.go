@@ -1,11 +1,17 @@
 package main
 
 import (
+	"autonfs/internal/agent"
 	"autonfs/internal/deployer"
 	"autonfs/internal/discover"
+	"autonfs/internal/journal"
+	"autonfs/internal/wakestate"
 	"autonfs/internal/watcher"
+	"autonfs/pkg/nfsrpc"
 	"autonfs/pkg/sshutil"
 	"autonfs/pkg/wol"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -19,22 +25,34 @@ var (
 	Commit  = "none"
 )
 
+// logLevel is shared by all handlers so the log format can be switched at runtime
+var logLevel = new(slog.LevelVar)
+
+// setLogFormat installs the default logger with the given format (text or json)
+func setLogFormat(format string) {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler = slog.NewTextHandler(os.Stdout, opts)
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
 func main() {
 	var verbose bool
+	var logFormat string
 	var rootCmd = &cobra.Command{
 		Use: "autonfs",
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			level := slog.LevelInfo
+			logLevel.Set(slog.LevelInfo)
 			if verbose {
-				level = slog.LevelDebug
+				logLevel.Set(slog.LevelDebug)
 			}
-			logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-				Level: level,
-			}))
-			slog.SetDefault(logger)
+			setLogFormat(logFormat)
 		},
 	}
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Log format (text, json)")
 
 	// --- Version Command ---
 	var versionCmd = &cobra.Command{
@@ -80,77 +98,182 @@ func main() {
 	}
 
 	// --- Wake Command (Client Side) ---
-	var (
-		wakeMac     string
-		wakeIP      string
-		wakePort    int
-		wakeBcast   string
-		wakeTimeout time.Duration
-	)
+	var wakeOpts WakeOptions
+	var wakeCfgFile string
 	var wakeCmd = &cobra.Command{
-		Use:   "wake",
-		Short: "Send WoL packet and wait for port open",
-		Run: func(cmd *cobra.Command, args []string) {
-			slog.Info("Waking MAC", "mac", wakeMac)
+		Use:   "wake [alias]",
+		Short: "Power the server on (WoL or power backend) and wait until the NFS server is ready",
+		Long: `Power the server on and wait until the NFS server is ready.
 
-			// 1. Send WoL
-			packet, err := wol.NewMagicPacket(wakeMac)
-			if err != nil {
-				slog.Error("Invalid MAC format", "error", err)
-				os.Exit(1)
-			}
-			// Simple broadcast address assumption, refined in Phase 4
-			if err := packet.Send(wakeBcast); err != nil {
-				slog.Warn("WoL send failed", "error", err)
+With an alias, the host is looked up in autonfs.yaml (default: the config of
+the last apply) and woken like its mount units do, with the MAC/IP discovered
+by apply. Exit codes: 0 woken, 3 already up, 4 timed out, 1 other errors.
+Without an alias, everything is given by flags (as in the generated units).`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			if len(args) == 1 {
+				err = RunWakeHost(cmd.Context(), WakeHostOptions{Alias: args[0], ConfigPath: wakeCfgFile, Force: wakeOpts.Force})
 			} else {
-				slog.Info("WoL packet sent")
+				err = RunWake(cmd.Context(), wakeOpts)
 			}
-
-			// 2. Wait for Port
-			slog.Info("Waiting for host to come online", "ip", wakeIP, "port", wakePort, "timeout", wakeTimeout)
-			if err := wol.WaitForPort(wakeIP, wakePort, wakeTimeout); err != nil {
-				slog.Error("Wake timeout or failed", "error", err)
+			switch {
+			case err == nil:
+			case errors.Is(err, errAlreadyUp):
+				os.Exit(exitAlreadyUp)
+			case errors.Is(err, errWakeTimeout):
+				slog.Error("Wake failed", "error", err)
+				os.Exit(exitTimedOut)
+			default:
+				slog.Error("Wake failed", "error", err)
 				os.Exit(1)
 			}
-			slog.Info("Host is online!")
 		},
 	}
-	wakeCmd.Flags().StringVar(&wakeMac, "mac", "", "MAC Address")
-	wakeCmd.Flags().StringVar(&wakeIP, "ip", "", "Target IP")
-	wakeCmd.Flags().StringVar(&wakeBcast, "bcast", "255.255.255.255", "Broadcast IP")
-	wakeCmd.Flags().IntVar(&wakePort, "port", 2049, "Target Port (Default: NFS 2049)")
-	wakeCmd.Flags().DurationVar(&wakeTimeout, "timeout", 120*time.Second, "Timeout for wake up")
-	wakeCmd.MarkFlagRequired("mac")
-	wakeCmd.MarkFlagRequired("ip")
+	wakeCmd.Flags().StringVarP(&wakeCfgFile, "file", "f", "", "Config file for `wake <alias>` (Default: config of the last apply)")
+	wakeCmd.Flags().StringArrayVar(&wakeOpts.MACs, "mac", nil, "MAC Address (repeatable, e.g. for bonded NICs, required for WoL)")
+	wakeCmd.Flags().StringVar(&wakeOpts.IP, "ip", "", "Target IP")
+	wakeCmd.Flags().StringArrayVar(&wakeOpts.Broadcasts, "bcast", nil, "WoL target address (repeatable, Default: 255.255.255.255)")
+	wakeCmd.Flags().StringVar(&wakeOpts.Interface, "interface", "", "Send WoL only on this interface (Default: all)")
+	wakeCmd.Flags().IntSliceVar(&wakeOpts.WolPorts, "wol-port", nil, "WoL UDP port (repeatable, Default: 9 and 7)")
+	wakeCmd.Flags().DurationVar(&wakeOpts.Resend, "resend", wol.DefaultResendInterval, "Resend WoL packets at this interval until ready")
+	wakeCmd.Flags().BoolVar(&wakeOpts.Raw, "raw", false, "Send raw Ethernet (EtherType 0x0842) frames, needs CAP_NET_RAW, falls back to UDP")
+	wakeCmd.Flags().StringVar(&wakeOpts.SecureOnFile, "secureon-file", "", "File holding the SecureOn password (aa:bb:cc:dd:ee:ff, 1.2.3.4 or hex)")
+	wakeCmd.Flags().StringVar(&wakeOpts.SecureOnEnv, "secureon-env", "", "Environment variable holding the SecureOn password")
+	wakeCmd.Flags().IntVar(&wakeOpts.Port, "port", 2049, "Target Port (Default: NFS 2049)")
+	wakeCmd.Flags().DurationVar(&wakeOpts.Timeout, "timeout", 120*time.Second, "Timeout for wake up")
+	wakeCmd.Flags().StringVar(&wakeOpts.Ready, "ready", nfsrpc.ReadyAuto, "Readiness check: tcp, rpc (NFS NULL call), exports (MOUNT export list), auto")
+	wakeCmd.Flags().StringArrayVar(&wakeOpts.Exports, "export", nil, "Export path that must be served before returning (repeatable)")
+	wakeCmd.Flags().DurationVar(&wakeOpts.Settle, "settle", 0, "Extra delay once the server is ready")
+	wakeCmd.Flags().StringVar(&wakeOpts.Relay, "relay", "", "SSH alias of an always-on host on the server's LAN to send WoL from")
+	wakeCmd.Flags().BoolVar(&wakeOpts.SendOnly, "send-only", false, "Only send one round of WoL packets, do not wait (used on relays)")
+	wakeCmd.Flags().StringVar(&wakeOpts.StateDir, "state-dir", wakestate.DefaultDir, "Directory for the per-host wake lock shared by concurrent wakes")
+	wakeCmd.Flags().DurationVar(&wakeOpts.Backoff, "backoff", 0, "Fail immediately for this long after a failed wake of the same host (0 disables)")
+	wakeCmd.Flags().BoolVar(&wakeOpts.Force, "force", false, "Wake even if a recent wake failed or the wake policy does not match")
+	wakeCmd.Flags().StringArrayVar(&wakeOpts.Policy.Subnets, "subnet", nil, "Only wake when the client has an address in this CIDR (repeatable)")
+	wakeCmd.Flags().StringArrayVar(&wakeOpts.Policy.GatewayMACs, "gateway-mac", nil, "Only wake behind this default gateway MAC (repeatable)")
+	wakeCmd.Flags().StringArrayVar(&wakeOpts.Policy.Reachable, "reachable", nil, "Only wake when this host:port accepts TCP connections (repeatable)")
+	wakeCmd.Flags().BoolVar(&wakeOpts.Policy.NoBattery, "no-battery", false, "Do not wake while the client runs on battery")
+	wakeCmd.Flags().StringVar(&wakeOpts.Journal, "journal", journal.DefaultClientFile, "Append the wake outcome to this journal (empty to disable)")
+	wakeCmd.Flags().StringVar(&wakeOpts.Name, "name", "", "Host name for the journal and progress output (Default: --ip)")
+	wakeCmd.Flags().StringVar(&wakeOpts.Mount, "mount", "", "Mount point that triggered the wake, for the journal")
+	wakeCmd.Flags().StringVar(&wakeOpts.Unit, "unit", "", "Mount unit that triggered the wake, for the journal")
+	wakeCmd.Flags().StringVar(&wakeOpts.Agent, "agent", "", "Ask the client agent on this socket to wake (by --name), waking directly when it is down")
+	wakeCmd.Flags().StringVar(&wakeOpts.PowerConfig, "power-config", "", "Power backend config (redfish, ipmi, webhook) installed by apply, WoL when unset")
 
 	// --- Watch Command (Server Side) ---
 	var (
-		watchIdle   time.Duration
-		watchLoad   float64
-		watchDryRun bool
+		watchIdle     time.Duration
+		watchLoad     float64
+		watchDryRun   bool
+		watchShutdown string
+		watchConfig   string
+		watchRecord   string
 	)
 	var watchCmd = &cobra.Command{
 		Use:   "watch",
 		Short: "Monitor NFS connections and system load",
 		Run: func(cmd *cobra.Command, args []string) {
-			m := watcher.NewMonitor(nil)
-			cfg := watcher.WatchConfig{
-				IdleTimeout:   watchIdle,
-				LoadThreshold: watchLoad,
-				// PollInterval: 0, // Use default 10s
-				DryRun: watchDryRun,
+			flags := cmd.Flags()
+			opts := WatchOptions{
+				ConfigPath: watchConfig,
+				RecordDir:  watchRecord,
+				Base: watcher.WatchConfig{
+					IdleTimeout:   watchIdle,
+					LoadThreshold: watchLoad,
+					// PollInterval: 0, // Use default 10s
+					DryRun:      watchDryRun,
+					ShutdownCmd: watchShutdown,
+				},
+				// Flags given explicitly win over the config file
+				Override: func(c *watcher.WatchConfig) {
+					if flags.Changed("timeout") {
+						c.IdleTimeout = watchIdle
+					}
+					if flags.Changed("load") {
+						c.LoadThreshold = watchLoad
+					}
+					if flags.Changed("dry-run") {
+						c.DryRun = watchDryRun
+					}
+					if flags.Changed("shutdown-cmd") {
+						c.ShutdownCmd = watchShutdown
+					}
+					if f := cmd.Flag("log-format"); f.Changed {
+						c.Logging.Format = f.Value.String()
+					}
+				},
 			}
 
-			// Blocking call
-			if err := m.Watch(cmd.Context(), cfg); err != nil {
+			if err := RunWatch(cmd.Context(), opts); err != nil {
 				slog.Error("Monitor terminated abnormally", "error", err)
 				os.Exit(1)
 			}
 		},
 	}
+	watchCmd.Flags().StringVarP(&watchConfig, "config", "c", "", "Watcher config file (YAML, reloaded on SIGHUP)")
 	watchCmd.Flags().DurationVar(&watchIdle, "timeout", 30*time.Minute, "Idle shutdown timeout")
 	watchCmd.Flags().Float64Var(&watchLoad, "load", 0.5, "Minimum load threshold")
 	watchCmd.Flags().BoolVar(&watchDryRun, "dry-run", false, "Simulation only, do not poweroff")
+	watchCmd.Flags().StringVar(&watchShutdown, "shutdown-cmd", "", "Custom shutdown command (Default: systemctl poweroff)")
+	watchCmd.Flags().StringVar(&watchRecord, "record", "", "Record everything the watcher reads into this directory")
+
+	// --- Simulate Command ---
+	var (
+		simReplay string
+		simIdle   time.Duration
+		simLoad   float64
+		simConfig string
+	)
+	var simulateCmd = &cobra.Command{
+		Use:   "simulate",
+		Short: "Replay a watcher recording and report when shutdowns would happen",
+		Run: func(cmd *cobra.Command, args []string) {
+			flags := cmd.Flags()
+			opts := SimulateOptions{
+				ReplayDir: simReplay,
+				Watch: WatchOptions{
+					ConfigPath: simConfig,
+					Base:       watcher.WatchConfig{IdleTimeout: simIdle, LoadThreshold: simLoad},
+					Override: func(c *watcher.WatchConfig) {
+						if flags.Changed("timeout") {
+							c.IdleTimeout = simIdle
+						}
+						if flags.Changed("load") {
+							c.LoadThreshold = simLoad
+						}
+						if f := cmd.Flag("log-format"); f.Changed {
+							c.Logging.Format = f.Value.String()
+						}
+					},
+				},
+			}
+			if err := RunSimulate(opts); err != nil {
+				slog.Error("Simulation failed", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+	simulateCmd.Flags().StringVar(&simReplay, "replay", "", "Recording directory from 'watch --record' (Required)")
+	simulateCmd.Flags().DurationVar(&simIdle, "timeout", 30*time.Minute, "Idle shutdown timeout to evaluate")
+	simulateCmd.Flags().Float64Var(&simLoad, "load", 0.5, "Load threshold to evaluate")
+	simulateCmd.Flags().StringVarP(&simConfig, "config", "c", "", "Watcher config file to evaluate (flags override)")
+	simulateCmd.MarkFlagRequired("replay")
+
+	// --- Status Command ---
+	var statusOpts StatusOptions
+	var statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show client agent and watcher state",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunStatus(cmd.Context(), statusOpts); err != nil {
+				slog.Error("Status failed", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+	statusCmd.Flags().StringVar(&statusOpts.WatcherStatusFile, "watcher-file", watcher.DefaultStatusFile, "Watcher status file")
+	statusCmd.Flags().StringVar(&statusOpts.AgentSocket, "agent", agent.DefaultSocket, "Client agent socket")
 
 	// --- Deploy Command ---
 	var (
@@ -245,7 +368,135 @@ func main() {
 	applyCmd.Flags().BoolVarP(&applyDryRun, "dry-run", "n", false, "dry-run (no write)")
 	applyCmd.Flags().BoolVar(&applyWatcherDry, "watcher-dry-run", false, "Deploy watcher in dry-run mode")
 
-	rootCmd.AddCommand(versionCmd, debugCmd, wakeCmd, watchCmd, deployCmd, undeployCmd, applyCmd)
+	// --- Stats Command ---
+	var statsOpts StatsOptions
+	var statsCmd = &cobra.Command{
+		Use:   "stats [alias]",
+		Short: "Show uptime, wakes, boot latency and energy saved per day",
+		Long: `Merge the wake journal of this client with the boot/shutdown journal of
+the server (fetched over SSH if it is running) into daily statistics.
+Savings use the energy section of the host in autonfs.yaml.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 1 {
+				statsOpts.Alias = args[0]
+			}
+			if err := RunStats(statsOpts); err != nil {
+				slog.Error("Stats failed", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+	statsCmd.Flags().StringVarP(&statsOpts.ConfigPath, "file", "f", "", "Config file for the energy figures (Default: config of the last apply)")
+	statsCmd.Flags().StringVar(&statsOpts.Journal, "journal", journal.DefaultClientFile, "Client wake journal")
+	statsCmd.Flags().IntVar(&statsOpts.Days, "days", 7, "Number of days to show")
+	statsCmd.Flags().BoolVar(&statsOpts.JSON, "json", false, "Print JSON instead of a table")
+	statsCmd.Flags().BoolVar(&statsOpts.NoRemote, "no-remote", false, "Do not fetch the server journal over SSH")
+
+	// --- Sleep Hook Command ---
+	var sleepOpts SleepHookOptions
+	var sleepHookCmd = &cobra.Command{
+		Use:    "sleep-hook pre|post",
+		Short:  "Unmount before suspend / re-arm automounts on resume (run by autonfs-sleep.service)",
+		Args:   cobra.ExactArgs(1),
+		Hidden: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			sleepOpts.Phase = args[0]
+			if err := RunSleepHook(sleepOpts); err != nil {
+				slog.Error("Sleep hook failed", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+	sleepHookCmd.Flags().StringArrayVar(&sleepOpts.Lazy, "lazy", nil, "Mount point, lazily unmounted when busy (repeatable)")
+	sleepHookCmd.Flags().StringArrayVar(&sleepOpts.Skip, "skip", nil, "Mount point, left mounted when busy (repeatable)")
+	sleepHookCmd.Flags().StringArrayVar(&sleepOpts.Block, "block", nil, "Mount point, cancels the suspend when busy (repeatable)")
+	sleepHookCmd.Flags().StringVar(&sleepOpts.Agent, "agent", "", "Run the hook in the client agent on this socket, directly when it is down")
+
+	// --- Busy Command ---
+	var busyOpts BusyOptions
+	var busyCmd = &cobra.Command{
+		Use:   "busy [path]",
+		Short: "List processes keeping AutoNFS mounts busy, optionally release them",
+		Long: `List the processes whose working directory, root, open files or memory
+mappings are inside an AutoNFS mount. They keep the mount busy, so the
+automount never expires and the server never shuts down.
+
+With --release the processes are signalled (or, with --lazy, the mount is
+lazily unmounted) after confirmation.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 1 {
+				busyOpts.Path = args[0]
+			}
+			if err := RunBusy(busyOpts); err != nil {
+				slog.Error("Busy failed", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+	busyCmd.Flags().BoolVar(&busyOpts.Release, "release", false, "Release the mounts: signal the processes using them")
+	busyCmd.Flags().BoolVar(&busyOpts.Lazy, "lazy", false, "With --release: lazily unmount instead of signalling (needs root)")
+	busyCmd.Flags().StringVar(&busyOpts.Signal, "signal", "TERM", "With --release: signal to send (TERM, KILL, HUP, INT)")
+	busyCmd.Flags().BoolVarP(&busyOpts.Yes, "yes", "y", false, "With --release: do not ask for confirmation")
+
+	// --- Stale Command ---
+	var staleOpts StaleOptions
+	var staleCmd = &cobra.Command{
+		Use:   "stale [path...]",
+		Short: "Find (and recover) AutoNFS mounts whose server went away",
+		Long: `Check mounted AutoNFS mounts for an unreachable server or stale file
+handles. Such hard mounts freeze ls, df and file managers. With --recover
+they are unmounted (forced, else lazily) and their automount restarted, so
+the next access wakes the server cleanly. apply installs a timer running
+this for hosts with stale_check set.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			staleOpts.Paths = args
+			if err := RunStale(staleOpts); err != nil {
+				slog.Error("Stale check failed", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+	staleCmd.Flags().BoolVar(&staleOpts.Recover, "recover", false, "Unmount stale mounts and restart their automounts (needs root)")
+
+	// --- Run Command ---
+	var runCmd = newRunCmd(func(ctx context.Context, opts RunOptions) {
+		code, err := RunRun(ctx, opts)
+		if err != nil {
+			slog.Error("Run failed", "error", err)
+		}
+		os.Exit(code)
+	})
+
+	// --- Agent Command ---
+	var agentOpts AgentOptions
+	var agentCmd = &cobra.Command{
+		Use:   "agent",
+		Short: "Client daemon running wakes, the sleep hook and idle unmounts (run by systemd)",
+		Long: `Serve the client side of AutoNFS on a root-only Unix socket:
+
+  - Wakes asked for by the mount units, one per host at a time, the
+    others joining it. Mount units wake directly when the agent is down.
+  - The sleep hook, refusing wakes between suspend and resume.
+  - Status and wake history for autonfs status.
+  - Idle unmounts: mounts without NFS traffic in /proc/self/mountstats for
+    their mount_idle_timeout are unmounted, even when a process holds them
+    open (which keeps systemd's own idle timeout from firing). Busy mounts
+    are released like autonfs busy --release does: lazily (default), by
+    signalling the holders, or skipped.
+
+apply installs the agent for hosts with client_agent or mount_idle_timeout set.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunAgent(cmd.Context(), agentOpts); err != nil {
+				slog.Error("Agent terminated abnormally", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+	agentCmd.Flags().StringVarP(&agentOpts.ConfigPath, "config", "c", agent.DefaultConfigFile, "Agent config file (YAML)")
+
+	rootCmd.AddCommand(versionCmd, debugCmd, wakeCmd, watchCmd, simulateCmd, statusCmd, statsCmd, busyCmd, staleCmd, runCmd, agentCmd, sleepHookCmd, deployCmd, undeployCmd, applyCmd)
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
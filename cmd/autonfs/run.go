@@ -0,0 +1,289 @@
+package main
+
+import (
+	"autonfs/internal/agent"
+	"autonfs/internal/deployer"
+	"autonfs/internal/mountinfo"
+	"autonfs/internal/watcher"
+	"autonfs/pkg/sshutil"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// RunOptions defines flags for the run command
+type RunOptions struct {
+	Alias   string
+	Command []string
+	Mounts  []string      // Mount points to bring up, default all of the host's
+	Hold    time.Duration // Lease length, renewed while the command runs
+}
+
+// Exit codes of `autonfs run` itself, any other code is the command's
+const (
+	exitRunFailed   = 125 // Wake, hold or mount failed, the command did not run
+	exitRunNotFound = 127 // The command could not be started
+)
+
+// renewWait is how long a finished command waits for a running renewal
+// before leaving the hold to expire on its own
+const renewWait = 10 * time.Second
+
+// RunRun wakes a host, holds it awake with its mounts up while the command
+// runs and lets it sleep again afterwards. It returns the command's exit code.
+func RunRun(ctx context.Context, opts RunOptions) (int, error) {
+	if opts.Hold < time.Minute {
+		return exitRunFailed, fmt.Errorf("--hold must be at least 1m")
+	}
+	cache, err := deployer.LoadHostCache(opts.Alias)
+	if err != nil {
+		return exitRunFailed, err
+	}
+	mounts, err := runMounts(cache, opts.Mounts)
+	if err != nil {
+		return exitRunFailed, err
+	}
+	wakeOpts, err := hostWakeOptions(cache.Host, cache)
+	if err != nil {
+		return exitRunFailed, err
+	}
+	if deployer.AgentHost(cache.Host) {
+		wakeOpts.Agent = agent.DefaultSocket
+	}
+	if _, err := runWake(ctx, wakeOpts); err != nil {
+		return exitRunFailed, err
+	}
+
+	// Hold first: the server must not go down between the wake and the mounts
+	lease, err := newLease(opts.Alias, strings.Join(opts.Command, " "), opts.Hold)
+	if err != nil {
+		return exitRunFailed, err
+	}
+	defer lease.release()
+	for _, m := range mounts {
+		if err := ensureMounted(m); err != nil {
+			return exitRunFailed, err
+		}
+	}
+
+	cmd := exec.Command(opts.Command[0], opts.Command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return exitRunNotFound, err
+	}
+	// Stop requests go to the command, the hold is released once it exits
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	// Renewals run in the background: a hanging SSH connection must not
+	// keep signals from the command or its exit from being noticed
+	renew := time.NewTicker(opts.Hold / 3)
+	defer renew.Stop()
+	renewed := make(chan error, 1)
+	renewing := false
+	for {
+		select {
+		case sig := <-sigs:
+			cmd.Process.Signal(sig)
+		case <-renew.C:
+			if renewing {
+				continue
+			}
+			renewing = true
+			go func() { renewed <- lease.renew() }()
+		case err := <-renewed:
+			renewing = false
+			if err != nil {
+				slog.Warn("Renewing hold failed, retrying", "host", opts.Alias, "error", err)
+			}
+		case err := <-done:
+			if renewing {
+				select {
+				case <-renewed:
+				case <-time.After(renewWait):
+				}
+			}
+			return exitCode(cmd, err), nil
+		}
+	}
+}
+
+// newRunCmd builds the run command, handing the parsed options to run
+func newRunCmd(run func(ctx context.Context, opts RunOptions)) *cobra.Command {
+	var opts RunOptions
+	cmd := &cobra.Command{
+		Use:   "run <alias> [--] <command> [args...]",
+		Short: "Wake a host and hold it awake with its mounts up while a command runs",
+		Long: `Wake the host as its mount units would, write a hold file on the server
+(a lease renewed while the command runs) so its watcher keeps it up, bring
+up its mounts and run the command. Once the command exits the hold is
+released and the server may sleep again. A hold left behind by a crash
+expires after --hold.
+
+Exits with the command's exit code, 125 if the host could not be woken,
+held or mounted. apply generates systemd timers running the jobs of a
+host this way.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 || len(runCommand(args)) == 0 {
+				return fmt.Errorf("requires an alias and a command")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.Alias, opts.Command = args[0], runCommand(args)
+			run(cmd.Context(), opts)
+		},
+	}
+	// Everything after the alias belongs to the command
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().StringArrayVar(&opts.Mounts, "mount", nil, "Mount point to bring up (repeatable, default all of the host's)")
+	cmd.Flags().DurationVar(&opts.Hold, "hold", 10*time.Minute, "Hold lease, renewed while the command runs")
+	return cmd
+}
+
+// runCommand returns the command after the alias. Without interspersed
+// flags cobra keeps the -- separator in args.
+func runCommand(args []string) []string {
+	if len(args) < 2 {
+		return nil
+	}
+	if args[1] == "--" {
+		return args[2:]
+	}
+	return args[1:]
+}
+
+// runMounts returns the mount points to bring up, checked against the host's mounts
+func runMounts(cache *deployer.HostCache, want []string) ([]string, error) {
+	var all []string
+	for _, m := range cache.Host.Mounts {
+		all = append(all, path.Clean(m.Local))
+	}
+	if len(want) == 0 {
+		return all, nil
+	}
+	var mounts []string
+	for _, w := range want {
+		if !slices.Contains(all, path.Clean(w)) {
+			return nil, fmt.Errorf("%s is not a mount of %s (%s)", w, cache.Alias, strings.Join(all, ", "))
+		}
+		mounts = append(mounts, path.Clean(w))
+	}
+	return mounts, nil
+}
+
+// ensureMounted triggers the automount of a mount point by reading it, as
+// any access would, and checks the NFS mount is there
+func ensureMounted(mount string) error {
+	if _, err := os.ReadDir(mount); err != nil {
+		return fmt.Errorf("mount %s unavailable: %v", mount, err)
+	}
+	nfs, err := mountinfo.NFSMounts(mountinfo.DefaultFile)
+	if err != nil {
+		return err
+	}
+	if _, ok := nfs[mount]; !ok {
+		return fmt.Errorf("%s is not mounted (is its automount enabled?)", mount)
+	}
+	slog.Info("Mount ready", "mount", mount)
+	return nil
+}
+
+// exitCode maps the command's end to an exit code, 128+n for signal n as a shell does
+func exitCode(cmd *exec.Cmd, err error) int {
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		slog.Error("Waiting for command failed", "error", err)
+		return exitRunFailed
+	}
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return cmd.ProcessState.ExitCode()
+}
+
+// lease is a hold file on the server, keeping its watcher from shutting it
+// down. It expires on its own should this process die without releasing it.
+type lease struct {
+	mu     sync.Mutex // Held by renew, which may replace client
+	client *sshutil.Client
+	alias  string
+	file   string
+	owner  string
+	ttl    time.Duration
+}
+
+// newLease writes the hold file over SSH. Root on the server is needed
+// (sudo -n), as for apply.
+func newLease(alias, command string, ttl time.Duration) (*lease, error) {
+	client, err := sshutil.NewClient(alias)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	l := &lease{
+		client: client,
+		alias:  alias,
+		file:   path.Join(watcher.DefaultHoldDir, fmt.Sprintf("run-%s-%d", hostname, os.Getpid())),
+		owner:  fmt.Sprintf("%s: %s", hostname, command),
+		ttl:    ttl,
+	}
+	if err := l.renew(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("holding %s awake: %v", alias, err)
+	}
+	slog.Info("Holding host awake", "host", alias, "file", l.file, "lease", ttl)
+	return l, nil
+}
+
+// renew rewrites the hold file with a new expiry, reconnecting once when
+// the connection dropped during a long command
+func (l *lease) renew() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	content := []byte(watcher.FormatHold(time.Now().Add(l.ttl), l.owner))
+	cmd := fmt.Sprintf("sudo -n sh -c 'mkdir -p %s && cat > %s'", watcher.DefaultHoldDir, l.file)
+	_, err := l.client.RunCommandInput(cmd, content)
+	if err == nil {
+		return nil
+	}
+	client, dialErr := sshutil.NewClient(l.alias)
+	if dialErr != nil {
+		return err
+	}
+	l.client.Close()
+	l.client = client
+	_, err = l.client.RunCommandInput(cmd, content)
+	return err
+}
+
+// release removes the hold file, the server may sleep again. A renewal
+// still stuck on the connection keeps the hold until it expires.
+func (l *lease) release() {
+	if !l.mu.TryLock() {
+		slog.Warn("Hold still being renewed, it expires on its own", "host", l.alias, "expires_in", l.ttl)
+		return
+	}
+	defer l.mu.Unlock()
+	defer l.client.Close()
+	if _, err := l.client.RunCommand("sudo -n rm -f " + l.file); err != nil {
+		slog.Warn("Releasing hold failed, it expires on its own", "host", l.alias, "expires_in", l.ttl, "error", err)
+		return
+	}
+	slog.Info("Hold released", "host", l.alias)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"autonfs/internal/templates"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runArgs parses args like `autonfs run` does and runs the resulting command
+func runArgs(t *testing.T, args []string) (RunOptions, string) {
+	t.Helper()
+	var got RunOptions
+	var out []byte
+	cmd := newRunCmd(func(ctx context.Context, opts RunOptions) {
+		got = opts
+		var err error
+		if out, err = exec.Command(opts.Command[0], opts.Command[1:]...).Output(); err != nil {
+			t.Errorf("Running %q failed: %v", opts.Command, err)
+		}
+	})
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute(%q) failed: %v", args, err)
+	}
+	return got, string(out)
+}
+
+func TestRunCmd_Args(t *testing.T) {
+	// The documented form, flags of the command left alone
+	opts, out := runArgs(t, []string{"--hold", "20m", "my-nas", "--", "sh", "-c", "echo $0", "--hold"})
+	if opts.Alias != "my-nas" || opts.Hold != 20*time.Minute || out != "--hold\n" {
+		t.Errorf("Unexpected options %+v, output %q", opts, out)
+	}
+	if _, out := runArgs(t, []string{"my-nas", "echo", "hi"}); out != "hi\n" {
+		t.Errorf("Without -- got output %q", out)
+	}
+
+	cmd := newRunCmd(func(ctx context.Context, opts RunOptions) { t.Error("Ran without a command") })
+	cmd.SetArgs([]string{"my-nas", "--"})
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+	if err := cmd.Execute(); err == nil {
+		t.Error("Expected an error without a command")
+	}
+}
+
+func TestRunCmd_JobUnit(t *testing.T) {
+	unit, err := templates.Render("job", templates.ClientJobServiceTmpl, templates.Config{
+		BinaryPath: "/usr/local/bin/autonfs",
+		Alias:      "nas",
+		JobHold:    "30m",
+		JobCommand: `"echo \"job ran\""`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var execStart string
+	for _, line := range strings.Split(string(unit), "\n") {
+		if v, ok := strings.CutPrefix(line, "ExecStart="); ok {
+			execStart = v
+		}
+	}
+	args := splitUnitArgs(execStart)
+	if len(args) < 2 || args[1] != "run" {
+		t.Fatalf("Unexpected ExecStart %q", execStart)
+	}
+	opts, out := runArgs(t, args[2:])
+	if opts.Alias != "nas" || opts.Hold != 30*time.Minute || out != "job ran\n" {
+		t.Errorf("Unexpected options %+v, output %q", opts, out)
+	}
+}
+
+// splitUnitArgs splits a command line as systemd does for the quoting the
+// deployer produces: double quotes with \" and \\ escapes
+func splitUnitArgs(s string) []string {
+	var args []string
+	var cur strings.Builder
+	inArg, quoted := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+		case c == '"':
+			quoted, inArg = !quoted, true
+		case c == ' ' && !quoted:
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
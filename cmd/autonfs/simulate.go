@@ -0,0 +1,66 @@
+package main
+
+import (
+	"autonfs/internal/watcher"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// SimulateOptions defines flags for the simulate command
+type SimulateOptions struct {
+	ReplayDir string
+	Watch     WatchOptions // Config to evaluate, same precedence as watch
+}
+
+// RunSimulate replays a recording and prints the would-be shutdowns
+func RunSimulate(opts SimulateOptions) error {
+	rec, err := watcher.LoadRecording(opts.ReplayDir)
+	if err != nil {
+		return err
+	}
+	if rec.Hostname == "" {
+		rec.Hostname = opts.ReplayDir
+	}
+	cfg, err := loadWatchConfig(opts.Watch)
+	if err != nil {
+		return err
+	}
+
+	// Watcher decisions are logged at debug level only, the report is the output
+	if logLevel.Level() > slog.LevelDebug {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+	res := watcher.Simulate(rec, cfg)
+	printSimulation(os.Stdout, rec, cfg, res)
+	return nil
+}
+
+func printSimulation(w io.Writer, rec *watcher.Recording, cfg watcher.WatchConfig, res watcher.SimulationResult) {
+	span := res.End.Sub(res.Start)
+	fmt.Fprintln(w, "------------------------------------------------")
+	fmt.Fprintf(w, "Recording   : %s (%d polls)\n", rec.Hostname, res.Polls)
+	fmt.Fprintf(w, "Period      : %s -> %s (%s)\n", res.Start.Format(time.DateTime), res.End.Format(time.DateTime), span.Truncate(time.Second))
+	fmt.Fprintf(w, "Settings    : idle_timeout=%s load_threshold=%.2f\n", cfg.IdleTimeout, cfg.LoadThreshold)
+	if res.Polls > 0 {
+		fmt.Fprintf(w, "Active      : %.1f%% of polls\n", float64(res.ActivePolls)*100/float64(res.Polls))
+	}
+	fmt.Fprintf(w, "Shutdowns   : %d\n", len(res.Shutdowns))
+	fmt.Fprintln(w, "------------------------------------------------")
+
+	var offTotal time.Duration
+	for i, s := range res.Shutdowns {
+		off := s.OffFor(res.End)
+		offTotal += off
+		woke := "(still off at end of recording)"
+		if !s.WokeAt.IsZero() {
+			woke = fmt.Sprintf("woken %s by %s", s.WokeAt.Format(time.DateTime), s.Reason)
+		}
+		fmt.Fprintf(w, "#%-3d shutdown %s  off %-10s %s\n", i+1, s.At.Format(time.DateTime), off.Truncate(time.Second), woke)
+	}
+	if span > 0 {
+		fmt.Fprintf(w, "Total off time: %s (%.1f%%)\n", offTotal.Truncate(time.Second), float64(offTotal)*100/float64(span))
+	}
+}
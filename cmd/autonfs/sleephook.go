@@ -0,0 +1,55 @@
+package main
+
+import (
+	"autonfs/internal/agent"
+	"autonfs/internal/deployer"
+	"autonfs/internal/sleephook"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// SleepHookOptions defines flags for the sleep-hook command
+type SleepHookOptions struct {
+	Phase string   // pre (before sleep) or post (after resume)
+	Lazy  []string // Mount points lazily unmounted when busy
+	Skip  []string // Mount points left mounted when busy
+	Block []string // Mount points cancelling the suspend when busy
+	Agent string   // Client agent socket, tried first; the hook runs here when the agent is down
+}
+
+// RunSleepHook runs one phase of the sleep hook installed by apply
+func RunSleepHook(opts SleepHookOptions) error {
+	var mounts []sleephook.Mount
+	add := func(paths []string, policy string) {
+		for _, p := range paths {
+			mounts = append(mounts, sleephook.Mount{Path: p, Unit: deployer.MountUnitName(p), Policy: policy})
+		}
+	}
+	add(opts.Lazy, sleephook.BusyLazy)
+	add(opts.Skip, sleephook.BusySkip)
+	add(opts.Block, sleephook.BusyBlock)
+
+	op := map[string]string{"pre": agent.OpSleep, "post": agent.OpResume}[opts.Phase]
+	if op == "" {
+		return fmt.Errorf("unknown phase %q (pre, post)", opts.Phase)
+	}
+	if opts.Agent != "" {
+		// The agent holds wakes from the pre-sleep hook until resume
+		resp, err := agent.Call(context.Background(), opts.Agent, agent.Request{Op: op, Mounts: mounts})
+		if err == nil {
+			if resp.Error != "" {
+				return errors.New(resp.Error)
+			}
+			return nil
+		}
+		slog.Warn("Agent unavailable, running the hook directly", "error", err)
+	}
+
+	h := sleephook.New()
+	if opts.Phase == "pre" {
+		return h.Pre(mounts)
+	}
+	return h.Post(mounts)
+}
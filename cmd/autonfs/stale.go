@@ -0,0 +1,62 @@
+package main
+
+import (
+	"autonfs/internal/deployer"
+	"autonfs/internal/stale"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// StaleOptions defines flags for the stale command
+type StaleOptions struct {
+	Paths   []string // Mount points, default every AutoNFS mount
+	Recover bool     // Unmount stale mounts and restart their automounts
+}
+
+// RunStale reports AutoNFS mounts whose server went away and optionally
+// recovers them
+func RunStale(opts StaleOptions) error {
+	paths, err := mountPoints(opts.Paths...)
+	if err != nil {
+		return err
+	}
+	var mounts []stale.Mount
+	for _, p := range paths {
+		mounts = append(mounts, stale.Mount{Path: p, Unit: deployer.MountUnitName(p)})
+	}
+
+	c := stale.New()
+	problems, err := c.Check(mounts)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		slog.Debug("No stale mounts", "mounts", paths)
+		if !opts.Recover {
+			fmt.Println("No stale mounts")
+		}
+		return nil
+	}
+
+	var failed []string
+	for _, p := range problems {
+		fmt.Printf("%s: %s (server %s)\n", p.Path, p.Reason, p.Server)
+		if !opts.Recover {
+			continue
+		}
+		if err := c.Recover(p); err != nil {
+			slog.Error("Recovery failed", "mount", p.Path, "error", err)
+			failed = append(failed, p.Path)
+			continue
+		}
+		slog.Info("Stale mount dropped, automount re-armed", "mount", p.Path)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not recover %s", strings.Join(failed, ", "))
+	}
+	if !opts.Recover {
+		fmt.Println("Run with --recover (as root) to unmount them and re-arm the automounts")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"autonfs/internal/config"
+	"autonfs/internal/deployer"
+	"autonfs/internal/journal"
+	"autonfs/pkg/sshutil"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// StatsOptions defines flags for the stats command
+type StatsOptions struct {
+	Alias      string // Empty for every host in the journal
+	ConfigPath string // autonfs.yaml for the energy figures, default the config of the last apply
+	Journal    string // Client wake journal
+	Days       int
+	JSON       bool
+	NoRemote   bool // Do not fetch the server journals over SSH
+}
+
+// RunStats merges the client wake journal with the server boot/shutdown
+// journals into daily statistics
+func RunStats(opts StatsOptions) error {
+	client, err := journal.ReadFile(opts.Journal)
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %v", err)
+	}
+
+	hosts := []string{opts.Alias}
+	if opts.Alias == "" {
+		hosts = journalHosts(client)
+		if len(hosts) == 0 {
+			return fmt.Errorf("no wakes recorded in %s yet", opts.Journal)
+		}
+	}
+
+	var cfg *config.Config
+	if opts.ConfigPath != "" {
+		data, err := os.ReadFile(opts.ConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %v", err)
+		}
+		if cfg, err = config.ParseConfig(data); err != nil {
+			return fmt.Errorf("invalid config: %v", err)
+		}
+	}
+
+	now := time.Now()
+	var all []journal.Stats
+	for _, host := range hosts {
+		var server []journal.Entry
+		if !opts.NoRemote {
+			if server, err = fetchServerJournal(host); err != nil {
+				slog.Warn("Server journal unavailable, uptime unknown", "host", host, "error", err)
+			}
+		}
+		all = append(all, journal.Compute(host, client, server, hostEnergy(host, cfg), opts.Days, now))
+	}
+
+	if opts.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(all)
+	}
+	for i, st := range all {
+		if i > 0 {
+			fmt.Println()
+		}
+		printStats(os.Stdout, st)
+	}
+	return nil
+}
+
+// journalHosts lists the hosts with wakes on record
+func journalHosts(entries []journal.Entry) []string {
+	seen := map[string]bool{}
+	var hosts []string
+	for _, e := range entries {
+		if e.Event == journal.EventWake && e.Host != "" && !seen[e.Host] {
+			seen[e.Host] = true
+			hosts = append(hosts, e.Host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// hostEnergy takes the power draw from the given config, or from the config
+// of the last apply
+func hostEnergy(alias string, cfg *config.Config) journal.Energy {
+	if cfg != nil {
+		for _, h := range cfg.Hosts {
+			if h.Alias == alias {
+				return h.Energy
+			}
+		}
+		return journal.Energy{}
+	}
+	if cache, err := deployer.LoadHostCache(alias); err == nil {
+		return cache.Host.Energy
+	}
+	return journal.Energy{}
+}
+
+// fetchServerJournal reads the watcher journal of a host over SSH. A quick
+// port check comes first: a sleeping server would hold the SSH dial for its
+// whole timeout, and stats must never wake it.
+func fetchServerJournal(alias string) ([]journal.Entry, error) {
+	client, err := sshutil.NewClient(alias)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(client.Host, client.Port), 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("server is down: %v", err)
+	}
+	conn.Close()
+	defer client.Close()
+
+	out, err := client.RunCommand(fmt.Sprintf("cat %s 2>/dev/null || true", journal.DefaultServerFile))
+	if err != nil {
+		return nil, err
+	}
+	return journal.Read(strings.NewReader(out))
+}
+
+func printStats(w io.Writer, st journal.Stats) {
+	fmt.Fprintf(w, "Host: %s\n", st.Host)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "DATE\tUP\tDOWN\tWAKES\tFAILED\tAVG BOOT\tSAVED kWh\t")
+	for _, d := range append(st.Days, st.Total) {
+		up, down, saved := "-", "-", "-"
+		if st.UptimeKnown {
+			up, down = formatHours(d.Up), formatHours(d.Down)
+			saved = fmt.Sprintf("%.2f", d.SavedKWh)
+		}
+		boot := "-"
+		if d.Wakes > 0 {
+			boot = d.AvgBoot.Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t\n", d.Date, up, down, d.Wakes, d.FailedWakes, boot, saved)
+	}
+	tw.Flush()
+	if st.Boot.Suggested > 0 {
+		fmt.Fprintf(w, "Boot time: p95 %s, max %s over %d wakes; suggested wake_timeout: %s\n",
+			st.Boot.P95.Round(time.Second), st.Boot.Max.Round(time.Second), st.Boot.Samples, st.Boot.Suggested)
+	}
+	if !st.UptimeKnown {
+		fmt.Fprintln(w, "Uptime and savings need the server journal (server down or not reachable over SSH)")
+	}
+}
+
+// formatHours prints a duration as hours with one decimal
+func formatHours(d time.Duration) string {
+	return fmt.Sprintf("%.1fh", d.Hours())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"autonfs/internal/agent"
+	"autonfs/internal/watcher"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// StatusOptions defines flags for the status command
+type StatusOptions struct {
+	WatcherStatusFile string
+	AgentSocket       string
+}
+
+// RunStatus prints the state of the local client agent and watcher, whichever run here
+func RunStatus(ctx context.Context, opts StatusOptions) error {
+	resp, agentErr := agent.Call(ctx, opts.AgentSocket, agent.Request{Op: agent.OpStatus})
+	if agentErr == nil && resp.Status != nil {
+		printAgentStatus(os.Stdout, resp.Status, time.Now())
+	} else {
+		slog.Debug("No agent status", "socket", opts.AgentSocket, "error", agentErr)
+	}
+
+	st, err := watcher.ReadStatus(opts.WatcherStatusFile)
+	if err != nil {
+		if agentErr == nil {
+			return nil
+		}
+		if errors.Is(agentErr, os.ErrPermission) {
+			return fmt.Errorf("no watcher status available and the agent socket is root only: %v", agentErr)
+		}
+		return fmt.Errorf("no watcher status available (is autonfs-watcher or autonfs-agent running here?): %v", err)
+	}
+	printWatcherStatus(os.Stdout, st, time.Now())
+	return nil
+}
+
+func printAgentStatus(w io.Writer, st *agent.Status, now time.Time) {
+	fmt.Fprintln(w, "------------------------------------------------")
+	state := "running"
+	if st.Suspended {
+		state = "suspending (wakes held until resume)"
+	}
+	fmt.Fprintf(w, "Agent       : %s (up %s)\n", state, now.Sub(st.Started).Truncate(time.Second))
+	for _, h := range st.Hosts {
+		wake := "no wake yet"
+		if n := len(h.Wakes); h.Waking {
+			wake = "waking now"
+		} else if n > 0 {
+			last := h.Wakes[n-1]
+			if last.OK() {
+				wake = fmt.Sprintf("woken %s ago (%s, took %s)", now.Sub(last.Finished).Truncate(time.Second), last.Ready, last.Finished.Sub(last.Started).Round(time.Second))
+			} else {
+				wake = fmt.Sprintf("wake failed %s ago: %s", now.Sub(last.Finished).Truncate(time.Second), last.Error)
+			}
+		}
+		fmt.Fprintf(w, "Host        : %s, %s\n", h.Host, wake)
+	}
+	for _, m := range st.Mounts {
+		state := "not mounted"
+		if m.Mounted {
+			state = fmt.Sprintf("mounted, no NFS traffic for %s", m.IdleFor.Truncate(time.Second))
+			if m.IdleTimeout > 0 {
+				state += fmt.Sprintf(" (unmounted at %s)", m.IdleTimeout)
+			}
+		}
+		fmt.Fprintf(w, "Mount       : %s %s\n", m.Path, state)
+	}
+	fmt.Fprintln(w, "------------------------------------------------")
+}
+
+func printWatcherStatus(w io.Writer, st *watcher.Status, now time.Time) {
+	fmt.Fprintln(w, "------------------------------------------------")
+	fmt.Fprintf(w, "Watcher     : %s (updated %s ago)\n", st.State, now.Sub(st.UpdatedAt).Truncate(time.Second))
+	if st.Reason != "" {
+		fmt.Fprintf(w, "Reason      : %s\n", st.Reason)
+	}
+	if st.State == "idle" {
+		fmt.Fprintf(w, "Idle For    : %s\n", st.IdleFor.Truncate(time.Second))
+		fmt.Fprintf(w, "Shutdown In : %s\n", st.ShutdownIn.Round(time.Second))
+	}
+	fmt.Fprintf(w, "Idle Timeout: %s (configured %s)\n", st.IdleTimeout, st.BaseTimeout)
+	if st.TimeoutReason != "" {
+		fmt.Fprintf(w, "Timeout From: %s\n", st.TimeoutReason)
+	}
+	if st.DryRun {
+		fmt.Fprintln(w, "Dry-Run     : yes (no poweroff)")
+	}
+	fmt.Fprintln(w, "------------------------------------------------")
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"autonfs/internal/agent"
+	"autonfs/internal/config"
+	"autonfs/internal/deployer"
+	"autonfs/internal/journal"
+	"autonfs/internal/netpolicy"
+	"autonfs/internal/power"
+	"autonfs/internal/wakestate"
+	"autonfs/pkg/nfsrpc"
+	"autonfs/pkg/sshutil"
+	"autonfs/pkg/wol"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WakeOptions defines flags for the wake command
+type WakeOptions struct {
+	MACs         []string
+	IP           string
+	Port         int
+	Broadcasts   []string      // WoL targets, default 255.255.255.255
+	Interface    string        // Send WoL only on this interface
+	WolPorts     []int         // WoL UDP ports, default 9 and 7
+	Resend       time.Duration // WoL resend interval
+	Raw          bool          // Raw EtherType 0x0842 frames instead of UDP
+	SecureOnFile string        // SecureOn password file, the password never goes on the command line
+	SecureOnEnv  string        // SecureOn password environment variable
+	Timeout      time.Duration
+	Ready        string           // Readiness strategy: tcp, rpc, exports, auto
+	Exports      []string         // Export paths that must be served (exports/auto)
+	Settle       time.Duration    // Extra wait once ready
+	Relay        string           // SSH alias of a host on the server's LAN that sends the packets
+	SendOnly     bool             // Send one round of packets and return, no readiness wait
+	PowerConfig  string           // Power backend config installed by apply, WoL when empty
+	StateDir     string           // Per-host wake lock and result files, shared by all mount units
+	Backoff      time.Duration    // Fail fast for this long after a failed wake
+	Force        bool             // Wake even during the back-off window
+	Policy       netpolicy.Policy // Client location/power conditions for waking
+	Name         string           // Host name for progress output, default IP
+	Interactive  bool             // Print progress, report an already running host (wake <alias>)
+	Journal      string           // Append the outcome here for `autonfs stats`, empty to disable
+	Mount        string           // Mount point that triggered the wake, for the journal
+	Unit         string           // Mount unit that triggered the wake, for the journal
+	Agent        string           // Client agent socket, tried first; direct wake when the agent is down
+}
+
+// Exit codes of `autonfs wake <alias>`
+const (
+	exitAlreadyUp = 3
+	exitTimedOut  = 4
+)
+
+var (
+	errAlreadyUp   = errors.New("host is already up")
+	errWakeTimeout = errors.New("wake timed out")
+)
+
+// progressInterval is how often interactive wakes report they are still waiting
+const progressInterval = 5 * time.Second
+
+// RunWake powers the server on and waits until it is ready
+func RunWake(ctx context.Context, opts WakeOptions) error {
+	_, err := runWake(ctx, opts)
+	return err
+}
+
+// runWake is RunWake, returning the readiness level reached
+func runWake(ctx context.Context, opts WakeOptions) (string, error) {
+	if opts.IP == "" && !opts.SendOnly {
+		return "", fmt.Errorf("--ip is required unless --send-only is given")
+	}
+	if !nfsrpc.ValidStrategy(opts.Ready) {
+		return "", fmt.Errorf("unknown --ready strategy %q (tcp, rpc, exports, auto)", opts.Ready)
+	}
+	if opts.Ready == nfsrpc.ReadyExports && len(opts.Exports) == 0 {
+		return "", fmt.Errorf("--ready exports needs at least one --export")
+	}
+	if opts.Name == "" {
+		opts.Name = opts.IP
+	}
+	if opts.Agent != "" && !opts.SendOnly && !opts.Interactive && !opts.Force {
+		if level, handled, err := wakeViaAgent(ctx, opts); handled {
+			return level, err
+		}
+	}
+	check := nfsrpc.ReadyCheck{
+		Strategy: opts.Ready,
+		Host:     opts.IP,
+		Port:     opts.Port,
+		Exports:  opts.Exports,
+		Settle:   opts.Settle,
+	}
+	if opts.Interactive {
+		if level, ok := quickReady(ctx, check); ok {
+			fmt.Printf("%s is already up (%s)\n", opts.Name, level)
+			recordWake(opts, journal.Entry{OK: true, AlreadyUp: true})
+			return level, errAlreadyUp
+		}
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		return "", err
+	}
+	if !opts.Force {
+		level, err := checkPolicy(ctx, opts, check, netpolicy.SystemEnv())
+		if err != nil {
+			return "", err
+		}
+		if level != "" {
+			slog.Info("Host is already up, wake policy not applied", "ready", level)
+			recordWake(opts, journal.Entry{OK: true, AlreadyUp: true})
+			return level, nil
+		}
+	}
+
+	coord := wakestate.New(opts.StateDir, opts.IP)
+	if !opts.SendOnly && !opts.Force {
+		// An unplugged server would otherwise block every access for the whole timeout
+		if last, ok := coord.RecentFailure(opts.Backoff); ok {
+			retry := last.Finished.Add(opts.Backoff)
+			return "", fmt.Errorf("wake of %s failed at %s (%s), not retrying before %s; use `autonfs wake --force` to override",
+				opts.IP, last.Finished.Format(time.TimeOnly), last.Error, retry.Format(time.TimeOnly))
+		}
+	}
+
+	backend := power.BackendWoL
+	var waker power.Waker
+	if opts.PowerConfig != "" {
+		cfg, err := power.LoadConfig(opts.PowerConfig)
+		if err != nil {
+			return "", err
+		}
+		if !cfg.IsWoL() {
+			if opts.SendOnly {
+				return "", fmt.Errorf("--send-only only applies to the wol backend")
+			}
+			target := power.Target{IP: opts.IP}
+			if len(opts.MACs) > 0 {
+				target.MAC = opts.MACs[0]
+			}
+			if waker, err = power.New(cfg, target); err != nil {
+				return "", err
+			}
+			backend = cfg.Backend
+		}
+	}
+
+	if waker == nil {
+		if len(opts.MACs) == 0 {
+			return "", fmt.Errorf("--mac is required for Wake-on-LAN")
+		}
+		password, err := wol.LoadPassword(opts.SecureOnFile, opts.SecureOnEnv)
+		if err != nil {
+			return "", err
+		}
+
+		wolWaker := &wol.Waker{
+			MACs:      opts.MACs,
+			Password:  password,
+			Targets:   opts.Broadcasts,
+			Ports:     opts.WolPorts,
+			Interface: opts.Interface,
+			Interval:  opts.Resend,
+			Raw:       opts.Raw,
+			OnFallback: func(err error) {
+				slog.Warn("Raw WoL frames unavailable, falling back to UDP", "error", err)
+			},
+		}
+		if opts.Relay != "" {
+			client, err := sshutil.NewClient(opts.Relay)
+			if err != nil {
+				return "", fmt.Errorf("wake relay %s: %v", opts.Relay, err)
+			}
+			defer client.Close()
+			slog.Info("Sending WoL through relay", "relay", opts.Relay)
+			wolWaker.Relay = client
+		}
+
+		if opts.SendOnly {
+			if err := wolWaker.SendOnce(ctx); err != nil {
+				return "", fmt.Errorf("WoL send failed: %v", err)
+			}
+			slog.Info("WoL packets sent", "macs", opts.MACs)
+			return "", nil
+		}
+		waker = wolWaker
+	}
+
+	// Wakes of a running server are not counted as wakes in the stats
+	alreadyUp := opts.Journal != "" && !opts.Interactive && serverUp(opts.IP, opts.Port)
+
+	// Magic packets are resent until the server is ready, a single packet
+	// is easily lost while the switch port is still negotiating
+	slog.Info("Waking host", "backend", backend, "macs", opts.MACs, "ip", opts.IP, "port", opts.Port, "ready", opts.Ready, "timeout", opts.Timeout)
+	start := time.Now()
+	if opts.Interactive {
+		fmt.Printf("Waking %s (%s) via %s, timeout %s\n", opts.Name, opts.IP, backend, opts.Timeout)
+		stop := reportProgress(opts.Name, start)
+		defer stop()
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	wake := func(ctx context.Context) (string, error) {
+		var level string
+		err := waker.Wake(ctx, func(ctx context.Context) error {
+			var err error
+			level, err = check.Wait(ctx)
+			return err
+		})
+		return level, err
+	}
+
+	// Mount units of the same host start together: one wakes, the others wait for its result
+	res, shared, err := coord.Run(ctx, wake)
+	if errors.Is(err, wakestate.ErrNoLock) {
+		slog.Warn("Wake coordination unavailable, waking independently", "error", err)
+		res.Ready, err = wake(ctx)
+	}
+	entry := journal.Entry{Duration: time.Since(start), OK: err == nil, AlreadyUp: alreadyUp, Shared: shared}
+	if err != nil {
+		entry.Error = err.Error()
+		entry.TimedOut = ctx.Err() == context.DeadlineExceeded
+	}
+	recordWake(opts, entry)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("%w after %s: %v%s", errWakeTimeout, opts.Timeout, err, timeoutHint(opts))
+		}
+		return "", fmt.Errorf("wake timeout or failed: %v", err)
+	}
+	if shared {
+		slog.Info("Host woken by a concurrent wake", "started", res.Started.Format(time.TimeOnly))
+	}
+	level := res.Ready
+	slog.Info("Host is online!", "ready", level)
+	if opts.Interactive {
+		fmt.Printf("%s is ready (%s) after %s\n", opts.Name, level, time.Since(start).Round(100*time.Millisecond))
+	}
+	return level, nil
+}
+
+// quickReady reports whether the server already serves, without waiting for a boot
+func quickReady(ctx context.Context, check nfsrpc.ReadyCheck) (string, bool) {
+	check.Settle = 0
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	level, err := check.Wait(ctx)
+	return level, err == nil
+}
+
+// checkPolicy applies the wake policy, which only gates powering the server
+// on: when it refuses but the server already serves, the readiness level is
+// returned so the mount can go ahead.
+func checkPolicy(ctx context.Context, opts WakeOptions, check nfsrpc.ReadyCheck, env netpolicy.Env) (string, error) {
+	err := opts.Policy.Check(env)
+	if err == nil {
+		return "", nil
+	}
+	// Interactive wakes probed already
+	if !opts.Interactive {
+		if level, ok := quickReady(ctx, check); ok {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("not waking %s: %v", opts.IP, err)
+}
+
+// wakeViaAgent hands the wake to the client agent, which runs one wake per
+// host for all mount units. handled is false when the agent is down and
+// the caller must wake the host itself.
+func wakeViaAgent(ctx context.Context, opts WakeOptions) (level string, handled bool, err error) {
+	resp, err := agent.Call(ctx, opts.Agent, agent.Request{Op: agent.OpWake, Host: opts.Name, Mount: opts.Mount, Unit: opts.Unit})
+	if errors.Is(err, agent.ErrUnavailable) {
+		slog.Warn("Agent unavailable, waking directly", "error", err)
+		return "", false, nil
+	}
+	if err != nil {
+		return "", true, err
+	}
+	if resp.Error != "" {
+		return "", true, fmt.Errorf("wake by agent failed: %s", resp.Error)
+	}
+	slog.Info("Host is online!", "ready", resp.Ready, "agent", true, "shared", resp.Shared)
+	return resp.Ready, true, nil
+}
+
+// recordWake appends a wake outcome to the client journal. Failures only
+// cost the statistics, never the mount.
+func recordWake(opts WakeOptions, e journal.Entry) {
+	if opts.Journal == "" {
+		return
+	}
+	e.Time = time.Now()
+	e.Event = journal.EventWake
+	e.Host = opts.Name
+	e.Mount = opts.Mount
+	e.Unit = opts.Unit
+	if err := journal.Append(opts.Journal, e); err != nil {
+		slog.Debug("Write wake journal failed", "file", opts.Journal, "error", err)
+	}
+}
+
+// timeoutHint suggests a longer timeout when past boots of the host took longer
+func timeoutHint(opts WakeOptions) string {
+	if opts.Journal == "" {
+		return ""
+	}
+	entries, err := journal.ReadFile(opts.Journal)
+	if err != nil {
+		return ""
+	}
+	boots := journal.Boots(entries, opts.Name)
+	if boots.Suggested <= opts.Timeout {
+		return ""
+	}
+	return fmt.Sprintf(" (past boots took up to %s, set wake_timeout: %s or auto)", boots.Max.Round(time.Second), boots.Suggested)
+}
+
+// serverUp is a quick TCP probe of the NFS port
+func serverUp(ip string, port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), 300*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// reportProgress prints a line every progressInterval until stopped
+func reportProgress(name string, start time.Time) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				fmt.Printf("  still waiting for %s (%s)\n", name, time.Since(start).Round(time.Second))
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// WakeHostOptions defines flags for `wake <alias>`
+type WakeHostOptions struct {
+	Alias      string
+	ConfigPath string // autonfs.yaml, default the config recorded by the last apply
+	Force      bool
+}
+
+// RunWakeHost wakes a host by alias, with the settings of its mount units:
+// host config from autonfs.yaml and MAC/IP from the last apply's discovery
+func RunWakeHost(ctx context.Context, opts WakeHostOptions) error {
+	cache, err := deployer.LoadHostCache(opts.Alias)
+	if err != nil {
+		return err
+	}
+	host := cache.Host
+	if opts.ConfigPath != "" {
+		data, err := os.ReadFile(opts.ConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %v", err)
+		}
+		cfg, err := config.ParseConfig(data)
+		if err != nil {
+			return fmt.Errorf("invalid config: %v", err)
+		}
+		found := false
+		for _, h := range cfg.Hosts {
+			if h.Alias == opts.Alias {
+				host, found = h, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("host %s not found in %s", opts.Alias, opts.ConfigPath)
+		}
+	}
+
+	wakeOpts, err := hostWakeOptions(host, cache)
+	if err != nil {
+		return err
+	}
+	wakeOpts.Force = opts.Force
+	wakeOpts.Interactive = true
+	return RunWake(ctx, wakeOpts)
+}
+
+// hostWakeOptions mirrors the wake command apply renders into the mount units
+func hostWakeOptions(host config.HostConfig, cache *deployer.HostCache) (WakeOptions, error) {
+	entries, err := journal.ReadFile(journal.DefaultClientFile)
+	if err != nil {
+		slog.Debug("Read wake journal failed", "error", err)
+	}
+	timeout, backoff, err := deployer.WakeTimeouts(host, journal.Boots(entries, host.Alias))
+	if err != nil {
+		return WakeOptions{}, err
+	}
+	opts := WakeOptions{
+		Name:         host.Alias,
+		MACs:         append([]string{cache.MAC}, host.WoL.MACs...),
+		IP:           cache.IP,
+		Port:         2049,
+		Interface:    host.WoL.Interface,
+		WolPorts:     host.WoL.Ports,
+		Raw:          host.WoL.Raw,
+		SecureOnFile: cache.SecureOnFile,
+		Relay:        host.WakeRelay,
+		PowerConfig:  cache.PowerConfig,
+		Timeout:      timeout,
+		Ready:        host.ReadyCheck,
+		StateDir:     wakestate.DefaultDir,
+		Backoff:      backoff,
+		Policy:       host.WakePolicy,
+		Resend:       wol.DefaultResendInterval,
+		Journal:      journal.DefaultClientFile,
+	}
+	if host.WoL.Broadcast != "" {
+		opts.Broadcasts = []string{host.WoL.Broadcast}
+	} else if cache.Broadcast != "" {
+		opts.Broadcasts = []string{cache.Broadcast}
+	}
+	if opts.Ready == "" {
+		opts.Ready = nfsrpc.ReadyAuto
+	}
+	for _, m := range host.Mounts {
+		opts.Exports = append(opts.Exports, m.Remote)
+	}
+	// Durations were validated with the config
+	if host.WoL.Interval != "" {
+		opts.Resend, _ = time.ParseDuration(host.WoL.Interval)
+	}
+	if host.ReadySettle != "" {
+		opts.Settle, _ = time.ParseDuration(host.ReadySettle)
+	}
+	return opts, nil
+}
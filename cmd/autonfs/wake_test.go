@@ -0,0 +1,40 @@
+package main
+
+import (
+	"autonfs/internal/netpolicy"
+	"autonfs/pkg/nfsrpc"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckPolicy_ServerAlreadyUp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	opts := WakeOptions{IP: "127.0.0.1", Policy: netpolicy.Policy{NoBattery: true}}
+	check := nfsrpc.ReadyCheck{Strategy: nfsrpc.ReadyTCP, Host: "127.0.0.1", Port: port, Interval: 50 * time.Millisecond}
+	onBattery := netpolicy.Env{OnBattery: func() (bool, error) { return true, nil }}
+
+	// A running server is mounted even though the policy would not power it on
+	level, err := checkPolicy(context.Background(), opts, check, onBattery)
+	if err != nil || level != nfsrpc.ReadyTCP {
+		t.Fatalf("Expected policy skipped for a running server, got %q %v", level, err)
+	}
+
+	ln.Close()
+	level, err = checkPolicy(context.Background(), opts, check, onBattery)
+	if err == nil || !strings.Contains(err.Error(), "battery") || level != "" {
+		t.Fatalf("Expected policy refusal for a server that is down, got %q %v", level, err)
+	}
+
+	onMains := netpolicy.Env{OnBattery: func() (bool, error) { return false, nil }}
+	if level, err := checkPolicy(context.Background(), opts, check, onMains); err != nil || level != "" {
+		t.Fatalf("Expected wake allowed on mains, got %q %v", level, err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"autonfs/internal/watcher"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchOptions defines flags for the watch command
+type WatchOptions struct {
+	ConfigPath string
+	Base       watcher.WatchConfig        // Flag values, used for keys missing from the file
+	Override   func(*watcher.WatchConfig) // Re-applies flags set explicitly on the command line
+	RecordDir  string                     // Snapshot all watcher inputs here (for simulate --replay)
+}
+
+// loadWatchConfig builds the effective watcher config from file and flags
+func loadWatchConfig(opts WatchOptions) (watcher.WatchConfig, error) {
+	cfg := opts.Base
+	if opts.ConfigPath != "" {
+		var err error
+		cfg, err = watcher.LoadWatchConfig(opts.ConfigPath, opts.Base)
+		if err != nil {
+			return cfg, err
+		}
+	}
+	if opts.Override != nil {
+		opts.Override(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	// The config file may switch the log format (e.g. json for log shippers).
+	// Set on every load, so a reload without it goes back to the default.
+	format := cfg.Logging.Format
+	if format == "" {
+		format = "text"
+	}
+	setLogFormat(format)
+	return cfg, nil
+}
+
+// RunWatch runs the watcher until ctx is done, reloading the config file on SIGHUP
+func RunWatch(ctx context.Context, opts WatchOptions) error {
+	cfg, err := loadWatchConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	var osOp watcher.OSOperator
+	if opts.RecordDir != "" {
+		rec, err := watcher.NewRecorder(opts.RecordDir, nil)
+		if err != nil {
+			return err
+		}
+		defer rec.Close()
+		slog.Info("Recording watcher inputs", "dir", opts.RecordDir)
+		osOp = rec
+	}
+	m := watcher.NewMonitor(osOp)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if opts.ConfigPath == "" {
+					slog.Warn("SIGHUP received but no --config given, ignoring")
+					continue
+				}
+				newCfg, err := loadWatchConfig(opts)
+				if err != nil {
+					// Keep running with the old config
+					slog.Error("Config reload failed, keeping current config", "path", opts.ConfigPath, "error", err)
+					continue
+				}
+				slog.Info("SIGHUP received, reloading config", "path", opts.ConfigPath)
+				m.Reload(newCfg)
+			}
+		}
+	}()
+
+	// Blocking call
+	return m.Watch(ctx, cfg)
+}
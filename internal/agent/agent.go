@@ -0,0 +1,312 @@
+// Package agent is the long-running client side of AutoNFS. It runs the
+// wakes asked for by the mount units (one per host at a time, the others
+// joining it), keeps their history, unmounts mounts without NFS traffic in
+// /proc/self/mountstats for their idle timeout, even when a process holds
+// them open (which keeps systemd's TimeoutIdleSec from ever firing), and
+// runs the sleep hook, holding wakes while the client suspends. Clients
+// talk to it over a Unix socket and do the work themselves when it is down.
+package agent
+
+import (
+	"autonfs/internal/busy"
+	"autonfs/internal/mountinfo"
+	"autonfs/internal/sleephook"
+	"autonfs/internal/wakestate"
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// historySize is the number of wakes kept per host
+const historySize = 10
+
+// DefaultSignalGrace is how long signalled mount holders get to exit
+// before the unmount is tried again
+const DefaultSignalGrace = 5 * time.Second
+
+// WakeFunc wakes a host by alias with its configured settings, returning
+// the readiness level reached
+type WakeFunc func(ctx context.Context, req Request) (string, error)
+
+// Agent serves the client
+type Agent struct {
+	Socket    string // Unix socket, none when empty
+	StatsFile string // /proc/self/mountstats
+	Scanner   busy.Scanner
+	Releaser  busy.Releaser
+	Wake      WakeFunc
+	Hook      *sleephook.Hook
+	// SignalGrace is the wait between signalling holders and unmounting again
+	SignalGrace time.Duration
+
+	cfg     Config
+	started time.Time
+
+	mu        sync.Mutex
+	activity  map[string]*mountActivity // By mount point, only while mounted
+	waking    map[string]*wakeCall      // By host
+	history   map[string][]wakestate.Result
+	suspended bool
+}
+
+// mountActivity is the last change of a mount's operation counter
+type mountActivity struct {
+	ops   uint64
+	since time.Time
+}
+
+// wakeCall is a wake in progress, done is closed once res is set
+type wakeCall struct {
+	done chan struct{}
+	res  wakestate.Result
+}
+
+// New returns an agent acting on the running system. Wake must be set for
+// the agent to run wakes.
+func New(cfg Config) *Agent {
+	cfg = cfg.withDefaults()
+	return &Agent{
+		Socket:      cfg.Socket,
+		StatsFile:   mountinfo.DefaultStatsFile,
+		Releaser:    busy.NewReleaser(),
+		Hook:        sleephook.New(),
+		SignalGrace: DefaultSignalGrace,
+		cfg:         cfg,
+		started:     time.Now(),
+		activity:    map[string]*mountActivity{},
+		waking:      map[string]*wakeCall{},
+		history:     map[string][]wakestate.Result{},
+	}
+}
+
+// Run serves the socket and polls the mounts until ctx is done
+func (a *Agent) Run(ctx context.Context) error {
+	if a.Socket != "" {
+		l, err := listen(a.Socket)
+		if err != nil {
+			return fmt.Errorf("listen on %s: %v", a.Socket, err)
+		}
+		defer l.Close()
+		go a.serve(ctx, l)
+	}
+	slog.Info("Agent started", "socket", a.Socket, "mounts", len(a.cfg.Mounts), "poll", a.cfg.PollInterval)
+	t := time.NewTicker(a.cfg.PollInterval)
+	defer t.Stop()
+	a.checkIdle(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-t.C:
+			a.checkIdle(now)
+		}
+	}
+}
+
+// wake runs the wake of req.Host, or waits for the one already running.
+// The wake itself runs under the agent's ctx: a mount unit giving up does
+// not cancel it for the others.
+func (a *Agent) wake(ctx context.Context, req Request) Response {
+	if a.Wake == nil {
+		return Response{Error: "agent does not run wakes"}
+	}
+	a.mu.Lock()
+	if a.suspended {
+		a.mu.Unlock()
+		return Response{Error: fmt.Sprintf("client is suspending, not waking %s", req.Host)}
+	}
+	call, shared := a.waking[req.Host]
+	if !shared {
+		call = &wakeCall{done: make(chan struct{})}
+		a.waking[req.Host] = call
+	}
+	a.mu.Unlock()
+
+	if !shared {
+		res := wakestate.Result{Host: req.Host, Started: time.Now()}
+		ready, err := a.Wake(ctx, req)
+		res.Finished, res.Ready = time.Now(), ready
+		if err != nil {
+			res.Error = err.Error()
+		}
+		a.mu.Lock()
+		call.res = res
+		delete(a.waking, req.Host)
+		a.history[req.Host] = append(a.history[req.Host], res)
+		if n := len(a.history[req.Host]); n > historySize {
+			a.history[req.Host] = a.history[req.Host][n-historySize:]
+		}
+		a.mu.Unlock()
+		close(call.done)
+	} else {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return Response{Error: ctx.Err().Error()}
+		}
+	}
+	return Response{Ready: call.res.Ready, Error: call.res.Error, Shared: shared}
+}
+
+// sleep runs the pre-sleep hook. Wakes are refused until resume, unless
+// the hook cancels the suspend.
+func (a *Agent) sleep(mounts []sleephook.Mount) error {
+	a.mu.Lock()
+	a.suspended = true
+	a.mu.Unlock()
+	err := a.Hook.Pre(mounts)
+	if err != nil {
+		a.mu.Lock()
+		a.suspended = false
+		a.mu.Unlock()
+	}
+	return err
+}
+
+// resume re-arms the automounts and accepts wakes again
+func (a *Agent) resume(mounts []sleephook.Mount) error {
+	a.mu.Lock()
+	a.suspended = false
+	// Time spent asleep is no idle time
+	clear(a.activity)
+	a.mu.Unlock()
+	return a.Hook.Post(mounts)
+}
+
+// checkIdle reads the counters and unmounts the mounts idle for too long
+func (a *Agent) checkIdle(now time.Time) {
+	counts, err := mountinfo.OpCounts(a.StatsFile)
+	if err != nil {
+		slog.Warn("Reading mount statistics failed", "error", err)
+		return
+	}
+	var idle []MountConfig
+	a.mu.Lock()
+	if a.suspended {
+		a.mu.Unlock()
+		return
+	}
+	for _, m := range a.cfg.Mounts {
+		ops, mounted := counts[m.Path]
+		if !mounted {
+			delete(a.activity, m.Path)
+			continue
+		}
+		act := a.activity[m.Path]
+		if act == nil || ops != act.ops {
+			a.activity[m.Path] = &mountActivity{ops: ops, since: now}
+			continue
+		}
+		if m.IdleTimeout <= 0 || now.Sub(act.since) < m.IdleTimeout {
+			continue
+		}
+		slog.Info("Mount idle, unmounting", "mount", m.Path, "idle", now.Sub(act.since).Round(time.Second))
+		idle = append(idle, m)
+		// A mount left in place is retried after another full timeout
+		act.since = now
+	}
+	a.mu.Unlock()
+
+	for _, m := range idle {
+		a.release(m)
+	}
+}
+
+// release unmounts an idle mount, applying its busy policy when something holds it
+func (a *Agent) release(m MountConfig) {
+	err := a.Releaser.Runner.RunCommand("systemctl", "stop", m.Unit+".mount")
+	if err == nil {
+		return
+	}
+	holders, scanErr := a.Scanner.Scan([]string{m.Path})
+	if scanErr != nil {
+		slog.Warn("Scanning mount holders failed", "mount", m.Path, "error", scanErr)
+	}
+	for _, h := range holders {
+		slog.Info("Mount held", "mount", m.Path, "pid", h.PID, "user", h.User, "command", h.Command, "uses", h.Uses)
+	}
+
+	switch m.Release {
+	case busy.ReleaseSkip:
+		slog.Warn("Idle mount busy, left mounted", "mount", m.Path, "error", err)
+	case busy.ReleaseSignal:
+		if err := a.Releaser.Signal(holders, syscall.SIGTERM); err != nil {
+			slog.Error("Signalling mount holders failed", "mount", m.Path, "error", err)
+		}
+		// Unmount once they are gone, not another idle period later
+		time.Sleep(a.SignalGrace)
+		if err := a.Releaser.Runner.RunCommand("systemctl", "stop", m.Unit+".mount"); err != nil {
+			slog.Warn("Idle mount still busy after signalling its holders", "mount", m.Path, "error", err)
+			return
+		}
+		slog.Info("Idle mount unmounted after signalling its holders", "mount", m.Path, "holders", len(holders))
+	default:
+		if err := a.Releaser.Lazy([]string{m.Path}); err != nil {
+			slog.Error("Lazy unmount failed", "mount", m.Path, "error", err)
+			return
+		}
+		slog.Info("Idle mount busy, lazily unmounted", "mount", m.Path, "holders", len(holders))
+	}
+}
+
+// Status is the agent state reported to `autonfs status`
+type Status struct {
+	Started   time.Time     `json:"started"`
+	Suspended bool          `json:"suspended,omitempty"`
+	Hosts     []HostStatus  `json:"hosts,omitempty"`
+	Mounts    []MountStatus `json:"mounts,omitempty"`
+}
+
+// HostStatus is the wake state of a host
+type HostStatus struct {
+	Host   string             `json:"host"`
+	Waking bool               `json:"waking,omitempty"`
+	Wakes  []wakestate.Result `json:"wakes,omitempty"` // Oldest first
+}
+
+// MountStatus is the idle state of a mount
+type MountStatus struct {
+	Path        string        `json:"path"`
+	Host        string        `json:"host,omitempty"`
+	Mounted     bool          `json:"mounted"`
+	IdleFor     time.Duration `json:"idle_for,omitempty"`     // Since the last NFS operation seen
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"` // 0 when the agent does not unmount it
+}
+
+// Status returns the current state
+func (a *Agent) Status(now time.Time) Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := Status{Started: a.started, Suspended: a.suspended}
+
+	hosts := map[string]bool{}
+	for _, m := range a.cfg.Mounts {
+		if m.Host != "" {
+			hosts[m.Host] = true
+		}
+	}
+	for h := range a.history {
+		hosts[h] = true
+	}
+	for h := range a.waking {
+		hosts[h] = true
+	}
+	for h := range hosts {
+		_, waking := a.waking[h]
+		st.Hosts = append(st.Hosts, HostStatus{Host: h, Waking: waking, Wakes: append([]wakestate.Result(nil), a.history[h]...)})
+	}
+	sort.Slice(st.Hosts, func(i, j int) bool { return st.Hosts[i].Host < st.Hosts[j].Host })
+
+	for _, m := range a.cfg.Mounts {
+		ms := MountStatus{Path: m.Path, Host: m.Host, IdleTimeout: m.IdleTimeout}
+		if act := a.activity[m.Path]; act != nil {
+			ms.Mounted, ms.IdleFor = true, now.Sub(act.since)
+		}
+		st.Mounts = append(st.Mounts, ms)
+	}
+	return st
+}
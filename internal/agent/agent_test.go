@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"autonfs/internal/busy"
+	"autonfs/internal/runner/runnertest"
+	"autonfs/internal/sleephook"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeAgent returns an agent whose mountstats are written by setReads
+func fakeAgent(t *testing.T, cfg Config, fail map[string]bool) (*Agent, *runnertest.Recorder) {
+	rec := &runnertest.Recorder{Fail: fail}
+	a := New(cfg)
+	a.StatsFile = filepath.Join(t.TempDir(), "mountstats")
+	a.Scanner = busy.Scanner{Proc: t.TempDir()}
+	a.Releaser = busy.Releaser{
+		Runner: rec,
+		Kill:   func(pid int, sig syscall.Signal) error { return nil },
+	}
+	return a, rec
+}
+
+// setReads writes mountstats with the given READ counts by mount point,
+// the SEQUENCE keep-alives always changing
+func setReads(t *testing.T, a *Agent, reads map[string]int) {
+	var b strings.Builder
+	for mount, n := range reads {
+		fmt.Fprintf(&b, "device 192.168.1.100:%s mounted on %s with fstype nfs4 statvers=1.1\n", mount, mount)
+		fmt.Fprintf(&b, "\tper-op statistics\n\t        READ: %d %d 0 0 0 0 0 0 0\n", n, n)
+		fmt.Fprintf(&b, "\t    SEQUENCE: %d 0 0 0 0 0 0 0 0\n", time.Now().UnixNano())
+	}
+	if err := os.WriteFile(a.StatsFile, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckIdle(t *testing.T) {
+	cfg := Config{Mounts: []MountConfig{
+		{Path: "/mnt/data", Unit: "mnt-data", IdleTimeout: 10 * time.Minute},
+		{Path: "/mnt/media", Unit: "mnt-media", IdleTimeout: 10 * time.Minute, Release: busy.ReleaseSkip},
+		{Path: "/mnt/backup", Unit: "mnt-backup"}, // No idle timeout
+	}}
+	a, cmds := fakeAgent(t, cfg, map[string]bool{
+		"systemctl stop mnt-data.mount":  true,
+		"systemctl stop mnt-media.mount": true,
+	})
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	setReads(t, a, map[string]int{"/mnt/data": 5, "/mnt/media": 5, "/mnt/backup": 5})
+	a.checkIdle(start)
+	// Media is read, data only keeps its session alive
+	setReads(t, a, map[string]int{"/mnt/data": 5, "/mnt/media": 9, "/mnt/backup": 5})
+	a.checkIdle(start.Add(6 * time.Minute))
+	a.checkIdle(start.Add(11 * time.Minute))
+	if got := cmds.Commands(); got != "systemctl stop mnt-data.mount|umount -l /mnt/data" {
+		t.Errorf("after data idle: %v", got)
+	}
+
+	// Data is retried only after another full timeout, media is left mounted
+	a.checkIdle(start.Add(17 * time.Minute))
+	if got := cmds.Commands(); got != "systemctl stop mnt-media.mount" {
+		t.Errorf("after media idle: %v", got)
+	}
+
+	// An unmounted mount starts over when mounted again
+	setReads(t, a, map[string]int{"/mnt/media": 9})
+	a.checkIdle(start.Add(18 * time.Minute))
+	setReads(t, a, map[string]int{"/mnt/data": 0, "/mnt/media": 9})
+	a.checkIdle(start.Add(19 * time.Minute))
+	a.checkIdle(start.Add(28 * time.Minute))
+	if got := cmds.Commands(); got != "systemctl stop mnt-media.mount" {
+		t.Errorf("after remount: %v", got)
+	}
+}
+
+func TestCheckIdle_Signal(t *testing.T) {
+	cfg := Config{Mounts: []MountConfig{{Path: "/mnt/data", Unit: "mnt-data", IdleTimeout: 10 * time.Minute, Release: busy.ReleaseSignal}}}
+	a, cmds := fakeAgent(t, cfg, map[string]bool{"systemctl stop mnt-data.mount": true})
+	a.SignalGrace = time.Millisecond
+	// A shell sitting in the mount, leaving it on SIGTERM
+	pid := filepath.Join(a.Scanner.Proc, "100")
+	os.Mkdir(pid, 0755)
+	os.Symlink("/mnt/data/photos", filepath.Join(pid, "cwd"))
+	a.Releaser.Kill = func(pid int, sig syscall.Signal) error {
+		delete(cmds.Fail, "systemctl stop mnt-data.mount")
+		return cmds.RunCommand("kill", fmt.Sprint(pid), sig.String())
+	}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	setReads(t, a, map[string]int{"/mnt/data": 5})
+	a.checkIdle(start)
+	a.checkIdle(start.Add(11 * time.Minute))
+	if got := cmds.Commands(); got != "systemctl stop mnt-data.mount|kill 100 terminated|systemctl stop mnt-data.mount" {
+		t.Errorf("Expected the unmount retried after the signal, got %v", got)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	os.WriteFile(path, []byte("mounts:\n  - path: /mnt/data\n    unit: mnt-data\n    idle_timeout: 15m\n    release: signal\n"), 0644)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PollInterval != DefaultPollInterval || len(cfg.Mounts) != 1 || cfg.Mounts[0].IdleTimeout != 15*time.Minute {
+		t.Errorf("config %+v", cfg)
+	}
+
+	os.WriteFile(path, []byte("mounts:\n  - path: /mnt/data\n    unit: mnt-data\n    release: kill\n"), 0644)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected error for invalid release")
+	}
+}
+
+func TestServe(t *testing.T) {
+	a, cmds := fakeAgent(t, Config{Mounts: []MountConfig{{Path: "/mnt/data", Unit: "mnt-data", Host: "nas"}}}, nil)
+	a.Socket = filepath.Join(t.TempDir(), "agent.sock")
+	// Not in the hook's mountinfo: the sleep only disarms the automount
+	a.Hook = &sleephook.Hook{MountInfo: filepath.Join(t.TempDir(), "mountinfo"), Runner: a.Releaser.Runner}
+	os.WriteFile(a.Hook.MountInfo, nil, 0644)
+	setReads(t, a, map[string]int{"/mnt/data": 1})
+
+	release := make(chan struct{})
+	var wakes []string
+	a.Wake = func(ctx context.Context, req Request) (string, error) {
+		wakes = append(wakes, req.Host+" "+req.Unit)
+		<-release
+		return "exports", nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+	call := func(req Request) *Response {
+		t.Helper()
+		for i := 0; ; i++ {
+			resp, err := Call(ctx, a.Socket, req)
+			if err == nil {
+				return resp
+			}
+			if !errors.Is(err, ErrUnavailable) || i == 50 {
+				t.Fatalf("%s: %v", req.Op, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	call(Request{Op: OpStatus}) // Listening
+
+	// Two mount units of the same host: one wake, both ready
+	var wg sync.WaitGroup
+	resps := make([]*Response, 2)
+	for i, unit := range []string{"mnt-data.mount", "mnt-media.mount"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resps[i] = call(Request{Op: OpWake, Host: "nas", Unit: unit})
+		}()
+	}
+	for st := a.Status(time.Now()); len(st.Hosts) == 0 || !st.Hosts[0].Waking; st = a.Status(time.Now()) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // Let the second request join
+	close(release)
+	wg.Wait()
+	if len(wakes) != 1 || resps[0].Ready != "exports" || resps[1].Ready != "exports" || resps[0].Shared == resps[1].Shared {
+		t.Errorf("wakes %v, responses %+v %+v", wakes, resps[0], resps[1])
+	}
+
+	st := call(Request{Op: OpStatus}).Status
+	if st == nil || len(st.Hosts) != 1 || len(st.Hosts[0].Wakes) != 1 || !st.Hosts[0].Wakes[0].OK() ||
+		len(st.Mounts) != 1 || !st.Mounts[0].Mounted {
+		t.Fatalf("status %+v", st)
+	}
+
+	// No wakes between the pre-sleep hook and resume
+	mounts := []sleephook.Mount{{Path: "/mnt/data", Unit: "mnt-data"}}
+	if resp := call(Request{Op: OpSleep, Mounts: mounts}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	if resp := call(Request{Op: OpWake, Host: "nas"}); !strings.Contains(resp.Error, "suspending") {
+		t.Errorf("wake while suspended: %+v", resp)
+	}
+	if resp := call(Request{Op: OpResume, Mounts: mounts}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	if got := cmds.Commands(); got != "systemctl stop mnt-data.automount|systemctl start mnt-data.automount" {
+		t.Errorf("sleep commands %v", got)
+	}
+	if resp := call(Request{Op: OpWake, Host: "nas"}); resp.Error != "" || len(wakes) != 2 {
+		t.Errorf("wake after resume: %+v", resp)
+	}
+}
+
+func TestCall_Unavailable(t *testing.T) {
+	_, err := Call(context.Background(), filepath.Join(t.TempDir(), "agent.sock"), Request{Op: OpStatus})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"autonfs/internal/busy"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is rendered by apply
+const DefaultConfigFile = "/etc/autonfs/agent.yaml"
+
+// DefaultPollInterval is how often the mount counters are read
+const DefaultPollInterval = time.Minute
+
+// Config is the agent configuration
+type Config struct {
+	Socket       string        `yaml:"socket,omitempty"` // Default DefaultSocket
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+	Mounts       []MountConfig `yaml:"mounts"`
+}
+
+// MountConfig is one AutoNFS mount watched by the agent
+type MountConfig struct {
+	Path        string        `yaml:"path"`
+	Unit        string        `yaml:"unit"` // Unit name without suffix
+	Host        string        `yaml:"host"`
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"` // Unmount after this long without NFS traffic, 0 disables
+	Release     string        `yaml:"release,omitempty"`      // Busy mounts: lazy (default), signal, skip
+}
+
+// LoadConfig reads an agent config file
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid agent config %s: %v", path, err)
+	}
+	return cfg.withDefaults(), cfg.Validate()
+}
+
+// Validate checks the mounts
+func (c Config) Validate() error {
+	for _, m := range c.Mounts {
+		if m.Path == "" || m.Unit == "" {
+			return fmt.Errorf("agent mount needs path and unit: %+v", m)
+		}
+		if m.IdleTimeout < 0 {
+			return fmt.Errorf("mount %s: negative idle_timeout", m.Path)
+		}
+		if !busy.ValidRelease(m.Release) {
+			return fmt.Errorf("mount %s: invalid release %q (lazy, signal, skip)", m.Path, m.Release)
+		}
+	}
+	return nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.Socket == "" {
+		c.Socket = DefaultSocket
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+	return c
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"autonfs/internal/sleephook"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultSocket is where the agent listens. Root only: a wake request runs
+// the host's configured power backend.
+const DefaultSocket = "/run/autonfs/agent.sock"
+
+// Request operations
+const (
+	OpWake   = "wake"   // Wake Host, joining a wake already running
+	OpStatus = "status" // Report wakes and mounts
+	OpSleep  = "sleep"  // Unmount Mounts before suspend, holding wakes until resume
+	OpResume = "resume" // Re-arm Mounts after resume
+)
+
+// ErrUnavailable means the agent could not be reached: callers do the work themselves
+var ErrUnavailable = errors.New("agent unavailable")
+
+// Request is one JSON line sent to the agent
+type Request struct {
+	Op     string            `json:"op"`
+	Host   string            `json:"host,omitempty"`   // Alias (wake)
+	Mount  string            `json:"mount,omitempty"`  // Mount point that triggered the wake, for the journal
+	Unit   string            `json:"unit,omitempty"`   // Mount unit that triggered the wake, for the journal
+	Mounts []sleephook.Mount `json:"mounts,omitempty"` // sleep, resume
+}
+
+// Response is the agent's JSON line answer
+type Response struct {
+	Error  string  `json:"error,omitempty"` // Empty on success
+	Ready  string  `json:"ready,omitempty"` // Readiness level reached (wake)
+	Shared bool    `json:"shared,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+// Call sends req to the agent on socket and waits for its answer until ctx
+// is done. Errors wrapping ErrUnavailable mean the agent is down (or died
+// answering); the request itself failed when Response.Error is set.
+func Call(ctx context.Context, socket string, req Request) (*Response, error) {
+	var dialer net.Dialer
+	dctx, cancel := context.WithTimeout(ctx, time.Second)
+	conn, err := dialer.DialContext(dctx, "unix", socket)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return &resp, nil
+}
+
+// listen replaces a socket left behind by a previous agent
+func listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// serve answers requests until l is closed
+func (a *Agent) serve(ctx context.Context, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var req Request
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				json.NewEncoder(conn).Encode(Response{Error: fmt.Sprintf("invalid request: %v", err)})
+				return
+			}
+			json.NewEncoder(conn).Encode(a.handle(ctx, req))
+		}()
+	}
+}
+
+func (a *Agent) handle(ctx context.Context, req Request) Response {
+	switch req.Op {
+	case OpWake:
+		return a.wake(ctx, req)
+	case OpStatus:
+		st := a.Status(time.Now())
+		return Response{Status: &st}
+	case OpSleep:
+		return errResponse(a.sleep(req.Mounts))
+	case OpResume:
+		return errResponse(a.resume(req.Mounts))
+	}
+	return Response{Error: fmt.Sprintf("unknown op %q", req.Op)}
+}
+
+func errResponse(err error) Response {
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+	return Response{}
+}
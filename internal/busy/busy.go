@@ -0,0 +1,172 @@
+// Package busy finds the processes pinning a mount: a working directory,
+// root, open file or memory mapping below the mount point keeps it busy,
+// so the automount never expires (TimeoutIdleSec) and the server stays up.
+package busy
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Holder is a process using a mount
+type Holder struct {
+	PID     int
+	Command string
+	User    string
+	Mount   string   // Mount point it pins
+	Uses    []string // How: cwd, root, fd 3 (/mnt/data/file), mmap (...)
+}
+
+// Scanner reads process state from a proc file system
+type Scanner struct {
+	Proc string // Default /proc
+}
+
+// Scan returns the processes using any of mounts, ordered by mount and PID.
+// Only links and text files under /proc are read, never the mounts
+// themselves, so scanning does not trigger an automount (or a wake).
+func (s Scanner) Scan(mounts []string) ([]Holder, error) {
+	proc := s.Proc
+	if proc == "" {
+		proc = "/proc"
+	}
+	entries, err := os.ReadDir(proc)
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+
+	var holders []Holder
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join(proc, e.Name())
+		// Processes may exit or deny access (other users without root) mid-scan: skip what cannot be read
+		uses := map[string][]string{}
+		add := func(path, use string) {
+			if m := mountOf(path, mounts); m != "" {
+				uses[m] = append(uses[m], use)
+			}
+		}
+		for _, link := range []string{"cwd", "root"} {
+			if target, err := os.Readlink(filepath.Join(dir, link)); err == nil {
+				add(target, link)
+			}
+		}
+		if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+			for _, fd := range fds {
+				if target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name())); err == nil {
+					add(target, fmt.Sprintf("fd %s (%s)", fd.Name(), target))
+				}
+			}
+		}
+		for _, path := range mappedFiles(filepath.Join(dir, "maps")) {
+			add(path, fmt.Sprintf("mmap (%s)", path))
+		}
+		if len(uses) == 0 {
+			continue
+		}
+
+		command, owner := processInfo(dir)
+		for m, u := range uses {
+			holders = append(holders, Holder{PID: pid, Command: command, User: owner, Mount: m, Uses: u})
+		}
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		if holders[i].Mount != holders[j].Mount {
+			return holders[i].Mount < holders[j].Mount
+		}
+		return holders[i].PID < holders[j].PID
+	})
+	return holders, nil
+}
+
+// mountOf returns the mount path lies below, the longest match for nested mounts
+func mountOf(path string, mounts []string) string {
+	path = strings.TrimSuffix(path, " (deleted)")
+	best := ""
+	for _, m := range mounts {
+		m = strings.TrimSuffix(m, "/")
+		if (path == m || strings.HasPrefix(path, m+"/")) && len(m) > len(best) {
+			best = m
+		}
+	}
+	return best
+}
+
+// mappedFiles lists the distinct files in a maps file
+func mappedFiles(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var files []string
+	for _, line := range strings.Split(string(data), "\n") {
+		// 7f..-7f.. r--p 00000000 00:2a 1234   /mnt/data/lib.so
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		// The path may contain spaces: it is everything after the fifth field
+		idx := strings.Index(line, fields[5])
+		file := strings.TrimSpace(line[idx:])
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// processInfo returns the command line (or name) and owner of a process
+func processInfo(dir string) (command, owner string) {
+	if data, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		command = strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+	}
+	if command == "" {
+		if data, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+			command = "[" + strings.TrimSpace(string(data)) + "]"
+		}
+	}
+	owner = "?"
+	if data, err := os.ReadFile(filepath.Join(dir, "status")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			// Uid: real effective saved fs
+			if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "Uid:" {
+				owner = fields[1]
+				if u, err := user.LookupId(fields[1]); err == nil {
+					owner = u.Username
+				}
+				break
+			}
+		}
+	}
+	return command, owner
+}
+
+// ParseSignal accepts a signal name with or without SIG prefix, or its number
+func ParseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "TERM":
+		return syscall.SIGTERM, nil
+	case "KILL":
+		return syscall.SIGKILL, nil
+	case "HUP":
+		return syscall.SIGHUP, nil
+	case "INT":
+		return syscall.SIGINT, nil
+	}
+	return 0, fmt.Errorf("unknown signal %q (TERM, KILL, HUP, INT or a number)", name)
+}
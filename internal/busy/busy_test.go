@@ -0,0 +1,94 @@
+package busy
+
+import (
+	"autonfs/internal/runner/runnertest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fakeProcess creates /proc/<pid> with the given links and files
+func fakeProcess(t *testing.T, proc, pid string, links, files map[string]string) {
+	dir := filepath.Join(proc, pid)
+	os.MkdirAll(filepath.Join(dir, "fd"), 0755)
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+}
+
+func TestScan(t *testing.T) {
+	proc := t.TempDir()
+	fakeProcess(t, proc, "100", map[string]string{"cwd": "/mnt/data/photos", "root": "/"},
+		map[string]string{"cmdline": "bash\x00-i\x00", "status": "Name:\tbash\nUid:\t0\t0\t0\t0\n"})
+	fakeProcess(t, proc, "200", map[string]string{"cwd": "/home/me", "root": "/", "fd/0": "/dev/pts/0", "fd/7": "/mnt/media/film.mkv"},
+		map[string]string{
+			"comm":   "vlc\n",
+			"status": "Uid:\t4242\t4242\t4242\t4242\n",
+			"maps": "7f00-7f10 r--p 00000000 00:2a 1 /usr/lib/libc.so\n" +
+				"7f10-7f20 r--p 00000000 00:2b 2 /mnt/data/my lib.so\n" +
+				"7f20-7f30 r-xp 00001000 00:2b 2 /mnt/data/my lib.so\n" +
+				"7f30-7f40 rw-p 00000000 00:00 0 [heap]\n",
+		})
+	fakeProcess(t, proc, "300", map[string]string{"cwd": "/mnt/database"}, nil)
+	os.MkdirAll(filepath.Join(proc, "self"), 0755)
+
+	holders, err := Scanner{Proc: proc}.Scan([]string{"/mnt/data", "/mnt/media/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, h := range holders {
+		got = append(got, h.Mount+" "+h.User+" "+h.Command+": "+strings.Join(h.Uses, ", "))
+	}
+	want := []string{
+		"/mnt/data root bash -i: cwd",
+		"/mnt/data 4242 [vlc]: mmap (/mnt/data/my lib.so)",
+		"/mnt/media 4242 [vlc]: fd 7 (/mnt/media/film.mkv)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("holders:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for name, want := range map[string]syscall.Signal{"TERM": syscall.SIGTERM, "sigkill": syscall.SIGKILL, "1": syscall.SIGHUP} {
+		if sig, err := ParseSignal(name); err != nil || sig != want {
+			t.Errorf("ParseSignal(%q) = %v, %v", name, sig, err)
+		}
+	}
+	if _, err := ParseSignal("STOP"); err == nil {
+		t.Error("expected error for unsupported signal")
+	}
+}
+
+func TestReleaser(t *testing.T) {
+	cmds := &runnertest.Recorder{}
+	killed := map[int]syscall.Signal{}
+	r := Releaser{
+		Runner: cmds,
+		Kill: func(pid int, sig syscall.Signal) error {
+			if pid == 300 {
+				return syscall.EPERM
+			}
+			killed[pid] = sig
+			return nil
+		},
+	}
+	holders := []Holder{{PID: 100, Mount: "/mnt/data"}, {PID: 200, Mount: "/mnt/data"}, {PID: 200, Mount: "/mnt/media"}, {PID: 300, Mount: "/mnt/media"}}
+
+	err := r.Lazy(Mounts(holders))
+	if got := cmds.Commands(); err != nil || got != "umount -l /mnt/data|umount -l /mnt/media" {
+		t.Errorf("Lazy: %v, %v", err, got)
+	}
+	err = r.Signal(holders, syscall.SIGTERM)
+	if err == nil || !strings.Contains(err.Error(), "300") || len(killed) != 2 || killed[200] != syscall.SIGTERM {
+		t.Errorf("Signal: %v, killed %v", err, killed)
+	}
+}
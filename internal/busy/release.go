@@ -0,0 +1,94 @@
+package busy
+
+import (
+	"autonfs/internal/runner"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Release policies for busy mounts
+const (
+	ReleaseLazy   = "lazy"   // Lazy unmount: processes keep what they have open, the mount leaves the tree
+	ReleaseSignal = "signal" // Signal the processes holding the mount
+	ReleaseSkip   = "skip"   // Leave the mount, only report the holders
+)
+
+// ValidRelease reports whether s is a known release policy, empty meaning lazy
+func ValidRelease(s string) bool {
+	switch s {
+	case "", ReleaseLazy, ReleaseSignal, ReleaseSkip:
+		return true
+	}
+	return false
+}
+
+// Releaser frees busy mounts
+type Releaser struct {
+	Runner runner.Runner
+	Kill   func(pid int, sig syscall.Signal) error
+}
+
+// NewReleaser returns a releaser acting on the running system
+func NewReleaser() Releaser {
+	return Releaser{
+		Runner: runner.Exec{},
+		Kill:   syscall.Kill,
+	}
+}
+
+// Lazy lazily unmounts each mount. The NFS file system stays alive until
+// the last holder lets go of it.
+func (r Releaser) Lazy(mounts []string) error {
+	var failed []string
+	for _, m := range mounts {
+		if err := r.Runner.RunCommand("umount", "-l", m); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", m, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("lazy unmount failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Signal sends sig to every process in holders, once each
+func (r Releaser) Signal(holders []Holder, sig syscall.Signal) error {
+	var failed []string
+	for _, pid := range PIDs(holders) {
+		if err := r.Kill(pid, sig); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", strconv.Itoa(pid), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not signal %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// PIDs returns the distinct processes of holders
+func PIDs(holders []Holder) []int {
+	seen := map[int]bool{}
+	var pids []int
+	for _, h := range holders {
+		if !seen[h.PID] {
+			seen[h.PID] = true
+			pids = append(pids, h.PID)
+		}
+	}
+	return pids
+}
+
+// Mounts returns the distinct mounts of holders
+func Mounts(holders []Holder) []string {
+	seen := map[string]bool{}
+	var mounts []string
+	for _, h := range holders {
+		if !seen[h.Mount] {
+			seen[h.Mount] = true
+			mounts = append(mounts, h.Mount)
+		}
+	}
+	return mounts
+}
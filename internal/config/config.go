@@ -1,12 +1,25 @@
 package config
 
 import (
+	"autonfs/internal/busy"
+	"autonfs/internal/journal"
+	"autonfs/internal/netpolicy"
+	"autonfs/internal/power"
+	"autonfs/internal/sleephook"
+	"autonfs/internal/watcher"
+	"autonfs/pkg/nfsrpc"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// WakeTimeoutAuto as wake_timeout derives the timeout from the boot times
+// recorded in the wake journal
+const WakeTimeoutAuto = "auto"
+
 // Config represents the top-level structure of autonfs.yaml
 type Config struct {
 	Hosts []HostConfig `yaml:"hosts"`
@@ -14,11 +27,48 @@ type Config struct {
 
 // HostConfig defines the configuration for a single NFS connection
 type HostConfig struct {
-	Alias       string        `yaml:"alias"`        // SSH Alias or Hostname
-	Mounts      []MountConfig `yaml:"mounts"`       // List of mounts
-	IdleTimeout string        `yaml:"idle_timeout"` // Default idle timeout for this host (e.g., "5m")
-	WakeTimeout string        `yaml:"wake_timeout"` // Timeout for WoL/Wake (e.g., "120s")
-	ShutdownCmd string        `yaml:"shutdown_cmd"` // Custom shutdown command
+	Alias        string           `yaml:"alias"`              // SSH Alias or Hostname
+	Mounts       []MountConfig    `yaml:"mounts"`             // List of mounts
+	IdleTimeout  string           `yaml:"idle_timeout"`       // Default idle timeout for this host (e.g., "5m")
+	WakeTimeout  string           `yaml:"wake_timeout"`       // Timeout for WoL/Wake (e.g., "120s"), or "auto" to learn it from past wakes
+	MountTimeout string           `yaml:"mount_timeout"`      // Mount unit timeout covering wake + NFS mount (default wake_timeout + 30s)
+	ReadyCheck   string           `yaml:"ready_check"`        // Wake readiness check: auto (default), exports, rpc, tcp
+	ReadySettle  string           `yaml:"ready_settle"`       // Extra delay after the server is ready (e.g., "5s")
+	WakeBackoff  string           `yaml:"wake_backoff"`       // Fail wakes fast for this long after a failed wake (default 1m, "0" disables)
+	WakePolicy   netpolicy.Policy `yaml:"wake_policy"`        // Where the client must be for a wake to be attempted
+	ShutdownCmd  string           `yaml:"shutdown_cmd"`       // Custom shutdown command
+	WoL          WoLConfig        `yaml:"wol"`                // Magic packet sending options
+	WakeRelay    string           `yaml:"wake_relay"`         // SSH alias on the server's LAN that sends WoL for us
+	Power        power.Config     `yaml:"power"`              // Power-on backend: wol (default), redfish, ipmi, webhook
+	Energy       journal.Energy   `yaml:"energy"`             // Power draw, for the savings in `autonfs stats`
+	SleepUnmount string           `yaml:"sleep_unmount"`      // Unmount before suspend, busy mounts: lazy (default), skip, block; off to keep mounted
+	StaleCheck   string           `yaml:"stale_check"`        // Interval of the stale mount check timer (e.g., "2m"), off when empty
+	ClientAgent  bool             `yaml:"client_agent"`       // Wake through the client agent (autonfs-agent.service), direct wakes as fallback
+	MountIdle    string           `yaml:"mount_idle_timeout"` // Agent unmounts mounts without NFS traffic for this long (e.g., "30m"), off when empty
+	MountRelease string           `yaml:"mount_idle_release"` // Idle but busy mounts: lazy (default), signal, skip
+	Jobs         []JobConfig      `yaml:"jobs"`               // Scheduled commands run with the host held awake
+
+	// Watcher holds advanced watcher settings (sources, schedules, hooks...).
+	// Rendered into /etc/autonfs/watcher.yaml on the server. It uses the
+	// watcher's own schema, so apply rejects settings the server would refuse
+	// instead of keeping a second copy in sync; client and server run the
+	// same binary, the import costs nothing.
+	Watcher watcher.WatchConfig `yaml:"watcher"`
+}
+
+// WoLConfig tunes how magic packets are sent to a host
+type WoLConfig struct {
+	MACs      []string `yaml:"macs"`      // Additional MACs (bonded NICs), the discovered MAC is always used
+	Broadcast string   `yaml:"broadcast"` // Target address, default subnet-directed broadcast from discovery
+	Interface string   `yaml:"interface"` // Client interface to send on, default all
+	Ports     []int    `yaml:"ports"`     // Default 9 and 7
+	Interval  string   `yaml:"interval"`  // Resend interval until the host is ready, default 2s
+	Raw       bool     `yaml:"raw"`       // Send EtherType 0x0842 frames instead of UDP (falls back to UDP)
+
+	// SecureOn password, never inline: read from a file or an environment
+	// variable when applying, then installed root-only for the mount unit
+	SecureOnFile string `yaml:"secureon_file"`
+	SecureOnEnv  string `yaml:"secureon_env"`
 }
 
 // MountConfig defines a single directory mapping
@@ -28,6 +78,15 @@ type MountConfig struct {
 	Options string `yaml:"options"` // Mount options (e.g. "rw,soft,timeo=100")
 }
 
+// JobConfig is a command run on a schedule through `autonfs run`: the host
+// is woken, held awake with its mounts up, and released afterwards
+type JobConfig struct {
+	Name     string `yaml:"name"`     // Names the units, autonfs-job-<alias>-<name>
+	Schedule string `yaml:"schedule"` // systemd OnCalendar expression (e.g., "*-*-* 02:30")
+	Command  string `yaml:"command"`  // Run with sh -c
+	Hold     string `yaml:"hold"`     // Hold lease, default that of `autonfs run`
+}
+
 // ParseConfig parses YAML content into a Config struct
 func ParseConfig(data []byte) (*Config, error) {
 	var cfg Config
@@ -69,11 +128,124 @@ func (c *Config) Validate() error {
 				return fmt.Errorf("host %s invalid idle_timeout: %v", host.Alias, err)
 			}
 		}
-		if host.WakeTimeout != "" {
+		if host.WakeTimeout != "" && host.WakeTimeout != WakeTimeoutAuto {
 			if _, err := time.ParseDuration(host.WakeTimeout); err != nil {
 				return fmt.Errorf("host %s invalid wake_timeout: %v", host.Alias, err)
 			}
 		}
+		if host.MountTimeout != "" {
+			if _, err := time.ParseDuration(host.MountTimeout); err != nil {
+				return fmt.Errorf("host %s invalid mount_timeout: %v", host.Alias, err)
+			}
+		}
+		if host.StaleCheck != "" {
+			if d, err := time.ParseDuration(host.StaleCheck); err != nil || d < time.Second {
+				return fmt.Errorf("host %s invalid stale_check %q (at least 1s)", host.Alias, host.StaleCheck)
+			}
+		}
+		if host.MountIdle != "" {
+			if d, err := time.ParseDuration(host.MountIdle); err != nil || d < time.Minute {
+				return fmt.Errorf("host %s invalid mount_idle_timeout %q (at least 1m)", host.Alias, host.MountIdle)
+			}
+		}
+		if !busy.ValidRelease(host.MountRelease) {
+			return fmt.Errorf("host %s invalid mount_idle_release %q (lazy, signal, skip)", host.Alias, host.MountRelease)
+		}
+		jobs := map[string]bool{}
+		for j, job := range host.Jobs {
+			if !validJobName(job.Name) || jobs[job.Name] {
+				return fmt.Errorf("host %s job #%d: name %q must be unique, letters, digits, - and _", host.Alias, j, job.Name)
+			}
+			jobs[job.Name] = true
+			if strings.TrimSpace(job.Schedule) == "" || strings.TrimSpace(job.Command) == "" || strings.ContainsAny(job.Schedule+job.Command, "\n\r") {
+				return fmt.Errorf("host %s job %s needs a one-line schedule and command", host.Alias, job.Name)
+			}
+			if job.Hold != "" {
+				if d, err := time.ParseDuration(job.Hold); err != nil || d < time.Minute {
+					return fmt.Errorf("host %s job %s invalid hold %q (at least 1m)", host.Alias, job.Name, job.Hold)
+				}
+			}
+		}
+		if !sleephook.ValidPolicy(host.SleepUnmount) {
+			return fmt.Errorf("host %s invalid sleep_unmount %q (lazy, skip, block, off)", host.Alias, host.SleepUnmount)
+		}
+		if host.ReadyCheck != "" && !nfsrpc.ValidStrategy(host.ReadyCheck) {
+			return fmt.Errorf("host %s invalid ready_check %q (auto, exports, rpc, tcp)", host.Alias, host.ReadyCheck)
+		}
+		if host.ReadySettle != "" {
+			if _, err := time.ParseDuration(host.ReadySettle); err != nil {
+				return fmt.Errorf("host %s invalid ready_settle: %v", host.Alias, err)
+			}
+		}
+		if host.WakeBackoff != "" {
+			if d, err := time.ParseDuration(host.WakeBackoff); err != nil || d < 0 {
+				return fmt.Errorf("host %s invalid wake_backoff %q", host.Alias, host.WakeBackoff)
+			}
+		}
+		if err := host.WakePolicy.Validate(); err != nil {
+			return fmt.Errorf("host %s invalid wake_policy: %v", host.Alias, err)
+		}
+		if strings.ContainsAny(host.WakeRelay, " \t\"'\\") {
+			return fmt.Errorf("host %s invalid wake_relay %q", host.Alias, host.WakeRelay)
+		}
+		if err := host.WoL.Validate(); err != nil {
+			return fmt.Errorf("host %s invalid wol config: %v", host.Alias, err)
+		}
+		if err := host.Power.Validate(); err != nil {
+			return fmt.Errorf("host %s invalid power config: %v", host.Alias, err)
+		}
+		if err := host.Watcher.Validate(); err != nil {
+			return fmt.Errorf("host %s invalid watcher config: %v", host.Alias, err)
+		}
+	}
+	return nil
+}
+
+// validJobName reports whether name is usable in a unit name
+func validJobName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// AliasFileName makes a host alias safe as part of a file or unit name
+func AliasFileName(alias string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, alias)
+}
+
+// Validate checks the WoL settings
+func (w WoLConfig) Validate() error {
+	for _, mac := range w.MACs {
+		if _, err := net.ParseMAC(mac); err != nil {
+			return fmt.Errorf("invalid mac %q: %v", mac, err)
+		}
+	}
+	if w.Broadcast != "" && net.ParseIP(w.Broadcast).To4() == nil {
+		return fmt.Errorf("broadcast must be an IPv4 address, got %q", w.Broadcast)
+	}
+	for _, p := range w.Ports {
+		if p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port %d", p)
+		}
+	}
+	if w.Interval != "" {
+		if d, err := time.ParseDuration(w.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid interval %q", w.Interval)
+		}
+	}
+	if w.SecureOnFile != "" && w.SecureOnEnv != "" {
+		return fmt.Errorf("set only one of secureon_file and secureon_env")
 	}
 	return nil
 }
@@ -73,6 +73,108 @@ hosts:
 `,
 			wantErr: true,
 		},
+		{
+			name: "duplicate job",
+			yaml: `
+hosts:
+  - alias: nas
+    mounts: [{local: /a, remote: /b}]
+    jobs:
+      - {name: backup, schedule: daily, command: restic backup /a}
+      - {name: backup, schedule: weekly, command: restic check}
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid mount idle release",
+			yaml: `
+hosts:
+  - alias: nas
+    mount_idle_timeout: "30m"
+    mount_idle_release: "kill"
+    mounts: [{local: /a, remote: /b}]
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid watcher source",
+			yaml: `
+hosts:
+  - alias: nas
+    mounts: [{local: /a, remote: /b}]
+    watcher:
+      sources: [cpu]
+`,
+			wantErr: true,
+		},
+		{
+			name: "secureon from file and env",
+			yaml: `
+hosts:
+  - alias: nas
+    mounts: [{local: /a, remote: /b}]
+    wol:
+      secureon_file: /root/nas.secureon
+      secureon_env: NAS_SECUREON
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid ready check",
+			yaml: `
+hosts:
+  - alias: nas
+    ready_check: ping
+    mounts: [{local: /a, remote: /b}]
+`,
+			wantErr: true,
+		},
+		{
+			name: "negative wake backoff",
+			yaml: `
+hosts:
+  - alias: nas
+    wake_backoff: -1m
+    mounts: [{local: /a, remote: /b}]
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid wake policy subnet",
+			yaml: `
+hosts:
+  - alias: nas
+    mounts: [{local: /a, remote: /b}]
+    wake_policy:
+      subnets: [192.168.1.0]
+`,
+			wantErr: true,
+		},
+		{
+			name: "inline power password",
+			yaml: `
+hosts:
+  - alias: nas
+    mounts: [{local: /a, remote: /b}]
+    power:
+      backend: ipmi
+      ipmi:
+        host: 192.168.1.60
+        username: admin
+        password: {value: hunter2}
+`,
+			wantErr: true,
+		},
+		{
+			name: "learned wake timeout",
+			yaml: `
+hosts:
+  - alias: nas
+    wake_timeout: auto
+    mounts: [{local: /a, remote: /b}]
+`,
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,131 @@
+package deployer
+
+import (
+	"autonfs/internal/agent"
+	"autonfs/internal/config"
+	"autonfs/internal/templates"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AgentServiceFile runs the client agent, shared by all hosts
+const AgentServiceFile = "/etc/systemd/system/autonfs-agent.service"
+
+const agentService = "autonfs-agent.service"
+
+// AgentHost reports whether host is served by the client agent
+func AgentHost(host config.HostConfig) bool {
+	return host.ClientAgent || host.MountIdle != ""
+}
+
+// buildAgentConfig returns the agent settings for the hosts of cfg, with no
+// mounts when no host asks for the agent
+func buildAgentConfig(cfg *config.Config) agent.Config {
+	var ac agent.Config
+	for _, host := range cfg.Hosts {
+		if !AgentHost(host) {
+			continue
+		}
+		var idle time.Duration
+		if host.MountIdle != "" {
+			idle, _ = time.ParseDuration(host.MountIdle) // Validated with the config
+		}
+		for _, m := range host.Mounts {
+			ac.Mounts = append(ac.Mounts, agent.MountConfig{
+				Path:        m.Local,
+				Unit:        MountUnitName(m.Local),
+				Host:        host.Alias,
+				IdleTimeout: idle,
+				Release:     host.MountRelease,
+			})
+		}
+	}
+	return ac
+}
+
+// applyAgent installs the client agent for the hosts with client_agent or
+// mount_idle_timeout set, or removes it when no host has them
+func (d *Deployer) applyAgent(cfg *config.Config, opts ApplyOptions) error {
+	ac := buildAgentConfig(cfg)
+	if len(ac.Mounts) == 0 {
+		return d.removeAgent(opts)
+	}
+
+	body, err := yaml.Marshal(ac)
+	if err != nil {
+		return err
+	}
+	exe, _ := os.Executable()
+	tmplCfg := templates.Config{BinaryPath: exe, AgentConfig: string(body)}
+	service, err := templates.Render("agent-service", templates.ClientAgentServiceTmpl, tmplCfg)
+	if err != nil {
+		return err
+	}
+	agentCfg, err := templates.Render("agent-config", templates.ClientAgentConfigTmpl, tmplCfg)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, f := range []struct {
+		path    string
+		content []byte
+	}{{agent.DefaultConfigFile, agentCfg}, {AgentServiceFile, service}} {
+		if !hasChange(d.localExec, f.path, f.content) {
+			continue
+		}
+		slog.Info("Updating Client Agent", "file", f.path)
+		changed = true
+		if opts.DryRun {
+			slog.Info("DRY-RUN: Write content", "file", f.path)
+			continue
+		}
+		if f.path == agent.DefaultConfigFile {
+			dir := filepath.Dir(f.path)
+			if err := d.localExec.RunCommand("sudo", "mkdir", "-p", dir); err != nil {
+				return fmt.Errorf("failed to create %s: %v", dir, err)
+			}
+		}
+		if err := localWrite(d.localExec, f.path, f.content); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		slog.Info("DRY-RUN: Enable --now", "unit", agentService)
+		return nil
+	}
+	if changed {
+		d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
+	}
+	if err := d.localExec.RunCommand("sudo", "systemctl", "enable", "--now", agentService); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", agentService, err)
+	}
+	if changed {
+		// Pick up the new mounts
+		d.localExec.RunCommand("sudo", "systemctl", "restart", agentService)
+	}
+	return nil
+}
+
+func (d *Deployer) removeAgent(opts ApplyOptions) error {
+	if _, err := d.localExec.ReadFile(AgentServiceFile); err != nil {
+		return nil
+	}
+	slog.Info("Removing Client Agent", "file", AgentServiceFile)
+	if opts.DryRun {
+		slog.Info("DRY-RUN: Disable and remove", "unit", agentService)
+		return nil
+	}
+	d.localExec.RunCommand("sudo", "systemctl", "disable", "--now", agentService)
+	if err := d.localExec.RunCommand("sudo", "rm", "-f", AgentServiceFile, agent.DefaultConfigFile); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", AgentServiceFile, err)
+	}
+	d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
+	return nil
+}
@@ -1,18 +1,30 @@
 package deployer
 
 import (
+	"autonfs/internal/agent"
 	"autonfs/internal/builder"
 	"autonfs/internal/config"
 	"autonfs/internal/discover"
+	"autonfs/internal/journal"
 	"autonfs/internal/templates"
+	"autonfs/internal/watcher"
+	"autonfs/pkg/nfsrpc"
 	"autonfs/pkg/sshutil"
+	"autonfs/pkg/wol"
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Options Deployment Options
@@ -119,6 +131,16 @@ func (d *Deployer) Apply(cfg *config.Config, opts ApplyOptions) error {
 			return fmt.Errorf("failed to deploy host %s: %v", host.Alias, err)
 		}
 	}
+	// One hook covers the mounts of all hosts
+	if err := d.applySleepHook(cfg, opts); err != nil {
+		return fmt.Errorf("failed to install sleep hook: %v", err)
+	}
+	if err := d.applyStaleCheck(cfg, opts); err != nil {
+		return fmt.Errorf("failed to install stale check: %v", err)
+	}
+	if err := d.applyAgent(cfg, opts); err != nil {
+		return fmt.Errorf("failed to install client agent: %v", err)
+	}
 	return nil
 }
 
@@ -171,6 +193,32 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 		})
 	}
 
+	watcherCfg, err := buildWatcherConfig(host, opts)
+	if err != nil {
+		return err
+	}
+
+	boots := clientBoots(d.localExec, host.Alias)
+	wakeTimeout, mountTimeout, warnings, err := clientTimeouts(host, boots)
+	if err != nil {
+		return err
+	}
+	if host.WakeTimeout == config.WakeTimeoutAuto {
+		slog.Info("Wake timeout from boot history", "host", host.Alias, "timeout", wakeTimeout, "wakes", boots.Samples)
+	}
+	for _, w := range warnings {
+		slog.Warn("Inconsistent timeouts", "host", host.Alias, "problem", w)
+	}
+	// Fail before touching the server if the password source is broken
+	secureOn, err := wol.LoadPassword(host.WoL.SecureOnFile, host.WoL.SecureOnEnv)
+	if err != nil {
+		return fmt.Errorf("host %s: %v", host.Alias, err)
+	}
+	powerContent, err := powerConfig(host)
+	if err != nil {
+		return err
+	}
+
 	// Use first mount for basic template vars if needed, or defaults
 	tmplCfg := templates.Config{
 		ServerIP:      info.IP,
@@ -178,20 +226,23 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 		MacAddr:       info.MAC,
 		BinaryPath:    "/usr/local/bin/autonfs",
 		IdleTimeout:   host.IdleTimeout,
-		WakeTimeout:   host.WakeTimeout,
-		LoadThreshold: "0.5", // Default? Add to YAML?
+		WakeTimeout:   wakeTimeout.String(),
+		MountTimeout:  strconv.Itoa(int(mountTimeout.Seconds())),
+		ReadyCheck:    host.ReadyCheck,
+		ReadySettle:   host.ReadySettle,
+		WakeBackoff:   wakeBackoff(host),
 		Exports:       exports,
-		WatcherDryRun: opts.WatcherDryRun, // Pass Watcher Dry Run flag
-		ShutdownCmd:   host.ShutdownCmd,
+		WatcherConfig: string(watcherCfg),
 	}
 	if tmplCfg.IdleTimeout == "" {
 		tmplCfg.IdleTimeout = "5m"
 	} // Default
-	if tmplCfg.WakeTimeout == "" {
-		tmplCfg.WakeTimeout = "120s"
+	if tmplCfg.ReadyCheck == "" {
+		tmplCfg.ReadyCheck = nfsrpc.ReadyAuto
 	}
 
 	serviceContent, _ := templates.Render("service", templates.ServerServiceTmpl, tmplCfg)
+	watcherContent, _ := templates.Render("watcher", templates.ServerWatcherConfigTmpl, tmplCfg)
 	exportsContent, _ := templates.Render("exports", templates.ServerExportsTmpl, tmplCfg)
 
 	// 5. Upload & Install Server Components
@@ -199,11 +250,13 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 	if opts.DryRun {
 		slog.Info("DRY-RUN: Upload binary", "path", "/usr/local/bin/autonfs")
 		slog.Info("DRY-RUN: Install service", "service", "autonfs-watcher.service")
+		slog.Info("DRY-RUN: Install watcher config", "path", "/etc/autonfs/watcher.yaml")
 		slog.Info("DRY-RUN: Configure exports", "path", "/etc/exports.d/autonfs.exports")
 		slog.Info("DRY-RUN: Reload/Restart services")
 	} else {
 		// Checks
 		serviceChanged := remoteHasChange(client, "/etc/systemd/system/autonfs-watcher.service", serviceContent)
+		watcherChanged := remoteHasChange(client, "/etc/autonfs/watcher.yaml", watcherContent)
 		_ = remoteHasChange(client, "/etc/exports.d/autonfs.exports", exportsContent) // Check but ignore result for now
 
 		// Upload Binary (Always upload binary for now, or check checksum? Stick to always for simplicity/safety)
@@ -214,6 +267,10 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 		if err := writeToRemoteTmp(client, serviceContent, "/tmp/autonfs-watcher.service"); err != nil {
 			return err
 		}
+		// Upload Watcher Config
+		if err := writeToRemoteTmp(client, watcherContent, "/tmp/autonfs-watcher.yaml"); err != nil {
+			return err
+		}
 		// Upload Exports
 		if err := writeToRemoteTmp(client, exportsContent, "/tmp/autonfs.exports"); err != nil {
 			return err
@@ -226,6 +283,8 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 			"mv /tmp/autonfs /usr/local/bin/autonfs",
 			"chmod +x /usr/local/bin/autonfs",
 			"mv /tmp/autonfs-watcher.service /etc/systemd/system/autonfs-watcher.service",
+			"mkdir -p /etc/autonfs",
+			"mv /tmp/autonfs-watcher.yaml /etc/autonfs/watcher.yaml",
 			"mkdir -p /etc/exports.d",
 			"mv /tmp/autonfs.exports /etc/exports.d/autonfs.exports",
 			"systemctl daemon-reload",
@@ -236,6 +295,10 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 		if serviceChanged {
 			slog.Info("Remote Watcher Service Changed -> Restarting")
 			installCmds = append(installCmds, "systemctl restart autonfs-watcher.service")
+		} else if watcherChanged {
+			// Config only: SIGHUP keeps the idle countdown
+			slog.Info("Remote Watcher Config Changed -> Reloading")
+			installCmds = append(installCmds, "systemctl reload autonfs-watcher.service")
 		}
 
 		// Note: exportsChanged doesn't need service restart, exportfs -ra is enough (included above).
@@ -255,6 +318,43 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 	slog.Info("Deploying Local Units...")
 	anyHostChange := false
 
+	secureOnFile, err := installSecureOn(d.localExec, host.Alias, secureOn, opts.DryRun)
+	if err != nil {
+		return err
+	}
+	powerConfigFile := ""
+	if powerContent != nil {
+		powerConfigFile, err = installRootOnly(d.localExec, PowerDir, config.AliasFileName(host.Alias)+".yaml", powerContent, "power config", opts.DryRun)
+		if err != nil {
+			return err
+		}
+	}
+	if cmd := host.Power.ShutdownCommand(); cmd != "" && host.ShutdownCmd == "" && host.Watcher.ShutdownCmd == "" {
+		slog.Info("Hypervisor shutdown configured: root on the server must be able to `ssh` to the hypervisor non-interactively", "command", cmd)
+	}
+	if len(host.Jobs) > 0 && len(host.Watcher.Sources) > 0 && !slices.Contains(host.Watcher.Sources, watcher.SourceHolds) {
+		slog.Warn("Jobs configured but the watcher ignores holds: add holds to watcher.sources or the server may shut down mid-job", "host", host.Alias)
+	}
+	if host.WakeRelay != "" {
+		// systemd runs the wake as root, with root's ~/.ssh/config and keys
+		slog.Info("Wake relay configured: root must be able to `ssh` to it non-interactively", "relay", host.WakeRelay)
+	}
+	cache := HostCache{
+		Alias:        host.Alias,
+		IP:           info.IP,
+		MAC:          info.MAC,
+		Prefix:       info.Prefix,
+		Broadcast:    wolBroadcast(host, info),
+		SecureOnFile: secureOnFile,
+		PowerConfig:  powerConfigFile,
+		Host:         host,
+	}
+	// Read before the cache is replaced: jobs dropped since then are removed below
+	prevJobs := previousJobs(d.localExec, host.Alias)
+	if err := writeHostCache(d.localExec, cache, opts.DryRun); err != nil {
+		return err
+	}
+
 	for _, m := range host.Mounts {
 		unitName := escapeSystemdPath(m.Local)
 		mountTmplCfg := templates.Config{
@@ -263,9 +363,31 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 			LocalDir:     m.Local,
 			MacAddr:      info.MAC,
 			BinaryPath:   "/usr/local/bin/autonfs",
-			IdleTimeout:  host.IdleTimeout,
+			IdleTimeout:  tmplCfg.IdleTimeout,
+			WakeTimeout:  tmplCfg.WakeTimeout,
+			MountTimeout: tmplCfg.MountTimeout,
+			ReadyCheck:   tmplCfg.ReadyCheck,
+			ReadySettle:  tmplCfg.ReadySettle,
+			WakeBackoff:  tmplCfg.WakeBackoff,
+			ExtraMACs:    host.WoL.MACs,
+			Broadcast:    cache.Broadcast,
+			WolInterface: host.WoL.Interface,
+			WolPorts:     host.WoL.Ports,
+			WolInterval:  host.WoL.Interval,
+			WolRaw:       host.WoL.Raw,
+			WakeRelay:    host.WakeRelay,
+			SecureOnFile: secureOnFile,
+			PowerConfig:  powerConfigFile,
+			WakeSubnets:  host.WakePolicy.Subnets,
+			GatewayMACs:  host.WakePolicy.GatewayMACs,
+			Reachable:    host.WakePolicy.Reachable,
+			NoBattery:    host.WakePolicy.NoBattery,
+			Alias:        host.Alias,
 			MountOptions: m.Options,
 		}
+		if AgentHost(host) {
+			mountTmplCfg.AgentSocket = agent.DefaultSocket
+		}
 
 		// Lookup executable logic
 		exe, _ := os.Executable()
@@ -339,6 +461,9 @@ func (d *Deployer) applyHost(host config.HostConfig, opts ApplyOptions) error {
 			d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
 		}
 	}
+	if err := d.applyJobs(host, prevJobs, opts); err != nil {
+		return err
+	}
 
 	slog.Info("Deployment Applied Successfully!")
 	return nil
@@ -384,6 +509,203 @@ func (d *Deployer) Run(opts Options) error {
 
 var RunByTest = false // Helper for testing
 
+// buildWatcherConfig merges the host level settings into the watcher YAML
+func buildWatcherConfig(host config.HostConfig, opts ApplyOptions) ([]byte, error) {
+	wc := host.Watcher
+	if wc.IdleTimeout == 0 {
+		idle := host.IdleTimeout
+		if idle == "" {
+			idle = "5m" // Default
+		}
+		d, err := time.ParseDuration(idle)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idle_timeout: %v", err)
+		}
+		wc.IdleTimeout = d
+	}
+	if wc.LoadThreshold == 0 {
+		wc.LoadThreshold = 0.5
+	}
+	if wc.ShutdownCmd == "" {
+		wc.ShutdownCmd = host.ShutdownCmd
+	}
+	if wc.ShutdownCmd == "" {
+		// e.g. stopping the VM from the hypervisor instead of a guest poweroff
+		wc.ShutdownCmd = host.Power.ShutdownCommand()
+	}
+	if wc.StatusFile == "" {
+		wc.StatusFile = watcher.DefaultStatusFile
+	}
+	if wc.JournalFile == "" {
+		wc.JournalFile = journal.DefaultServerFile
+	}
+	wc.DryRun = wc.DryRun || opts.WatcherDryRun
+
+	out, err := yaml.Marshal(wc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render watcher config: %v", err)
+	}
+	return out, nil
+}
+
+// wolBroadcast picks the WoL target: configured, else the subnet-directed
+// broadcast of the discovered server address, else wake's default
+func wolBroadcast(host config.HostConfig, info *discover.ServerInfo) string {
+	if host.WoL.Broadcast != "" {
+		return host.WoL.Broadcast
+	}
+	if info.Prefix == 0 || info.Prefix >= 31 {
+		// Unknown, or a point-to-point link without broadcast
+		return ""
+	}
+	bcast, err := wol.DirectedBroadcast(info.IP, info.Prefix)
+	if err != nil {
+		return ""
+	}
+	return bcast
+}
+
+// SecureOnDir holds the root-only SecureOn password files read by the mount units
+const SecureOnDir = "/etc/autonfs/secureon"
+
+// PowerDir holds the root-only power backend configs read by the mount units
+const PowerDir = "/etc/autonfs/power"
+
+// installSecureOn installs the password root-only and returns its path, so the
+// mount unit only references the file and `systemctl status` never shows the password
+func installSecureOn(executor LocalExecutor, alias string, password []byte, dryRun bool) (string, error) {
+	if len(password) == 0 {
+		return "", nil
+	}
+	content := []byte(hex.EncodeToString(password) + "\n")
+	return installRootOnly(executor, SecureOnDir, config.AliasFileName(alias)+".key", content, "SecureOn password", dryRun)
+}
+
+// powerConfig resolves the backend secrets of a host into the content of
+// its root-only power config. WoL hosts need no file and get nil.
+func powerConfig(host config.HostConfig) ([]byte, error) {
+	if host.Power.IsWoL() {
+		return nil, nil
+	}
+	cfg := host.Power
+	cfg.Alias = host.Alias
+	if err := cfg.ResolveSecrets(); err != nil {
+		return nil, fmt.Errorf("host %s: %v", host.Alias, err)
+	}
+	return yaml.Marshal(cfg)
+}
+
+// installRootOnly writes a file only root can read into dir and returns its path
+func installRootOnly(executor LocalExecutor, dir, name string, content []byte, what string, dryRun bool) (string, error) {
+	path := filepath.Join(dir, name)
+	if dryRun {
+		slog.Info("DRY-RUN: Install "+what, "file", path)
+		return path, nil
+	}
+	// Unreadable for us once installed, so this usually rewrites the same content
+	if !hasChange(executor, path, content) {
+		return path, nil
+	}
+	if err := executor.RunCommand("sudo", "mkdir", "-p", "-m", "0700", dir); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	// The temp file is created 0600, only ownership is left to fix
+	if err := localWrite(executor, path, content); err != nil {
+		return "", err
+	}
+	if err := executor.RunCommand("sudo", "chown", "root:root", path); err != nil {
+		return "", fmt.Errorf("failed to secure %s: %v", path, err)
+	}
+	return path, nil
+}
+
+// Client timeout defaults
+const (
+	defaultWakeTimeout   = 120 * time.Second
+	mountTimeoutMargin   = 30 * time.Second        // Default time left for the NFS mount after the wake
+	minMountAfterWake    = 10 * time.Second        // Less than this after the wake is flagged
+	defaultWakeBackoff   = time.Minute             // Failed wakes are not retried by mount units for this long
+	unlearnedWakeTimeout = journal.MaxTimedOutBoot // wake_timeout auto before enough boots are on record
+)
+
+// wakeBackoff returns the wake --backoff value of a host, "" when disabled
+func wakeBackoff(host config.HostConfig) string {
+	if backoff := backoffWindow(host); backoff > 0 {
+		return backoff.String()
+	}
+	return ""
+}
+
+func backoffWindow(host config.HostConfig) time.Duration {
+	if host.WakeBackoff == "" {
+		return defaultWakeBackoff
+	}
+	backoff, _ := time.ParseDuration(host.WakeBackoff) // Validated with the config
+	return backoff
+}
+
+// WakeTimeouts returns the wake timeout and back-off window apply renders
+// into the mount units of host, given its boot history
+func WakeTimeouts(host config.HostConfig, boots journal.BootProfile) (wake, backoff time.Duration, err error) {
+	wake, _, _, err = clientTimeouts(host, boots)
+	return wake, backoffWindow(host), err
+}
+
+// clientBoots reads the boot history of a host from the wake journal of this client
+func clientBoots(executor LocalExecutor, alias string) journal.BootProfile {
+	data, err := executor.ReadFile(journal.DefaultClientFile)
+	if err != nil {
+		return journal.BootProfile{}
+	}
+	entries, _ := journal.Read(bytes.NewReader(data))
+	return journal.Boots(entries, alias)
+}
+
+// clientTimeouts resolves the wake and mount unit timeouts of a host and
+// reports combinations that make the first access fail. With wake_timeout
+// auto the timeout comes from the boot history, a generous default is used
+// until enough boots are on record.
+func clientTimeouts(host config.HostConfig, boots journal.BootProfile) (wake, mount time.Duration, warnings []string, err error) {
+	wake = defaultWakeTimeout
+	switch host.WakeTimeout {
+	case "":
+	case config.WakeTimeoutAuto:
+		wake = unlearnedWakeTimeout
+		if boots.Suggested > 0 {
+			wake = boots.Suggested
+		}
+	default:
+		if wake, err = time.ParseDuration(host.WakeTimeout); err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid wake_timeout: %v", err)
+		}
+		if boots.Suggested > 0 && wake < boots.P95 {
+			warnings = append(warnings, fmt.Sprintf("wake_timeout (%s) is below observed boot times (p95 %s, max %s over %d wakes): wakes will time out, suggested %s or auto",
+				wake, boots.P95.Round(time.Second), boots.Max.Round(time.Second), boots.Samples, boots.Suggested))
+		}
+	}
+	mount = wake + mountTimeoutMargin
+	if host.MountTimeout != "" {
+		if mount, err = time.ParseDuration(host.MountTimeout); err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid mount_timeout: %v", err)
+		}
+	}
+	// systemd only takes whole seconds
+	mount = mount.Round(time.Second)
+
+	if host.ReadySettle != "" {
+		if settle, err := time.ParseDuration(host.ReadySettle); err == nil && settle >= wake {
+			warnings = append(warnings, fmt.Sprintf("ready_settle (%s) is not shorter than wake_timeout (%s): the wake always times out", settle, wake))
+		}
+	}
+	switch {
+	case mount <= wake:
+		warnings = append(warnings, fmt.Sprintf("mount_timeout (%s) does not exceed wake_timeout (%s): systemd stops the mount before the server is up", mount, wake))
+	case mount-wake < minMountAfterWake:
+		warnings = append(warnings, fmt.Sprintf("mount_timeout (%s) leaves less than %s after wake_timeout (%s) for the NFS mount", mount, minMountAfterWake, wake))
+	}
+	return wake, mount, warnings, nil
+}
+
 // Helper: Write content to remote temp file (no sudo)
 func writeToRemoteTmp(c SSHClient, content []byte, remotePath string) error {
 	tmpFile, err := os.CreateTemp("", "deploy_config_*_"+filepath.Base(remotePath))
@@ -451,14 +773,8 @@ func remoteHasChange(client SSHClient, path string, newContent []byte) bool {
 	if err != nil {
 		return true // File doesn't exist or error -> updated
 	}
-	// RunCommand output might contain newlines?
-	// Usually RunCommand returns trimmed output?
-	// The original RunCommand implementation returns []byte or string?
-	// Checking interfaces.go: RunCommand(cmd string) (string, error)
-	// So it returns string. We should compare string(newContent).
-	// But `cat` output implies exact content?
-	// Let's assume exact match.
-	return out != string(newContent)
+	// RunCommand trims its output, the rendered files end in a newline
+	return out != strings.TrimSpace(string(newContent))
 }
 
 // Helper: Convert path to systemd escaped string (pure Go implementation)
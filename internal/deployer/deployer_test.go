@@ -2,10 +2,17 @@ package deployer
 
 import (
 	"autonfs/internal/config"
+	"autonfs/internal/journal"
+	"autonfs/internal/power"
+	"autonfs/internal/watcher"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func init() {
@@ -21,6 +28,11 @@ type MockSSHClient struct {
 	FailOnConnect bool
 	FailOnCmd     string // if cmd contains this string, return error
 	DiscoveryInfo string // return this for discovery command
+
+	// Remote files for cat, trimmed like the real client. Uploaded files
+	// are kept in Uploads when set.
+	Files   map[string]string
+	Uploads map[string]string
 }
 
 func (m *MockSSHClient) Connect() error {
@@ -46,6 +58,10 @@ func (m *MockSSHClient) RunTerminal(cmd string) error {
 
 func (m *MockSSHClient) UploadFile(localPath, remotePath string) error {
 	m.UploadCalls = append(m.UploadCalls, fmt.Sprintf("%s -> %s", localPath, remotePath))
+	// The binary is only a name from MockBuilder
+	if data, err := os.ReadFile(localPath); err == nil && m.Uploads != nil {
+		m.Uploads[remotePath] = string(data)
+	}
 	return nil
 }
 
@@ -67,6 +83,13 @@ func (m *MockSSHClient) RunCommand(cmd string) (string, error) {
 		}
 		return "eth0|192.168.1.100|00:11:22:33:44:55", nil
 	}
+	if path, ok := strings.CutPrefix(cmd, "cat "); ok && m.Files != nil {
+		content, ok := m.Files[path]
+		if !ok {
+			return "", fmt.Errorf("cat: %s: No such file or directory", path)
+		}
+		return strings.TrimSpace(content), nil
+	}
 	return "", nil
 }
 
@@ -187,9 +210,9 @@ func TestDeployer_Apply_MultiHost(t *testing.T) {
 	}
 
 	// Verify we ran logic twice (roughly)
-	// Check Upload calls count. 3 files per host = 6 calls total.
-	// Binary, Service, Exports.
-	expectedUploads := 6
+	// Check Upload calls count. 4 files per host = 8 calls total.
+	// Binary, Service, Watcher Config, Exports.
+	expectedUploads := 8
 	if len(mockClient.UploadCalls) != expectedUploads {
 		t.Errorf("Expected %d Upload calls, got %d", expectedUploads, len(mockClient.UploadCalls))
 	}
@@ -198,16 +221,17 @@ func TestDeployer_Apply_MultiHost(t *testing.T) {
 	// 2 mount files + 2 automount files = 4 writes
 	mvCount := 0
 	for _, cmd := range mockLocal.Cmds {
-		if strings.Contains(cmd, "mv") {
+		if strings.Contains(cmd, "mv") && strings.Contains(cmd, "/etc/systemd/system/") {
 			mvCount++
 		}
 	}
-	// Local writes use `mv`.
+	// Local writes use `mv`, the host caches are not counted.
 	// Mount + Automount for Host1 = 2
 	// Mount + Automount for Host2 = 2
-	// Total 4.
-	if mvCount != 4 {
-		t.Errorf("Expected 4 local mv operations (mount+automount units), got %d. Cmds: %v", mvCount, mockLocal.Cmds)
+	// One sleep hook for both = 1
+	// Total 5.
+	if mvCount != 5 {
+		t.Errorf("Expected 5 local mv operations (mount+automount units, sleep hook), got %d. Cmds: %v", mvCount, mockLocal.Cmds)
 	}
 }
 
@@ -330,6 +354,36 @@ func TestDeployer_Apply_Idempotent(t *testing.T) {
 	}
 }
 
+func TestDeployer_Apply_WatcherReload(t *testing.T) {
+	mockClient := &MockSSHClient{Files: map[string]string{}, Uploads: map[string]string{}}
+	d := NewDeployerWithDeps(mockClient, &MockBuilder{}, &MockLocalExecutor{Files: make(map[string][]byte)})
+	host := config.HostConfig{Alias: "h1", IdleTimeout: "10m", Mounts: []config.MountConfig{{Local: "/mnt/d", Remote: "/d"}}}
+
+	// installCmd applies host and returns the remote install command,
+	// the uploads becoming the remote files
+	installCmd := func() string {
+		mockClient.Cmds = nil
+		if err := d.Apply(&config.Config{Hosts: []config.HostConfig{host}}, ApplyOptions{}); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		mockClient.Files["/etc/systemd/system/autonfs-watcher.service"] = mockClient.Uploads["/tmp/autonfs-watcher.service"]
+		mockClient.Files["/etc/autonfs/watcher.yaml"] = mockClient.Uploads["/tmp/autonfs-watcher.yaml"]
+		return mockClient.Cmds[len(mockClient.Cmds)-1]
+	}
+
+	if cmd := installCmd(); !strings.Contains(cmd, "systemctl restart autonfs-watcher") {
+		t.Errorf("First apply should start the watcher afresh: %s", cmd)
+	}
+	if cmd := installCmd(); strings.Contains(cmd, "restart autonfs-watcher") || strings.Contains(cmd, "reload autonfs-watcher") {
+		t.Errorf("Unchanged apply should neither restart nor reload: %s", cmd)
+	}
+	// Settings only: SIGHUP keeps the idle countdown
+	host.IdleTimeout = "20m"
+	if cmd := installCmd(); strings.Contains(cmd, "restart autonfs-watcher") || !strings.Contains(cmd, "systemctl reload autonfs-watcher") {
+		t.Errorf("Watcher config change should reload, not restart: %s", cmd)
+	}
+}
+
 func TestDeployer_Apply_DryRun(t *testing.T) {
 	mockClient := &MockSSHClient{
 		DiscoveryInfo: "eth0|192.168.1.100|00:00:00:00:00:00",
@@ -379,3 +433,371 @@ func TestDeployer_Apply_DryRun(t *testing.T) {
 		t.Errorf("Expected 0 systemctl calls in DryRun, got %d: %v", sysCount, mockLocal.Cmds)
 	}
 }
+
+func TestBuildWatcherConfig(t *testing.T) {
+	host := config.HostConfig{
+		Alias:       "h1",
+		IdleTimeout: "15m",
+		ShutdownCmd: "halt -p",
+		Watcher: watcher.WatchConfig{
+			Sources: []string{watcher.SourceNFSv4Clients},
+		},
+	}
+	out, err := buildWatcherConfig(host, ApplyOptions{WatcherDryRun: true})
+	if err != nil {
+		t.Fatalf("buildWatcherConfig failed: %v", err)
+	}
+
+	// Rendered YAML must round-trip through the watcher parser
+	cfg, err := watcher.ParseWatchConfig(out, watcher.WatchConfig{})
+	if err != nil {
+		t.Fatalf("Rendered config does not parse: %v\n%s", err, out)
+	}
+	if cfg.IdleTimeout != 15*time.Minute || cfg.LoadThreshold != 0.5 || !cfg.DryRun || cfg.ShutdownCmd != "halt -p" {
+		t.Errorf("Unexpected watcher config: %+v", cfg)
+	}
+	if len(cfg.Sources) != 1 || cfg.Sources[0] != watcher.SourceNFSv4Clients {
+		t.Errorf("Sources not passed through: %v", cfg.Sources)
+	}
+
+	// A VM stopped by its hypervisor, unless a shutdown command is set explicitly
+	host.Power = power.Config{Backend: power.BackendHypervisor, Hypervisor: &power.HypervisorConfig{
+		Host: "pve", Type: power.HypervisorProxmox, VM: "105", Shutdown: power.ShutdownHypervisor,
+	}}
+	out, _ = buildWatcherConfig(host, ApplyOptions{})
+	if cfg, _ = watcher.ParseWatchConfig(out, watcher.WatchConfig{}); cfg.ShutdownCmd != "halt -p" {
+		t.Errorf("Explicit shutdown_cmd overridden: %q", cfg.ShutdownCmd)
+	}
+	host.ShutdownCmd = ""
+	out, _ = buildWatcherConfig(host, ApplyOptions{})
+	if cfg, _ = watcher.ParseWatchConfig(out, watcher.WatchConfig{}); cfg.ShutdownCmd != "ssh -o BatchMode=yes pve 'qm shutdown 105'" {
+		t.Errorf("Unexpected hypervisor shutdown: %q", cfg.ShutdownCmd)
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	raid := journal.BootProfile{Samples: 12, P95: 140 * time.Second, Max: 150 * time.Second, Suggested: 175 * time.Second}
+	tests := []struct {
+		name      string
+		wake      string
+		mount     string
+		settle    string
+		boots     journal.BootProfile
+		wantWake  time.Duration
+		wantMount time.Duration
+		warnings  int
+	}{
+		{"defaults", "", "", "", journal.BootProfile{}, 120 * time.Second, 150 * time.Second, 0},
+		{"mount follows wake", "90s", "", "", journal.BootProfile{}, 90 * time.Second, 120 * time.Second, 0},
+		{"explicit mount", "90s", "3m", "5s", journal.BootProfile{}, 90 * time.Second, 3 * time.Minute, 0},
+		{"mount not above wake", "90s", "60s", "", journal.BootProfile{}, 90 * time.Second, 60 * time.Second, 1},
+		{"no room for mount", "90s", "95s", "", journal.BootProfile{}, 90 * time.Second, 95 * time.Second, 1},
+		{"settle eats wake", "30s", "", "30s", journal.BootProfile{}, 30 * time.Second, time.Minute, 1},
+		{"below boot times", "90s", "", "", raid, 90 * time.Second, 120 * time.Second, 1},
+		{"above boot times", "3m", "", "", raid, 3 * time.Minute, 210 * time.Second, 0},
+		{"auto learned", "auto", "", "", raid, 175 * time.Second, 205 * time.Second, 0},
+		{"auto unlearned", "auto", "", "", journal.BootProfile{Samples: 1, P95: time.Minute, Max: time.Minute}, 5 * time.Minute, 330 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := config.HostConfig{Alias: "h1", WakeTimeout: tt.wake, MountTimeout: tt.mount, ReadySettle: tt.settle}
+			wake, mount, warnings, err := clientTimeouts(host, tt.boots)
+			if err != nil {
+				t.Fatalf("clientTimeouts failed: %v", err)
+			}
+			if wake != tt.wantWake || mount != tt.wantMount {
+				t.Errorf("Got wake=%s mount=%s, want wake=%s mount=%s", wake, mount, tt.wantWake, tt.wantMount)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("Expected %d warnings, got %v", tt.warnings, warnings)
+			}
+		})
+	}
+
+	if _, _, _, err := clientTimeouts(config.HostConfig{WakeTimeout: "soon"}, journal.BootProfile{}); err == nil {
+		t.Error("Expected error for invalid wake_timeout")
+	}
+}
+
+func TestDeployer_Apply_SecureOn(t *testing.T) {
+	t.Setenv("AUTONFS_TEST_SECUREON", "01:02:03:04:05:06")
+	mockClient := &MockSSHClient{}
+	mockLocal := &MockLocalExecutor{}
+	cfg := &config.Config{
+		Hosts: []config.HostConfig{{
+			Alias:  "nas",
+			Mounts: []config.MountConfig{{Local: "/mnt/data", Remote: "/data"}},
+			WoL:    config.WoLConfig{SecureOnEnv: "AUTONFS_TEST_SECUREON"},
+		}},
+	}
+
+	d := NewDeployerWithDeps(mockClient, &MockBuilder{}, mockLocal)
+	if err := d.Apply(cfg, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	keyFile := SecureOnDir + "/nas.key"
+	if got := string(mockLocal.Files[keyFile]); got != "010203040506\n" {
+		t.Errorf("SecureOn file content = %q", got)
+	}
+	mount := string(mockLocal.Files["/etc/systemd/system/mnt-data.mount"])
+	if !strings.Contains(mount, "--secureon-file "+keyFile) {
+		t.Errorf("Mount unit does not reference the SecureOn file:\n%s", mount)
+	}
+	if strings.Contains(mount, "01:02:03") || strings.Contains(mount, "010203") {
+		t.Errorf("Mount unit leaks the SecureOn password:\n%s", mount)
+	}
+	chowned := false
+	for _, cmd := range mockLocal.Cmds {
+		if cmd == "sudo chown root:root "+keyFile {
+			chowned = true
+		}
+	}
+	if !chowned {
+		t.Errorf("SecureOn file not made root-owned: %v", mockLocal.Cmds)
+	}
+
+	// A missing password source fails before anything is deployed
+	cfg.Hosts[0].WoL = config.WoLConfig{SecureOnEnv: "AUTONFS_TEST_UNSET_VAR"}
+	if err := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, &MockLocalExecutor{}).Apply(cfg, ApplyOptions{}); err == nil {
+		t.Error("Expected error for unset SecureOn variable")
+	}
+}
+
+func TestDeployer_Apply_PowerBackend(t *testing.T) {
+	t.Setenv("AUTONFS_TEST_BMC_PASSWORD", "hunter2")
+	mockLocal := &MockLocalExecutor{}
+	cfg := &config.Config{
+		Hosts: []config.HostConfig{{
+			Alias:  "nas",
+			Mounts: []config.MountConfig{{Local: "/mnt/data", Remote: "/data"}},
+			Power: power.Config{
+				Backend: power.BackendIPMI,
+				IPMI:    &power.IPMIConfig{Host: "192.168.1.60", Username: "admin", Password: power.Secret{Env: "AUTONFS_TEST_BMC_PASSWORD"}},
+			},
+		}},
+	}
+
+	d := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, mockLocal)
+	if err := d.Apply(cfg, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	powerFile := PowerDir + "/nas.yaml"
+	installed := string(mockLocal.Files[powerFile])
+	if !strings.Contains(installed, "value: hunter2") || !strings.Contains(installed, "alias: nas") || strings.Contains(installed, "env:") {
+		t.Errorf("Unexpected power config:\n%s", installed)
+	}
+	mount := string(mockLocal.Files["/etc/systemd/system/mnt-data.mount"])
+	if !strings.Contains(mount, "--power-config "+powerFile) || strings.Contains(mount, "hunter2") {
+		t.Errorf("Mount unit does not reference the power config safely:\n%s", mount)
+	}
+
+	cfg.Hosts[0].Power.IPMI.Password = power.Secret{Env: "AUTONFS_TEST_UNSET_VAR"}
+	if err := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, &MockLocalExecutor{}).Apply(cfg, ApplyOptions{}); err == nil {
+		t.Error("Expected error for unset power secret")
+	}
+}
+
+func TestDeployer_Apply_HostCache(t *testing.T) {
+	mockLocal := &MockLocalExecutor{}
+	host := config.HostConfig{
+		Alias:       "nas",
+		WakeTimeout: "90s",
+		Mounts:      []config.MountConfig{{Local: "/mnt/data", Remote: "/data"}},
+	}
+	d := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, mockLocal)
+	if err := d.Apply(&config.Config{Hosts: []config.HostConfig{host}}, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	path := HostCachePath("nas")
+	var cache HostCache
+	if err := yaml.Unmarshal(mockLocal.Files[path], &cache); err != nil {
+		t.Fatalf("Invalid host cache: %v\n%s", err, mockLocal.Files[path])
+	}
+	if cache.IP != "192.168.1.100" || cache.MAC == "" || cache.Host.WakeTimeout != "90s" || len(cache.Host.Mounts) != 1 {
+		t.Errorf("Unexpected host cache: %+v", cache)
+	}
+	readable := false
+	for _, cmd := range mockLocal.Cmds {
+		if cmd == "sudo chmod 0644 "+path {
+			readable = true
+		}
+	}
+	if !readable {
+		t.Errorf("Host cache not made readable: %v", mockLocal.Cmds)
+	}
+
+	wake, backoff, err := WakeTimeouts(cache.Host, journal.BootProfile{})
+	if err != nil || wake != 90*time.Second || backoff != defaultWakeBackoff {
+		t.Errorf("WakeTimeouts = %v, %v, %v", wake, backoff, err)
+	}
+}
+
+func TestDeployer_Apply_LearnedWakeTimeout(t *testing.T) {
+	var history strings.Builder
+	for _, s := range []int{120, 130, 140} {
+		fmt.Fprintf(&history, `{"event":"wake","host":"raid","ok":true,"duration":%d}`+"\n", s*int(time.Second))
+	}
+	mockLocal := &MockLocalExecutor{Files: map[string][]byte{journal.DefaultClientFile: []byte(history.String())}}
+	host := config.HostConfig{
+		Alias:       "raid",
+		WakeTimeout: config.WakeTimeoutAuto,
+		Mounts:      []config.MountConfig{{Local: "/mnt/data", Remote: "/data"}},
+	}
+	d := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, mockLocal)
+	if err := d.Apply(&config.Config{Hosts: []config.HostConfig{host}}, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// p95 140s + 35s margin
+	mount := string(mockLocal.Files["/etc/systemd/system/mnt-data.mount"])
+	if !strings.Contains(mount, "--timeout 2m55s") || !strings.Contains(mount, "TimeoutSec=205") {
+		t.Errorf("Learned timeout not rendered:\n%s", mount)
+	}
+}
+
+func TestDeployer_Apply_SleepHook(t *testing.T) {
+	mockLocal := &MockLocalExecutor{}
+	cfg := &config.Config{Hosts: []config.HostConfig{
+		{Alias: "nas", Mounts: []config.MountConfig{{Local: "/mnt/data", Remote: "/data"}, {Local: "/mnt/media", Remote: "/media"}}},
+		{Alias: "raid", SleepUnmount: "block", Mounts: []config.MountConfig{{Local: "/mnt/backup", Remote: "/backup"}}},
+		{Alias: "pi", SleepUnmount: "off", Mounts: []config.MountConfig{{Local: "/mnt/pi", Remote: "/pi"}}},
+	}}
+	d := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, mockLocal)
+	if err := d.Apply(cfg, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	unit := string(mockLocal.Files[SleepUnitFile])
+	for _, want := range []string{
+		`sleep-hook pre --lazy "/mnt/data" --lazy "/mnt/media" --block "/mnt/backup"`,
+		"ExecStop=-",
+		"RequiredBy=sleep.target",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("Sleep unit missing %q:\n%s", want, unit)
+		}
+	}
+	// A block mount must be able to cancel the suspend
+	if strings.Contains(unit, "ExecStart=-") || strings.Contains(unit, "/mnt/pi") {
+		t.Errorf("Unexpected sleep unit:\n%s", unit)
+	}
+
+	// Every host off: the hook goes away
+	for i := range cfg.Hosts {
+		cfg.Hosts[i].SleepUnmount = "off"
+	}
+	mockLocal.Cmds = nil
+	if err := d.Apply(cfg, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !strings.Contains(strings.Join(mockLocal.Cmds, "|"), "sudo rm -f "+SleepUnitFile) {
+		t.Errorf("Sleep hook not removed: %v", mockLocal.Cmds)
+	}
+}
+
+func TestDeployer_Apply_StaleCheck(t *testing.T) {
+	mockLocal := &MockLocalExecutor{}
+	cfg := &config.Config{Hosts: []config.HostConfig{
+		{Alias: "nas", StaleCheck: "5m", Mounts: []config.MountConfig{{Local: "/mnt/data", Remote: "/data"}}},
+		{Alias: "raid", StaleCheck: "90s", Mounts: []config.MountConfig{{Local: "/mnt/backup", Remote: "/backup"}}},
+		{Alias: "pi", Mounts: []config.MountConfig{{Local: "/mnt/pi", Remote: "/pi"}}},
+	}}
+	d := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, mockLocal)
+	if err := d.Apply(cfg, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	service := string(mockLocal.Files[StaleServiceFile])
+	if !strings.Contains(service, `stale --recover "/mnt/data" "/mnt/backup"`) || strings.Contains(service, "/mnt/pi") {
+		t.Errorf("Unexpected stale service:\n%s", service)
+	}
+	// Shortest interval wins
+	if timer := string(mockLocal.Files[StaleTimerFile]); !strings.Contains(timer, "OnUnitInactiveSec=90") {
+		t.Errorf("Unexpected stale timer:\n%s", timer)
+	}
+	if !strings.Contains(strings.Join(mockLocal.Cmds, "|"), "sudo systemctl enable --now autonfs-stale.timer") {
+		t.Errorf("Stale timer not enabled: %v", mockLocal.Cmds)
+	}
+}
+
+func TestDeployer_Apply_Agent(t *testing.T) {
+	mockLocal := &MockLocalExecutor{}
+	cfg := &config.Config{Hosts: []config.HostConfig{
+		{Alias: "nas", MountIdle: "30m", MountRelease: "signal", Mounts: []config.MountConfig{{Local: "/mnt/data", Remote: "/data"}}},
+		{Alias: "raid", ClientAgent: true, Mounts: []config.MountConfig{{Local: "/mnt/backup", Remote: "/backup"}}},
+		{Alias: "pi", Mounts: []config.MountConfig{{Local: "/mnt/pi", Remote: "/pi"}}},
+	}}
+	d := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, mockLocal)
+	if err := d.Apply(cfg, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	agentCfg := string(mockLocal.Files["/etc/autonfs/agent.yaml"])
+	for _, want := range []string{"path: /mnt/data", "unit: mnt-data", "idle_timeout: 30m0s", "release: signal"} {
+		if !strings.Contains(agentCfg, want) {
+			t.Errorf("Agent config missing %q:\n%s", want, agentCfg)
+		}
+	}
+	if !strings.Contains(agentCfg, "path: /mnt/backup") || strings.Contains(agentCfg, "/mnt/pi") {
+		t.Errorf("Agent config should hold the agent hosts' mounts only:\n%s", agentCfg)
+	}
+	// Agent hosts wake through the agent, the others directly
+	if mount := string(mockLocal.Files["/etc/systemd/system/mnt-backup.mount"]); !strings.Contains(mount, "--agent /run/autonfs/agent.sock") {
+		t.Errorf("Agent host mount unit does not use the agent:\n%s", mount)
+	}
+	if mount := string(mockLocal.Files["/etc/systemd/system/mnt-pi.mount"]); strings.Contains(mount, "--agent") {
+		t.Errorf("Direct host mount unit uses the agent:\n%s", mount)
+	}
+	if sleep := string(mockLocal.Files[SleepUnitFile]); !strings.Contains(sleep, "sleep-hook pre") || !strings.Contains(sleep, "--agent /run/autonfs/agent.sock") {
+		t.Errorf("Sleep hook does not go through the agent:\n%s", sleep)
+	}
+	if !strings.Contains(string(mockLocal.Files[AgentServiceFile]), "agent --config /etc/autonfs/agent.yaml") {
+		t.Errorf("Unexpected agent service:\n%s", mockLocal.Files[AgentServiceFile])
+	}
+	cmds := strings.Join(mockLocal.Cmds, "|")
+	if !strings.Contains(cmds, "sudo systemctl enable --now autonfs-agent.service") {
+		t.Errorf("Agent not enabled: %v", mockLocal.Cmds)
+	}
+	// Nothing else creates /etc/autonfs on a client
+	if mkdir := strings.Index(cmds, "sudo mkdir -p /etc/autonfs|"); mkdir < 0 || mkdir > strings.Index(cmds, " /etc/autonfs/agent.yaml") {
+		t.Errorf("/etc/autonfs not created before writing the agent config: %v", mockLocal.Cmds)
+	}
+}
+
+func TestDeployer_Apply_Jobs(t *testing.T) {
+	mockLocal := &MockLocalExecutor{}
+	host := config.HostConfig{Alias: "nas", Mounts: []config.MountConfig{{Local: "/mnt/data", Remote: "/data"}}, Jobs: []config.JobConfig{
+		{Name: "backup", Schedule: "*-*-* 02:30", Command: `restic backup "/mnt/data" --tag "$(date +%F)"`, Hold: "30m"},
+		{Name: "check", Schedule: "Sun 04:00", Command: "restic check"},
+	}}
+	d := NewDeployerWithDeps(&MockSSHClient{}, &MockBuilder{}, mockLocal)
+	if err := d.Apply(&config.Config{Hosts: []config.HostConfig{host}}, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	service := string(mockLocal.Files["/etc/systemd/system/autonfs-job-nas-backup.service"])
+	want := `run --hold 30m "nas" -- /bin/sh -c "restic backup \"/mnt/data\" --tag \"$$(date +%%F)\""`
+	if !strings.Contains(service, want) {
+		t.Errorf("Unexpected job service, want %s:\n%s", want, service)
+	}
+	if timer := string(mockLocal.Files["/etc/systemd/system/autonfs-job-nas-check.timer"]); !strings.Contains(timer, "OnCalendar=Sun 04:00") {
+		t.Errorf("Unexpected job timer:\n%s", timer)
+	}
+	if !strings.Contains(strings.Join(mockLocal.Cmds, "|"), "sudo systemctl enable --now autonfs-job-nas-check.timer") {
+		t.Errorf("Job timer not enabled: %v", mockLocal.Cmds)
+	}
+
+	// A job dropped from the config is removed on the next apply
+	host.Jobs = host.Jobs[:1]
+	mockLocal.Cmds = nil
+	if err := d.Apply(&config.Config{Hosts: []config.HostConfig{host}}, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	cmds := strings.Join(mockLocal.Cmds, "|")
+	if !strings.Contains(cmds, "sudo systemctl disable --now autonfs-job-nas-check.timer") || strings.Contains(cmds, "disable --now autonfs-job-nas-backup") {
+		t.Errorf("Dropped job not removed: %v", mockLocal.Cmds)
+	}
+}
@@ -0,0 +1,95 @@
+package deployer
+
+import (
+	"autonfs/internal/config"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HostCacheDir holds what apply learned about each host, for `autonfs wake <alias>`
+const HostCacheDir = "/var/lib/autonfs/hosts"
+
+// HostCache is the discovery result and installed files of the last apply
+type HostCache struct {
+	Alias        string            `yaml:"alias"`
+	IP           string            `yaml:"ip"`
+	MAC          string            `yaml:"mac"`
+	Prefix       int               `yaml:"prefix,omitempty"`
+	Broadcast    string            `yaml:"broadcast,omitempty"`     // Resolved WoL target
+	SecureOnFile string            `yaml:"secureon_file,omitempty"` // Root-only, wake needs sudo to read it
+	PowerConfig  string            `yaml:"power_config,omitempty"`  // Root-only, wake needs sudo to read it
+	Host         config.HostConfig `yaml:"host"`                    // Config the units were rendered from
+}
+
+// HostCachePath returns the cache file of a host
+func HostCachePath(alias string) string {
+	return filepath.Join(HostCacheDir, config.AliasFileName(alias)+".yaml")
+}
+
+// LoadHostCache reads the cache written by the last apply of alias
+func LoadHostCache(alias string) (*HostCache, error) {
+	data, err := os.ReadFile(HostCachePath(alias))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no cached discovery for %s, run `autonfs apply` first", alias)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c HostCache
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid host cache %s: %v", HostCachePath(alias), err)
+	}
+	return &c, nil
+}
+
+// writeHostCache records the cache world-readable: it holds addresses and
+// paths, the secrets themselves stay in their root-only files
+func writeHostCache(executor LocalExecutor, c HostCache, dryRun bool) error {
+	path := HostCachePath(c.Alias)
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if !hasChange(executor, path, content) {
+		return nil
+	}
+	if dryRun {
+		slog.Info("DRY-RUN: Write host cache", "file", path)
+		return nil
+	}
+	if err := executor.RunCommand("sudo", "mkdir", "-p", HostCacheDir); err != nil {
+		return fmt.Errorf("failed to create %s: %v", HostCacheDir, err)
+	}
+	if err := localWrite(executor, path, content); err != nil {
+		return err
+	}
+	if err := executor.RunCommand("sudo", "chmod", "0644", path); err != nil {
+		return fmt.Errorf("failed to chmod %s: %v", path, err)
+	}
+	return nil
+}
+
+// LoadHostCaches reads the caches of every applied host
+func LoadHostCaches() ([]HostCache, error) {
+	paths, err := filepath.Glob(filepath.Join(HostCacheDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var caches []HostCache
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var c HostCache
+		if err := yaml.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("invalid host cache %s: %v", path, err)
+		}
+		caches = append(caches, c)
+	}
+	return caches, nil
+}
@@ -0,0 +1,121 @@
+package deployer
+
+import (
+	"autonfs/internal/config"
+	"autonfs/internal/templates"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JobUnitName returns the unit name of a host's job, without suffix
+func JobUnitName(alias, job string) string {
+	return "autonfs-job-" + config.AliasFileName(alias) + "-" + job
+}
+
+// previousJobs returns the jobs of the last apply of alias, from its host cache
+func previousJobs(executor LocalExecutor, alias string) []config.JobConfig {
+	data, err := executor.ReadFile(HostCachePath(alias))
+	if err != nil {
+		return nil
+	}
+	var c HostCache
+	if yaml.Unmarshal(data, &c) != nil {
+		return nil
+	}
+	return c.Host.Jobs
+}
+
+// applyJobs installs a service and timer per job of host and removes the
+// units of jobs dropped from the config since the previous apply
+func (d *Deployer) applyJobs(host config.HostConfig, previous []config.JobConfig, opts ApplyOptions) error {
+	exe, _ := os.Executable()
+	kept := map[string]bool{}
+	for _, job := range host.Jobs {
+		kept[job.Name] = true
+		tmplCfg := templates.Config{
+			BinaryPath:  exe,
+			Alias:       host.Alias,
+			JobName:     job.Name,
+			JobSchedule: job.Schedule,
+			JobCommand:  systemdQuote(job.Command),
+			JobHold:     job.Hold,
+		}
+		service, err := templates.Render("job-service", templates.ClientJobServiceTmpl, tmplCfg)
+		if err != nil {
+			return err
+		}
+		timer, err := templates.Render("job-timer", templates.ClientJobTimerTmpl, tmplCfg)
+		if err != nil {
+			return err
+		}
+
+		unit := JobUnitName(host.Alias, job.Name)
+		changed := false
+		for _, f := range []struct {
+			path    string
+			content []byte
+		}{{unitPath(unit + ".service"), service}, {unitPath(unit + ".timer"), timer}} {
+			if !hasChange(d.localExec, f.path, f.content) {
+				continue
+			}
+			slog.Info("Updating Job", "job", job.Name, "file", f.path)
+			changed = true
+			if opts.DryRun {
+				slog.Info("DRY-RUN: Write content", "file", f.path)
+				continue
+			}
+			if err := localWrite(d.localExec, f.path, f.content); err != nil {
+				return err
+			}
+		}
+
+		if opts.DryRun {
+			slog.Info("DRY-RUN: Enable --now", "unit", unit+".timer")
+			continue
+		}
+		if changed {
+			d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
+		}
+		if err := d.localExec.RunCommand("sudo", "systemctl", "enable", "--now", unit+".timer"); err != nil {
+			return fmt.Errorf("failed to enable %s.timer: %v", unit, err)
+		}
+		if changed {
+			// Pick up a new schedule
+			d.localExec.RunCommand("sudo", "systemctl", "restart", unit+".timer")
+		}
+	}
+
+	for _, job := range previous {
+		if kept[job.Name] {
+			continue
+		}
+		unit := JobUnitName(host.Alias, job.Name)
+		slog.Info("Removing Job", "job", job.Name, "unit", unit+".timer")
+		if opts.DryRun {
+			slog.Info("DRY-RUN: Disable and remove", "unit", unit+".timer")
+			continue
+		}
+		d.localExec.RunCommand("sudo", "systemctl", "disable", "--now", unit+".timer")
+		if err := d.localExec.RunCommand("sudo", "rm", "-f", unitPath(unit+".timer"), unitPath(unit+".service")); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", unit, err)
+		}
+		d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
+	}
+	return nil
+}
+
+func unitPath(name string) string {
+	return filepath.Join("/etc/systemd/system", name)
+}
+
+// systemdQuote quotes s as a single ExecStart argument: systemd would
+// otherwise expand % specifiers and $ variables itself
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	return `"` + s + `"`
+}
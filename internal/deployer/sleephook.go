@@ -0,0 +1,93 @@
+package deployer
+
+import (
+	"autonfs/internal/agent"
+	"autonfs/internal/config"
+	"autonfs/internal/sleephook"
+	"autonfs/internal/templates"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// SleepUnitFile unmounts the AutoNFS mounts of all hosts around suspend/hibernate
+const SleepUnitFile = "/etc/systemd/system/autonfs-sleep.service"
+
+const sleepUnit = "autonfs-sleep.service"
+
+// MountUnitName returns the name apply gives the mount/automount units of a
+// mount point, without suffix
+func MountUnitName(local string) string {
+	return escapeSystemdPath(local)
+}
+
+// applySleepHook installs the sleep hook for the mounts of every host in cfg,
+// or removes it when no host wants its mounts handled
+func (d *Deployer) applySleepHook(cfg *config.Config, opts ApplyOptions) error {
+	var tmplCfg templates.Config
+	for _, host := range cfg.Hosts {
+		policy := host.SleepUnmount
+		if policy == sleephook.Off {
+			continue
+		}
+		if policy == "" {
+			policy = sleephook.BusyLazy
+		}
+		for _, m := range host.Mounts {
+			tmplCfg.SleepMounts = append(tmplCfg.SleepMounts, templates.SleepMount{Path: m.Local, Policy: policy})
+		}
+		tmplCfg.SleepBlock = tmplCfg.SleepBlock || policy == sleephook.BusyBlock
+		if AgentHost(host) {
+			// The agent must hold its wakes while the client suspends
+			tmplCfg.AgentSocket = agent.DefaultSocket
+		}
+	}
+	if len(tmplCfg.SleepMounts) == 0 {
+		return d.removeSleepHook(opts)
+	}
+
+	exe, _ := os.Executable()
+	tmplCfg.BinaryPath = exe
+	content, err := templates.Render("sleep", templates.ClientSleepTmpl, tmplCfg)
+	if err != nil {
+		return err
+	}
+	if hasChange(d.localExec, SleepUnitFile, content) {
+		slog.Info("Updating Sleep Hook", "file", SleepUnitFile, "mounts", len(tmplCfg.SleepMounts))
+		if opts.DryRun {
+			slog.Info("DRY-RUN: Write content", "file", SleepUnitFile)
+		} else {
+			if err := localWrite(d.localExec, SleepUnitFile, content); err != nil {
+				return err
+			}
+			d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
+		}
+	}
+
+	// Enabling links it into sleep.target.requires, it is never started by hand
+	if opts.DryRun {
+		slog.Info("DRY-RUN: Enable", "unit", sleepUnit)
+		return nil
+	}
+	if err := d.localExec.RunCommand("sudo", "systemctl", "enable", sleepUnit); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", sleepUnit, err)
+	}
+	return nil
+}
+
+func (d *Deployer) removeSleepHook(opts ApplyOptions) error {
+	if _, err := d.localExec.ReadFile(SleepUnitFile); err != nil {
+		return nil
+	}
+	slog.Info("Removing Sleep Hook", "file", SleepUnitFile)
+	if opts.DryRun {
+		slog.Info("DRY-RUN: Disable and remove", "unit", sleepUnit)
+		return nil
+	}
+	d.localExec.RunCommand("sudo", "systemctl", "disable", sleepUnit)
+	if err := d.localExec.RunCommand("sudo", "rm", "-f", SleepUnitFile); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", SleepUnitFile, err)
+	}
+	d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
+	return nil
+}
@@ -0,0 +1,106 @@
+package deployer
+
+import (
+	"autonfs/internal/config"
+	"autonfs/internal/templates"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Stale mount check units, shared by all hosts
+const (
+	StaleServiceFile = "/etc/systemd/system/autonfs-stale.service"
+	StaleTimerFile   = "/etc/systemd/system/autonfs-stale.timer"
+)
+
+const staleTimer = "autonfs-stale.timer"
+
+// applyStaleCheck installs the stale check timer for the mounts of the hosts
+// with stale_check set, running at the shortest interval asked for, or
+// removes it when no host has it
+func (d *Deployer) applyStaleCheck(cfg *config.Config, opts ApplyOptions) error {
+	var tmplCfg templates.Config
+	var interval time.Duration
+	for _, host := range cfg.Hosts {
+		if host.StaleCheck == "" {
+			continue
+		}
+		every, _ := time.ParseDuration(host.StaleCheck) // Validated with the config
+		if interval == 0 || every < interval {
+			interval = every
+		}
+		for _, m := range host.Mounts {
+			tmplCfg.StaleMounts = append(tmplCfg.StaleMounts, m.Local)
+		}
+	}
+	if len(tmplCfg.StaleMounts) == 0 {
+		return d.removeStaleCheck(opts)
+	}
+
+	exe, _ := os.Executable()
+	tmplCfg.BinaryPath = exe
+	tmplCfg.StaleInterval = strconv.Itoa(int(interval.Seconds()))
+	service, err := templates.Render("stale-service", templates.ClientStaleServiceTmpl, tmplCfg)
+	if err != nil {
+		return err
+	}
+	timer, err := templates.Render("stale-timer", templates.ClientStaleTimerTmpl, tmplCfg)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, f := range []struct {
+		path    string
+		content []byte
+	}{{StaleServiceFile, service}, {StaleTimerFile, timer}} {
+		if !hasChange(d.localExec, f.path, f.content) {
+			continue
+		}
+		slog.Info("Updating Stale Check", "file", f.path)
+		changed = true
+		if opts.DryRun {
+			slog.Info("DRY-RUN: Write content", "file", f.path)
+			continue
+		}
+		if err := localWrite(d.localExec, f.path, f.content); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		slog.Info("DRY-RUN: Enable --now", "unit", staleTimer)
+		return nil
+	}
+	if changed {
+		d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
+	}
+	if err := d.localExec.RunCommand("sudo", "systemctl", "enable", "--now", staleTimer); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", staleTimer, err)
+	}
+	if changed {
+		// Pick up a new interval
+		d.localExec.RunCommand("sudo", "systemctl", "restart", staleTimer)
+	}
+	return nil
+}
+
+func (d *Deployer) removeStaleCheck(opts ApplyOptions) error {
+	if _, err := d.localExec.ReadFile(StaleTimerFile); err != nil {
+		return nil
+	}
+	slog.Info("Removing Stale Check", "file", StaleTimerFile)
+	if opts.DryRun {
+		slog.Info("DRY-RUN: Disable and remove", "unit", staleTimer)
+		return nil
+	}
+	d.localExec.RunCommand("sudo", "systemctl", "disable", "--now", staleTimer)
+	if err := d.localExec.RunCommand("sudo", "rm", "-f", StaleTimerFile, StaleServiceFile); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", StaleTimerFile, err)
+	}
+	d.localExec.RunCommand("sudo", "systemctl", "daemon-reload")
+	return nil
+}
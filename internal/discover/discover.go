@@ -2,6 +2,7 @@ package discover
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +14,7 @@ type ServerInfo struct {
 	Interface string
 	IP        string
 	MAC       string
+	Prefix    int // Netmask length of IP, 0 if unknown
 }
 
 // SSHClient abstract the required SSH operations for discovery
@@ -93,9 +95,31 @@ func Probe(client SSHClient) (*ServerInfo, error) {
 	info.IP = ip
 	info.MAC = mac
 
+	// 4. Netmask, for the subnet-directed WoL broadcast. Optional.
+	addrOut, err := client.RunCommand(fmt.Sprintf("ip -o -4 addr show dev %s 2>/dev/null", iface))
+	if err == nil {
+		info.Prefix = parsePrefix(addrOut, ip)
+	}
+
 	return info, nil
 }
 
+// parsePrefix finds the prefix length of ip in `ip -o -4 addr` output
+func parsePrefix(raw, ip string) int {
+	for _, field := range strings.Fields(raw) {
+		addr, bits, ok := strings.Cut(field, "/")
+		if !ok || addr != ip {
+			continue
+		}
+		n, err := strconv.Atoi(bits)
+		if err != nil || n < 0 || n > 32 {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
 // parseNetworkInfo parses string in "iface|ip|mac" format
 func parseNetworkInfo(raw string) (string, string, string, error) {
 	parts := strings.Split(strings.TrimSpace(raw), "|")
@@ -65,3 +65,24 @@ func TestParseNetworkInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePrefix(t *testing.T) {
+	raw := "2: eth0    inet 192.168.1.50/24 brd 192.168.1.255 scope global eth0\\       valid_lft forever preferred_lft forever\n" +
+		"2: eth0    inet 10.0.0.5/8 scope global secondary eth0\n"
+	tests := []struct {
+		ip   string
+		want int
+	}{
+		{"192.168.1.50", 24},
+		{"10.0.0.5", 8},
+		{"172.16.0.1", 0},
+	}
+	for _, tt := range tests {
+		if got := parsePrefix(raw, tt.ip); got != tt.want {
+			t.Errorf("parsePrefix(%s) = %d, want %d", tt.ip, got, tt.want)
+		}
+	}
+	if got := parsePrefix("", "192.168.1.50"); got != 0 {
+		t.Errorf("parsePrefix on empty output = %d, want 0", got)
+	}
+}
@@ -0,0 +1,70 @@
+package journal
+
+import (
+	"sort"
+	"time"
+)
+
+// Boot time learning
+const (
+	MinBootSamples  = 3                // Wakes needed before a timeout is suggested
+	maxBootSamples  = 50               // Only recent wakes count, boot times change with updates and disks
+	bootMarginRatio = 0.25             // Suggested timeout: p95 plus this share of it...
+	minBootMargin   = 20 * time.Second // ...but at least this much
+
+	// MaxTimedOutBoot is the longest boot a timed-out wake counts as. A dead
+	// host times out on every wake and must not grow the timeout forever.
+	MaxTimedOutBoot = 5 * time.Minute
+)
+
+// BootProfile summarizes the measured time-to-ready of the recent wakes of a host
+type BootProfile struct {
+	Samples   int           `json:"samples"`
+	P95       time.Duration `json:"p95"`
+	Max       time.Duration `json:"max"`
+	Suggested time.Duration `json:"suggested_timeout,omitempty"` // Zero with fewer than MinBootSamples
+}
+
+// Boots builds the boot profile of host from the client journal. Only wakes
+// that actually booted the server count: failed, shared and already-up
+// wakes did not measure a boot. A timed-out wake counts with its duration,
+// up to MaxTimedOutBoot: the boot took at least that long, so a learned
+// timeout can grow again, but not past what one more boot could need.
+func Boots(entries []Entry, host string) BootProfile {
+	var samples []time.Duration
+	for _, e := range entries {
+		if e.Event != EventWake || e.Host != host || e.Shared || e.AlreadyUp || e.Duration <= 0 {
+			continue
+		}
+		switch {
+		case e.OK:
+			samples = append(samples, e.Duration)
+		case e.TimedOut:
+			samples = append(samples, min(e.Duration, MaxTimedOutBoot))
+		}
+	}
+	if len(samples) > maxBootSamples {
+		samples = samples[len(samples)-maxBootSamples:]
+	}
+	p := BootProfile{Samples: len(samples)}
+	if p.Samples == 0 {
+		return p
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	p.Max = samples[len(samples)-1]
+	// Nearest rank
+	rank := (95*len(samples) + 99) / 100
+	p.P95 = samples[rank-1]
+	if p.Samples >= MinBootSamples {
+		margin := time.Duration(float64(p.P95) * bootMarginRatio)
+		if margin < minBootMargin {
+			margin = minBootMargin
+		}
+		p.Suggested = roundUp(p.P95+margin, 5*time.Second)
+	}
+	return p
+}
+
+func roundUp(d, step time.Duration) time.Duration {
+	return (d + step - 1) / step * step
+}
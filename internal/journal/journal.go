@@ -0,0 +1,88 @@
+// Package journal records wakes on the client and boots/shutdowns on the
+// server as append-only JSON lines, and turns them into daily statistics.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Journal files
+const (
+	DefaultClientFile = "/var/lib/autonfs/wake-journal.jsonl" // Written by `wake`
+	DefaultServerFile = "/var/lib/autonfs/journal.jsonl"      // Written by the watcher
+)
+
+// Event types
+const (
+	EventWake     = "wake"
+	EventBoot     = "boot"
+	EventShutdown = "shutdown"
+)
+
+// Entry is one journal line
+type Entry struct {
+	Time      time.Time     `json:"time"`
+	Event     string        `json:"event"`
+	Host      string        `json:"host,omitempty"`
+	Mount     string        `json:"mount,omitempty"`      // Wake: mount point that triggered it
+	Unit      string        `json:"unit,omitempty"`       // Wake: mount unit
+	Duration  time.Duration `json:"duration,omitempty"`   // Wake: time to ready
+	OK        bool          `json:"ok"`                   // Wake: server ready in time
+	AlreadyUp bool          `json:"already_up,omitempty"` // Wake: server was running already
+	Shared    bool          `json:"shared,omitempty"`     // Wake: result of a concurrent wake
+	TimedOut  bool          `json:"timed_out,omitempty"`  // Wake: not ready within the wake timeout
+	Error     string        `json:"error,omitempty"`
+	Reason    string        `json:"reason,omitempty"` // Shutdown: why
+}
+
+// Append adds e to the journal at path. Lines are written with a single
+// write on an O_APPEND file, so concurrent writers do not interleave.
+func Append(path string, e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Read parses journal lines, skipping lines it cannot parse (e.g. a line
+// cut short by a power loss)
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// ReadFile reads a journal file, a missing file is an empty journal
+func ReadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
@@ -0,0 +1,141 @@
+package journal
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "journal.jsonl")
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	if err := Append(path, Entry{Time: now, Event: EventWake, Host: "nas", OK: true, Duration: 42 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	// A line cut short by a power loss
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"time":"2026-03-01T11:00`)
+	f.Close()
+	if err := Append(path, Entry{Time: now.Add(time.Hour), Event: EventShutdown, Reason: "idle"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The cut line swallows the newline-less next write as one bad line
+	if len(entries) != 1 || entries[0].Duration != 42*time.Second || entries[0].Host != "nas" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+
+	if entries, err := ReadFile(filepath.Join(t.TempDir(), "missing")); err != nil || entries != nil {
+		t.Errorf("missing journal: %v, %v", entries, err)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 3, day, hour, min, 0, 0, time.UTC)
+	}
+	client := []Entry{
+		{Time: at(1, 9, 0), Event: EventWake, Host: "nas", OK: true, Duration: 40 * time.Second},
+		{Time: at(1, 9, 0), Event: EventWake, Host: "nas", OK: true, Duration: 40 * time.Second, Shared: true},
+		{Time: at(1, 20, 0), Event: EventWake, Host: "nas", OK: true, Duration: 80 * time.Second},
+		{Time: at(1, 21, 0), Event: EventWake, Host: "nas", OK: true, AlreadyUp: true},
+		{Time: at(2, 8, 0), Event: EventWake, Host: "nas", OK: false, Error: "timeout"},
+		{Time: at(2, 8, 0), Event: EventWake, Host: "pi", OK: true, Duration: 20 * time.Second},
+	}
+	server := []Entry{
+		{Time: at(1, 9, 0), Event: EventBoot},
+		{Time: at(1, 12, 0), Event: EventShutdown},
+		{Time: at(1, 20, 0), Event: EventBoot},
+		{Time: at(2, 2, 0), Event: EventShutdown},
+	}
+	energy := Energy{IdleWatts: 40, ActiveWatts: 100, OffWatts: 2}
+	st := Compute("nas", client, server, energy, 2, at(2, 12, 0))
+
+	if !st.UptimeKnown || len(st.Days) != 2 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	d1, d2 := st.Days[0], st.Days[1]
+	if d1.Date != "2026-03-01" || d1.Wakes != 2 || d1.AvgBoot != time.Minute {
+		t.Errorf("day 1 wakes: %+v", d1)
+	}
+	// Up 9-12 and 20-24, down 12-20; nothing known before the first boot
+	if d1.Up != 7*time.Hour || d1.Down != 8*time.Hour {
+		t.Errorf("day 1 up %s down %s", d1.Up, d1.Down)
+	}
+	if d2.Up != 2*time.Hour || d2.Down != 10*time.Hour || d2.FailedWakes != 1 || d2.Wakes != 0 {
+		t.Errorf("day 2: %+v", d2)
+	}
+	// 8h * 38W - 2 wakes * 1min * 60W = 304Wh - 2Wh
+	if math.Abs(d1.SavedKWh-0.302) > 1e-9 {
+		t.Errorf("day 1 saved %.4f kWh", d1.SavedKWh)
+	}
+	if st.Total.Wakes != 2 || st.Total.Down != 18*time.Hour || st.Total.AvgBoot != time.Minute {
+		t.Errorf("totals %+v", st.Total)
+	}
+
+	if st := Compute("nas", client, nil, energy, 2, at(2, 12, 0)); st.UptimeKnown || st.Total.SavedKWh != 0 {
+		t.Errorf("without server journal uptime is unknown: %+v", st)
+	}
+}
+
+func TestBoots(t *testing.T) {
+	var entries []Entry
+	for _, s := range []int{130, 140, 120, 135, 150} {
+		entries = append(entries, Entry{Event: EventWake, Host: "raid", OK: true, Duration: time.Duration(s) * time.Second})
+	}
+	entries = append(entries,
+		Entry{Event: EventWake, Host: "raid", OK: true, Duration: 2 * time.Second, AlreadyUp: true},
+		Entry{Event: EventWake, Host: "raid", OK: true, Duration: 10 * time.Second, Shared: true},
+		Entry{Event: EventWake, Host: "raid", OK: false, Duration: 300 * time.Second},
+		Entry{Event: EventWake, Host: "pi", OK: true, Duration: 20 * time.Second},
+	)
+
+	p := Boots(entries, "raid")
+	// 150s + 25% = 187.5s, rounded up to 190s
+	if p.Samples != 5 || p.P95 != 150*time.Second || p.Max != 150*time.Second || p.Suggested != 190*time.Second {
+		t.Errorf("raid profile %+v", p)
+	}
+	// Too few wakes to suggest anything
+	if p := Boots(entries, "pi"); p.Samples != 1 || p.P95 != 20*time.Second || p.Suggested != 0 {
+		t.Errorf("pi profile %+v", p)
+	}
+
+	var fast []Entry
+	for i := 0; i < 20; i++ {
+		fast = append(fast, Entry{Event: EventWake, Host: "pi", OK: true, Duration: time.Duration(18+i%3) * time.Second})
+	}
+	// Short boots get the minimum margin
+	if p := Boots(fast, "pi"); p.P95 != 20*time.Second || p.Suggested != 40*time.Second {
+		t.Errorf("fast profile %+v", p)
+	}
+
+	// After a disk upgrade the learned 40s no longer suffices: the timeouts
+	// count as boots of at least 40s and raise the suggestion
+	slow := append(fast[len(fast)-3:],
+		Entry{Event: EventWake, Host: "pi", OK: false, TimedOut: true, Duration: 40 * time.Second},
+		Entry{Event: EventWake, Host: "pi", OK: false, TimedOut: true, Duration: 40 * time.Second},
+	)
+	if p := Boots(slow, "pi"); p.Samples != 5 || p.Max != 40*time.Second || p.Suggested != 60*time.Second {
+		t.Errorf("profile after timeouts %+v", p)
+	}
+
+	// An unplugged host times out with whatever was suggested last: the
+	// suggestion grows up to a limit and then stays there
+	var dead []Entry
+	timeout, last := 60*time.Second, time.Duration(0)
+	for i := 0; i < 30 && timeout != last; i++ {
+		dead = append(dead, Entry{Event: EventWake, Host: "dead", TimedOut: true, Duration: timeout})
+		if p := Boots(dead, "dead"); p.Suggested > 0 {
+			last, timeout = timeout, p.Suggested
+		}
+	}
+	if timeout != last || timeout != 375*time.Second {
+		t.Errorf("Timeouts of a dead host should settle at 375s, got %s after %d wakes", timeout, len(dead))
+	}
+}
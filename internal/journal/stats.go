@@ -0,0 +1,156 @@
+package journal
+
+import (
+	"sort"
+	"time"
+)
+
+// Energy holds the power draw of a server, used to estimate savings
+type Energy struct {
+	IdleWatts   float64 `yaml:"idle_watts,omitempty"`   // Running, nothing to do
+	ActiveWatts float64 `yaml:"active_watts,omitempty"` // Booting or busy
+	OffWatts    float64 `yaml:"off_watts,omitempty"`    // Powered off (WoL standby)
+}
+
+// DayStats summarizes one local calendar day, or all of them for totals
+type DayStats struct {
+	Date        string        `json:"date"`
+	Up          time.Duration `json:"up"`
+	Down        time.Duration `json:"down"`
+	Wakes       int           `json:"wakes"`
+	FailedWakes int           `json:"failed_wakes"`
+	AvgBoot     time.Duration `json:"avg_boot"`
+	SavedKWh    float64       `json:"saved_kwh"`
+
+	bootSum time.Duration
+}
+
+// Stats are the statistics of one host
+type Stats struct {
+	Host        string      `json:"host"`
+	UptimeKnown bool        `json:"uptime_known"` // Server journal available
+	Days        []DayStats  `json:"days"`
+	Total       DayStats    `json:"total"`
+	Boot        BootProfile `json:"boot"` // Recent wakes, not limited to the days shown
+}
+
+// Compute merges the client wakes and server boots/shutdowns of host into
+// daily statistics for the days days up to now.
+//
+// Savings assume the server would otherwise have idled all the time it was
+// off, minus the extra draw while booting on each wake.
+func Compute(host string, client, server []Entry, energy Energy, days int, now time.Time) Stats {
+	if days < 1 {
+		days = 1
+	}
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	first := today.AddDate(0, 0, -(days - 1))
+
+	st := Stats{Host: host, Total: DayStats{Date: "total"}}
+	index := map[string]int{}
+	for i := 0; i < days; i++ {
+		date := first.AddDate(0, 0, i).Format(time.DateOnly)
+		index[date] = i
+		st.Days = append(st.Days, DayStats{Date: date})
+	}
+	day := func(t time.Time) *DayStats {
+		if i, ok := index[t.In(now.Location()).Format(time.DateOnly)]; ok {
+			return &st.Days[i]
+		}
+		return nil
+	}
+
+	for _, e := range client {
+		if e.Event != EventWake || e.Host != host || e.Shared || e.AlreadyUp {
+			continue
+		}
+		ds := day(e.Time)
+		if ds == nil {
+			continue
+		}
+		if e.OK {
+			ds.Wakes++
+			ds.bootSum += e.Duration
+		} else {
+			ds.FailedWakes++
+		}
+	}
+
+	st.Boot = Boots(client, host)
+	st.UptimeKnown = addUptime(st.Days, server, first, now)
+
+	for i := range st.Days {
+		ds := &st.Days[i]
+		if ds.Wakes > 0 {
+			ds.AvgBoot = ds.bootSum / time.Duration(ds.Wakes)
+		}
+		if st.UptimeKnown {
+			ds.SavedKWh = savedKWh(energy, ds.Down, ds.Wakes, ds.AvgBoot)
+		}
+		st.Total.Up += ds.Up
+		st.Total.Down += ds.Down
+		st.Total.Wakes += ds.Wakes
+		st.Total.FailedWakes += ds.FailedWakes
+		st.Total.bootSum += ds.bootSum
+		st.Total.SavedKWh += ds.SavedKWh
+	}
+	if st.Total.Wakes > 0 {
+		st.Total.AvgBoot = st.Total.bootSum / time.Duration(st.Total.Wakes)
+	}
+	return st
+}
+
+// addUptime splits the up/down periods from the server journal into days.
+// Time before the first boot or shutdown on record is left unaccounted.
+func addUptime(days []DayStats, server []Entry, first, now time.Time) bool {
+	var events []Entry
+	for _, e := range server {
+		if e.Event == EventBoot || e.Event == EventShutdown {
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		return false
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	for i, e := range events {
+		end := now
+		if i+1 < len(events) {
+			end = events[i+1].Time
+		}
+		up := e.Event == EventBoot
+		// Split [e.Time, end) at midnights
+		start := e.Time
+		if start.Before(first) {
+			start = first
+		}
+		for start.Before(end) {
+			y, m, d := start.In(now.Location()).Date()
+			dayStart := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+			next := dayStart.AddDate(0, 0, 1)
+			stop := end
+			if next.Before(stop) {
+				stop = next
+			}
+			if idx := int(dayStart.Sub(first).Hours()/24 + 0.5); idx >= 0 && idx < len(days) {
+				if up {
+					days[idx].Up += stop.Sub(start)
+				} else {
+					days[idx].Down += stop.Sub(start)
+				}
+			}
+			start = stop
+		}
+	}
+	return true
+}
+
+func savedKWh(e Energy, down time.Duration, wakes int, avgBoot time.Duration) float64 {
+	saved := down.Hours() * (e.IdleWatts - e.OffWatts)
+	if e.ActiveWatts > e.IdleWatts {
+		saved -= float64(wakes) * avgBoot.Hours() * (e.ActiveWatts - e.IdleWatts)
+	}
+	return saved / 1000
+}
@@ -0,0 +1,72 @@
+// Package mountinfo reads the NFS mounts of the client from
+// /proc/self/mountinfo
+package mountinfo
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultFile is the mount table of the calling process' namespace
+const DefaultFile = "/proc/self/mountinfo"
+
+// Mount is one NFS mount
+type Mount struct {
+	Point  string // Mount point
+	FSType string // nfs or nfs4
+	Source string // server:/export
+}
+
+// Server returns the host part of the mount source
+func (m Mount) Server() string {
+	host, _, _ := strings.Cut(m.Source, ":/")
+	return strings.Trim(host, "[]")
+}
+
+// NFSMounts returns the NFS mounts in a mountinfo file by mount point.
+// The autofs trigger of an automount is not an NFS mount: a point is only
+// listed while the file system is actually mounted.
+func NFSMounts(path string) (map[string]Mount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mounts := map[string]Mount{}
+	for _, line := range strings.Split(string(data), "\n") {
+		// 36 35 0:42 / /mnt/data rw,relatime shared:1 - nfs4 nas:/data rw,...
+		pre, post, ok := strings.Cut(line, " - ")
+		if !ok {
+			continue
+		}
+		fields, fs := strings.Fields(pre), strings.Fields(post)
+		if len(fields) < 5 || len(fs) < 2 {
+			continue
+		}
+		if fs[0] == "nfs" || fs[0] == "nfs4" {
+			point := unescape(fields[4])
+			mounts[point] = Mount{Point: point, FSType: fs[0], Source: unescape(fs[1])}
+		}
+	}
+	return mounts, nil
+}
+
+// unescape decodes the octal escapes (\040 for space...) of mountinfo
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			var c int
+			if _, err := fmt.Sscanf(s[i+1:i+4], "%03o", &c); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
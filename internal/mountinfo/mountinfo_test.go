@@ -0,0 +1,64 @@
+package mountinfo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNFSMounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	os.WriteFile(path, []byte(`22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+40 22 0:35 / /mnt/data rw,relatime shared:20 - autofs systemd-1 rw,fd=40
+41 40 0:42 / /mnt/data rw,relatime shared:21 - nfs4 192.168.1.100:/data rw,vers=4.2
+42 22 0:36 / /mnt/my\040media rw,relatime shared:22 - autofs systemd-1 rw,fd=41
+44 22 0:37 / /mnt/backup rw,relatime shared:24 - nfs [fd00::5]:/backup rw
+`), 0644)
+
+	mounts, err := NFSMounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 2 {
+		t.Fatalf("mounts %+v", mounts)
+	}
+	if m := mounts["/mnt/data"]; m.FSType != "nfs4" || m.Server() != "192.168.1.100" {
+		t.Errorf("data mount %+v, server %q", m, m.Server())
+	}
+	if m := mounts["/mnt/backup"]; m.Server() != "fd00::5" {
+		t.Errorf("backup server %q", m.Server())
+	}
+	if unescape(`/mnt/my\040media`) != "/mnt/my media" {
+		t.Error("octal escape not decoded")
+	}
+}
+
+func TestOpCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mountstats")
+	os.WriteFile(path, []byte(`device /dev/sda1 mounted on / with fstype ext4
+device systemd-1 mounted on /mnt/data with fstype autofs
+device 192.168.1.100:/data mounted on /mnt/data with fstype nfs4 statvers=1.1
+	opts:	rw,vers=4.2,rsize=1048576
+	events:	52 1130 0 0 41 14 1244 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0
+	RPC iostats version: 1.1  p/v: 100003/4 (nfs)
+	xprt:	tcp 0 1 2 0 12 3454 3454 0 3454 0 2 0 0
+	per-op statistics
+	        NULL: 1 1 0 44 24 0 0 0 0
+	        READ: 10 10 0 1840 10485760 0 52 60 0
+	     GETATTR: 25 25 0 4100 6200 0 30 35 0
+	    SEQUENCE: 300 300 0 30000 24000 0 400 410 0
+
+device 192.168.1.100:/media mounted on /mnt/my\040media with fstype nfs statvers=1.1
+	per-op statistics
+	        NULL: 0 0 0 0 0 0 0 0 0
+`), 0644)
+
+	counts, err := OpCounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SEQUENCE and NULL are the client's own keep-alives
+	if len(counts) != 2 || counts["/mnt/data"] != 35 || counts["/mnt/my media"] != 0 {
+		t.Errorf("counts %v", counts)
+	}
+}
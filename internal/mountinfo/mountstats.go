@@ -0,0 +1,75 @@
+package mountinfo
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultStatsFile holds the per-mount NFS RPC counters
+const DefaultStatsFile = "/proc/self/mountstats"
+
+// backgroundOps are sent by the NFS client on its own, to keep the lease
+// and session alive, and do not count as use of the mount
+var backgroundOps = map[string]bool{
+	"NULL":                 true,
+	"RENEW":                true,
+	"SEQUENCE":             true,
+	"TEST_STATEID":         true,
+	"FREE_STATEID":         true,
+	"BIND_CONN_TO_SESSION": true,
+}
+
+// OpCounts returns the number of RPC operations issued on each NFS mount,
+// by mount point, not counting lease/session keep-alives. The counters only
+// grow while the mount exists; a remount starts over.
+func OpCounts(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counts := map[string]uint64{}
+	var current string // Mount point of the NFS device being read, "" for others
+	inOps := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		// device 192.168.1.100:/data mounted on /mnt/data with fstype nfs4 statvers=1.1
+		if strings.HasPrefix(line, "device ") {
+			current, inOps = "", false
+			fields := strings.Fields(line)
+			if len(fields) >= 8 && fields[2] == "mounted" && fields[5] == "with" && (fields[7] == "nfs" || fields[7] == "nfs4") {
+				current = unescape(fields[4])
+				counts[current] += 0
+			}
+			continue
+		}
+		if current == "" {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "per-op statistics" {
+			inOps = true
+			continue
+		}
+		if !inOps {
+			continue
+		}
+		// READ: 10 10 0 1200 ... (operations first)
+		name, rest, ok := strings.Cut(trimmed, ":")
+		if !ok || backgroundOps[name] {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			counts[current] += n
+		}
+	}
+	return counts, sc.Err()
+}
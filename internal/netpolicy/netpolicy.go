@@ -0,0 +1,241 @@
+// Package netpolicy decides whether waking a server makes sense from where
+// the client currently is: a laptop away from home should not broadcast
+// magic packets and then wait minutes for a server it cannot reach.
+package netpolicy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Policy lists the conditions under which a wake is attempted. Location
+// conditions (subnets, gateway MACs, reachable addresses) are alternatives:
+// when any is configured, at least one must match. NoBattery applies on top.
+type Policy struct {
+	Subnets     []string `yaml:"subnets,omitempty"`      // Client must have an address in one of these CIDRs
+	GatewayMACs []string `yaml:"gateway_macs,omitempty"` // MAC of the default gateway, from /proc/net/arp
+	Reachable   []string `yaml:"reachable,omitempty"`    // host:port that must accept TCP connections
+	NoBattery   bool     `yaml:"no_battery,omitempty"`   // Do not wake while running on battery
+}
+
+// DialTimeout bounds each reachability pre-check
+const DialTimeout = time.Second
+
+// Env gives access to the client's network and power state, replaced in tests
+type Env struct {
+	Addrs      func() ([]net.IP, error)
+	GatewayMAC func() (string, error)
+	Dial       func(addr string) error
+	OnBattery  func() (bool, error)
+}
+
+// SystemEnv reads the state of this machine
+func SystemEnv() Env {
+	return Env{
+		Addrs: interfaceAddrs,
+		GatewayMAC: func() (string, error) {
+			return gatewayMAC("/proc/net/route", "/proc/net/arp")
+		},
+		Dial: func(addr string) error {
+			conn, err := net.DialTimeout("tcp", addr, DialTimeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+		OnBattery: func() (bool, error) {
+			return onBattery("/sys/class/power_supply")
+		},
+	}
+}
+
+// Validate checks the policy syntax
+func (p Policy) Validate() error {
+	for _, s := range p.Subnets {
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			return fmt.Errorf("invalid subnet %q: %v", s, err)
+		}
+	}
+	for _, m := range p.GatewayMACs {
+		if _, err := net.ParseMAC(m); err != nil {
+			return fmt.Errorf("invalid gateway mac %q: %v", m, err)
+		}
+	}
+	for _, r := range p.Reachable {
+		// Rendered into the mount unit command line
+		if _, _, err := net.SplitHostPort(r); err != nil || strings.ContainsAny(r, " \t\"'\\") {
+			return fmt.Errorf("invalid reachable %q, want host:port", r)
+		}
+	}
+	return nil
+}
+
+// Empty reports whether the policy allows every wake
+func (p Policy) Empty() bool {
+	return len(p.Subnets) == 0 && len(p.GatewayMACs) == 0 && len(p.Reachable) == 0 && !p.NoBattery
+}
+
+// Check returns nil if a wake is allowed, otherwise an error explaining
+// which conditions did not match
+func (p Policy) Check(env Env) error {
+	if p.NoBattery {
+		// Unknown power state counts as mains: desktops have no power_supply entries
+		if on, err := env.OnBattery(); err == nil && on {
+			return fmt.Errorf("running on battery (no_battery is set)")
+		}
+	}
+	if len(p.Subnets) == 0 && len(p.GatewayMACs) == 0 && len(p.Reachable) == 0 {
+		return nil
+	}
+
+	var reasons []string
+	if len(p.Subnets) > 0 {
+		ok, why := p.checkSubnets(env)
+		if ok {
+			return nil
+		}
+		reasons = append(reasons, why)
+	}
+	if len(p.GatewayMACs) > 0 {
+		ok, why := p.checkGateway(env)
+		if ok {
+			return nil
+		}
+		reasons = append(reasons, why)
+	}
+	for _, addr := range p.Reachable {
+		if err := env.Dial(addr); err == nil {
+			return nil
+		}
+		reasons = append(reasons, addr+" not reachable")
+	}
+	return fmt.Errorf("not on the server's network: %s", strings.Join(reasons, "; "))
+}
+
+func (p Policy) checkSubnets(env Env) (bool, string) {
+	addrs, err := env.Addrs()
+	if err != nil {
+		return false, fmt.Sprintf("cannot list addresses: %v", err)
+	}
+	for _, s := range p.Subnets {
+		_, subnet, _ := net.ParseCIDR(s)
+		for _, ip := range addrs {
+			if subnet.Contains(ip) {
+				return true, ""
+			}
+		}
+	}
+	return false, fmt.Sprintf("no address in %s", strings.Join(p.Subnets, ", "))
+}
+
+func (p Policy) checkGateway(env Env) (bool, string) {
+	mac, err := env.GatewayMAC()
+	if err != nil {
+		return false, fmt.Sprintf("gateway unknown: %v", err)
+	}
+	got, _ := net.ParseMAC(mac)
+	for _, m := range p.GatewayMACs {
+		want, _ := net.ParseMAC(m)
+		if got.String() == want.String() {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("gateway is %s", mac)
+}
+
+func interfaceAddrs() ([]net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	return ips, nil
+}
+
+// gatewayMAC looks up the IPv4 default gateway in the routing table and
+// returns its MAC from the ARP cache
+func gatewayMAC(routeFile, arpFile string) (string, error) {
+	gw, err := defaultGateway(routeFile)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(arpFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // Header
+	for sc.Scan() {
+		// IP address, HW type, Flags, HW address, Mask, Device
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 4 && fields[0] == gw.String() && fields[3] != "00:00:00:00:00:00" {
+			return fields[3], nil
+		}
+	}
+	return "", fmt.Errorf("gateway %s not in the ARP cache", gw)
+}
+
+func defaultGateway(routeFile string) (net.IP, error) {
+	f, err := os.Open(routeFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // Header
+	for sc.Scan() {
+		// Iface, Destination, Gateway, ... as little-endian hex
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		return ip, nil
+	}
+	return nil, fmt.Errorf("no default route")
+}
+
+// onBattery reports whether the machine has a discharging battery and no
+// online external supply
+func onBattery(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	discharging := false
+	for _, e := range entries {
+		read := func(name string) string {
+			data, _ := os.ReadFile(filepath.Join(dir, e.Name(), name))
+			return strings.TrimSpace(string(data))
+		}
+		switch read("type") {
+		case "Battery":
+			if read("status") == "Discharging" {
+				discharging = true
+			}
+		case "Mains", "USB", "USB_C", "USB_PD":
+			if read("online") == "1" {
+				return false, nil
+			}
+		}
+	}
+	return discharging, nil
+}
@@ -0,0 +1,130 @@
+package netpolicy
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fakeEnv(ip, gwMAC string, reachable map[string]bool, battery bool) Env {
+	return Env{
+		Addrs: func() ([]net.IP, error) {
+			return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP(ip)}, nil
+		},
+		GatewayMAC: func() (string, error) {
+			if gwMAC == "" {
+				return "", errors.New("no default route")
+			}
+			return gwMAC, nil
+		},
+		Dial: func(addr string) error {
+			if reachable[addr] {
+				return nil
+			}
+			return errors.New("timeout")
+		},
+		OnBattery: func() (bool, error) { return battery, nil },
+	}
+}
+
+func TestCheck(t *testing.T) {
+	home := Policy{
+		Subnets:     []string{"192.168.1.0/24"},
+		GatewayMACs: []string{"AA:BB:CC:00:11:22"},
+		Reachable:   []string{"192.168.1.50:2049"},
+	}
+	tests := []struct {
+		name    string
+		policy  Policy
+		env     Env
+		wantErr string
+	}{
+		{"empty policy", Policy{}, fakeEnv("10.0.0.5", "", nil, true), ""},
+		{"home subnet", home, fakeEnv("192.168.1.20", "", nil, false), ""},
+		{"home gateway", home, fakeEnv("10.8.0.2", "aa:bb:cc:00:11:22", nil, false), ""},
+		{"vpn reachable", home, fakeEnv("10.8.0.2", "", map[string]bool{"192.168.1.50:2049": true}, false), ""},
+		{"away", home, fakeEnv("172.20.10.3", "de:ad:be:ef:00:01", nil, false),
+			"no address in 192.168.1.0/24; gateway is de:ad:be:ef:00:01; 192.168.1.50:2049 not reachable"},
+		{"battery", Policy{NoBattery: true}, fakeEnv("192.168.1.20", "", nil, true), "battery"},
+		{"battery at home", Policy{Subnets: home.Subnets, NoBattery: true}, fakeEnv("192.168.1.20", "", nil, true), "battery"},
+		{"mains", Policy{NoBattery: true}, fakeEnv("192.168.1.20", "", nil, false), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.env)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("want error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, p := range []Policy{
+		{Subnets: []string{"192.168.1.0"}},
+		{GatewayMACs: []string{"gateway"}},
+		{Reachable: []string{"192.168.1.1"}},
+		{Reachable: []string{"a b:80"}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+	if err := (Policy{Subnets: []string{"10.0.0.0/8"}, Reachable: []string{"nas.lan:2049"}}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGatewayMAC(t *testing.T) {
+	dir := t.TempDir()
+	route := filepath.Join(dir, "route")
+	arp := filepath.Join(dir, "arp")
+	os.WriteFile(route, []byte("Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"+
+		"wlan0\t0001A8C0\t00000000\t0001\t0\t0\t600\t00FFFFFF\t0\t0\t0\n"+
+		"wlan0\t00000000\t0101A8C0\t0003\t0\t0\t600\t00000000\t0\t0\t0\n"), 0644)
+	os.WriteFile(arp, []byte("IP address       HW type     Flags       HW address            Mask     Device\n"+
+		"192.168.1.50     0x1         0x2         11:22:33:44:55:66     *        wlan0\n"+
+		"192.168.1.1      0x1         0x2         aa:bb:cc:00:11:22     *        wlan0\n"), 0644)
+
+	mac, err := gatewayMAC(route, arp)
+	if err != nil || mac != "aa:bb:cc:00:11:22" {
+		t.Errorf("gatewayMAC = %q, %v", mac, err)
+	}
+
+	os.WriteFile(route, []byte("Iface\tDestination\tGateway\n"), 0644)
+	if _, err := gatewayMAC(route, arp); err == nil {
+		t.Error("expected error without default route")
+	}
+}
+
+func TestOnBattery(t *testing.T) {
+	dir := t.TempDir()
+	supply := func(name string, files map[string]string) {
+		os.MkdirAll(filepath.Join(dir, name), 0755)
+		for f, v := range files {
+			os.WriteFile(filepath.Join(dir, name, f), []byte(v+"\n"), 0644)
+		}
+	}
+	supply("BAT0", map[string]string{"type": "Battery", "status": "Discharging"})
+	supply("AC", map[string]string{"type": "Mains", "online": "0"})
+	if on, err := onBattery(dir); err != nil || !on {
+		t.Errorf("unplugged laptop: onBattery = %v, %v", on, err)
+	}
+
+	supply("AC", map[string]string{"online": "1"})
+	if on, _ := onBattery(dir); on {
+		t.Error("plugged laptop reported on battery")
+	}
+	if on, _ := onBattery(t.TempDir()); on {
+		t.Error("desktop reported on battery")
+	}
+}
@@ -0,0 +1,164 @@
+package power
+
+import (
+	"autonfs/pkg/sshutil"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Hypervisor types with built-in commands
+const (
+	HypervisorProxmox = "proxmox"
+	HypervisorLibvirt = "libvirt"
+	HypervisorCustom  = "custom"
+)
+
+// Hypervisor shutdown modes
+const (
+	ShutdownGuest      = "guest"      // The watcher powers the guest OS off, the VM stops with it
+	ShutdownHypervisor = "hypervisor" // The watcher asks the hypervisor to stop the VM over SSH
+)
+
+// HypervisorConfig starts a VM through its hypervisor over SSH
+type HypervisorConfig struct {
+	Host         string `yaml:"host"`                    // SSH alias of the hypervisor, as seen from the client
+	Type         string `yaml:"type"`                    // proxmox, libvirt or custom
+	VM           string `yaml:"vm,omitempty"`            // VMID (proxmox) or domain name (libvirt)
+	StatusCmd    string `yaml:"status_cmd,omitempty"`    // Overrides the type's status command
+	StartCmd     string `yaml:"start_cmd,omitempty"`     // Overrides the type's start command
+	StopCmd      string `yaml:"stop_cmd,omitempty"`      // Overrides the type's stop command
+	RunningMatch string `yaml:"running_match,omitempty"` // Status output substring meaning running
+	Shutdown     string `yaml:"shutdown,omitempty"`      // guest (default) or hypervisor
+	ShutdownHost string `yaml:"shutdown_host,omitempty"` // SSH target from the server for hypervisor shutdown, default host
+}
+
+var vmNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func (c HypervisorConfig) validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("hypervisor host is required")
+	}
+	switch c.Type {
+	case HypervisorProxmox, HypervisorLibvirt:
+		// VM ends up in shell commands on the hypervisor
+		if !vmNameRe.MatchString(c.VM) {
+			return fmt.Errorf("hypervisor vm must be a VMID or domain name, got %q", c.VM)
+		}
+	case HypervisorCustom:
+		if c.StatusCmd == "" || c.StartCmd == "" || c.RunningMatch == "" {
+			return fmt.Errorf("custom hypervisor needs status_cmd, start_cmd and running_match")
+		}
+	default:
+		return fmt.Errorf("unknown hypervisor type %q (proxmox, libvirt, custom)", c.Type)
+	}
+	switch c.Shutdown {
+	case "", ShutdownGuest:
+	case ShutdownHypervisor:
+		if c.withDefaults().StopCmd == "" {
+			return fmt.Errorf("hypervisor shutdown needs stop_cmd")
+		}
+		if strings.ContainsAny(c.ShutdownHost, " \t\"'\\") {
+			return fmt.Errorf("invalid shutdown_host %q", c.ShutdownHost)
+		}
+	default:
+		return fmt.Errorf("unknown hypervisor shutdown %q (guest, hypervisor)", c.Shutdown)
+	}
+	return nil
+}
+
+// withDefaults fills the commands of the built-in types
+func (c HypervisorConfig) withDefaults() HypervisorConfig {
+	var status, start, stop, running string
+	switch c.Type {
+	case HypervisorProxmox:
+		status, start, stop, running = "qm status "+c.VM, "qm start "+c.VM, "qm shutdown "+c.VM, "status: running"
+	case HypervisorLibvirt:
+		virsh := "virsh --connect qemu:///system "
+		status, start, stop, running = virsh+"domstate "+c.VM, virsh+"start "+c.VM, virsh+"shutdown "+c.VM, "running"
+	}
+	if c.StatusCmd == "" {
+		c.StatusCmd = status
+	}
+	if c.StartCmd == "" {
+		c.StartCmd = start
+	}
+	if c.StopCmd == "" {
+		c.StopCmd = stop
+	}
+	if c.RunningMatch == "" {
+		c.RunningMatch = running
+	}
+	if c.ShutdownHost == "" {
+		c.ShutdownHost = c.Host
+	}
+	return c
+}
+
+// ShutdownCommand returns the watcher shutdown command for hypervisor
+// shutdown, or "" when the guest should simply power itself off. Root on
+// the server must be able to ssh to ShutdownHost non-interactively.
+func (c HypervisorConfig) ShutdownCommand() string {
+	if c.Shutdown != ShutdownHypervisor {
+		return ""
+	}
+	c = c.withDefaults()
+	return fmt.Sprintf("ssh -o BatchMode=yes %s %s", c.ShutdownHost, shellQuote(c.StopCmd))
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// commandRunner runs a shell command on the hypervisor, e.g. *sshutil.Client
+type commandRunner interface {
+	RunCommand(cmd string) (string, error)
+}
+
+// dialHypervisor connects to the hypervisor, replaced in tests
+var dialHypervisor = func(alias string) (commandRunner, error) {
+	client, err := sshutil.NewClient(alias)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// hypervisor powers a VM on with the hypervisor's start command
+type hypervisor struct {
+	cfg HypervisorConfig
+}
+
+func newHypervisor(cfg HypervisorConfig) *hypervisor {
+	return &hypervisor{cfg: cfg.withDefaults()}
+}
+
+func (h *hypervisor) Wake(ctx context.Context, ready func(context.Context) error) error {
+	runner, err := dialHypervisor(h.cfg.Host)
+	if err != nil {
+		return fmt.Errorf("hypervisor %s: %v", h.cfg.Host, err)
+	}
+	if c, ok := runner.(interface{ Close() error }); ok {
+		defer c.Close()
+	}
+	return powerOnThenWait(ctx, func(ctx context.Context) error {
+		return h.start(runner)
+	}, ready)
+}
+
+// start checks the VM state first, so an already running VM is left alone
+func (h *hypervisor) start(runner commandRunner) error {
+	out, err := runner.RunCommand(h.cfg.StatusCmd)
+	if err != nil {
+		return fmt.Errorf("hypervisor status: %v", err)
+	}
+	if strings.Contains(strings.ToLower(out), strings.ToLower(h.cfg.RunningMatch)) {
+		return nil
+	}
+	if _, err := runner.RunCommand(h.cfg.StartCmd); err != nil {
+		return fmt.Errorf("hypervisor start: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package power
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// IPMIConfig reaches a BMC with IPMI-over-LAN through ipmitool
+type IPMIConfig struct {
+	Host      string `yaml:"host"`                // BMC address
+	Username  string `yaml:"username"`            // BMC user
+	Password  Secret `yaml:"password"`            // Passed to ipmitool via IPMI_PASSWORD, never as an argument
+	Interface string `yaml:"interface,omitempty"` // ipmitool -I, default lanplus
+}
+
+func (c IPMIConfig) validate() error {
+	if c.Host == "" || c.Username == "" {
+		return fmt.Errorf("ipmi host and username are required")
+	}
+	return c.Password.validate("ipmi password")
+}
+
+// ipmiRunner runs ipmitool with extra environment variables
+type ipmiRunner func(ctx context.Context, env []string, args ...string) (string, error)
+
+func runIPMITool(ctx context.Context, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "ipmitool", args...)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("ipmitool: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// ipmi powers a server on with `ipmitool chassis power on`
+type ipmi struct {
+	cfg IPMIConfig
+	run ipmiRunner
+}
+
+func newIPMI(cfg IPMIConfig) *ipmi {
+	if cfg.Interface == "" {
+		cfg.Interface = "lanplus"
+	}
+	return &ipmi{cfg: cfg, run: runIPMITool}
+}
+
+func (p *ipmi) Wake(ctx context.Context, ready func(context.Context) error) error {
+	return powerOnThenWait(ctx, p.powerOn, ready)
+}
+
+func (p *ipmi) powerOn(ctx context.Context) error {
+	env := []string{"IPMI_PASSWORD=" + p.cfg.Password.Value}
+	base := []string{"-I", p.cfg.Interface, "-H", p.cfg.Host, "-U", p.cfg.Username, "-E", "chassis", "power"}
+
+	out, err := p.run(ctx, env, append(base, "status")...)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(strings.ToLower(out), "power is on") {
+		return nil
+	}
+	_, err = p.run(ctx, env, append(base, "on")...)
+	return err
+}
@@ -0,0 +1,229 @@
+// Package power turns servers on through pluggable backends: Wake-on-LAN,
+// Redfish/IPMI BMCs, HTTP webhooks (smart plugs, Home Assistant...) and
+// hypervisors for servers that are VMs.
+package power
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Backend names accepted in Config.Backend
+const (
+	BackendWoL        = "wol"
+	BackendRedfish    = "redfish"
+	BackendIPMI       = "ipmi"
+	BackendWebhook    = "webhook"
+	BackendHypervisor = "hypervisor"
+)
+
+// DefaultRequestTimeout bounds a single BMC or webhook request
+const DefaultRequestTimeout = 10 * time.Second
+
+// retryInterval is the pause between failed power-on attempts
+var retryInterval = 5 * time.Second
+
+// Waker turns a server on and returns once ready reports it usable.
+// *wol.Waker implements it for the WoL backend.
+type Waker interface {
+	Wake(ctx context.Context, ready func(context.Context) error) error
+}
+
+// Target identifies the server for backends and templates
+type Target struct {
+	Alias string
+	IP    string
+	MAC   string
+}
+
+// Config selects and configures the power-on backend of a host
+type Config struct {
+	Backend string         `yaml:"backend,omitempty"` // wol (default), redfish, ipmi, webhook, hypervisor
+	Alias   string         `yaml:"alias,omitempty"`   // Filled in by apply, for templates
+	Redfish *RedfishConfig `yaml:"redfish,omitempty"`
+	IPMI    *IPMIConfig    `yaml:"ipmi,omitempty"`
+	Webhook *WebhookConfig `yaml:"webhook,omitempty"`
+
+	Hypervisor *HypervisorConfig `yaml:"hypervisor,omitempty"`
+}
+
+// Secret is a credential taken from a file or an environment variable.
+// Apply resolves it into Value, which only ever lands in the root-only
+// config installed on the client, never in autonfs.yaml.
+type Secret struct {
+	File  string `yaml:"file,omitempty"`
+	Env   string `yaml:"env,omitempty"`
+	Value string `yaml:"value,omitempty"`
+}
+
+// IsWoL reports whether the config uses the built-in WoL path
+func (c Config) IsWoL() bool {
+	return c.Backend == "" || c.Backend == BackendWoL
+}
+
+// Validate checks the backend settings. Inline secret values are rejected:
+// autonfs.yaml is meant to be shareable.
+func (c Config) Validate() error {
+	switch c.Backend {
+	case "", BackendWoL:
+		return nil
+	case BackendRedfish:
+		if c.Redfish == nil {
+			return fmt.Errorf("backend redfish needs a redfish section")
+		}
+		return c.Redfish.validate()
+	case BackendIPMI:
+		if c.IPMI == nil {
+			return fmt.Errorf("backend ipmi needs an ipmi section")
+		}
+		return c.IPMI.validate()
+	case BackendWebhook:
+		if c.Webhook == nil {
+			return fmt.Errorf("backend webhook needs a webhook section")
+		}
+		return c.Webhook.validate()
+	case BackendHypervisor:
+		if c.Hypervisor == nil {
+			return fmt.Errorf("backend hypervisor needs a hypervisor section")
+		}
+		return c.Hypervisor.validate()
+	}
+	return fmt.Errorf("unknown power backend %q (wol, redfish, ipmi, webhook, hypervisor)", c.Backend)
+}
+
+func (s Secret) validate(name string) error {
+	if s.Value != "" {
+		return fmt.Errorf("%s must come from file or env, not an inline value", name)
+	}
+	if s.File != "" && s.Env != "" {
+		return fmt.Errorf("%s: set only one of file and env", name)
+	}
+	return nil
+}
+
+// Resolve reads the secret from its file or environment variable
+func (s *Secret) Resolve() error {
+	switch {
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return fmt.Errorf("failed to read secret: %v", err)
+		}
+		s.Value = strings.TrimSpace(string(data))
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return fmt.Errorf("secret variable %s is not set", s.Env)
+		}
+		s.Value = v
+	}
+	s.File, s.Env = "", ""
+	return nil
+}
+
+// ResolveSecrets resolves every secret of the selected backend in place
+func (c *Config) ResolveSecrets() error {
+	var s *Secret
+	switch {
+	case c.Backend == BackendRedfish && c.Redfish != nil:
+		s = &c.Redfish.Password
+	case c.Backend == BackendIPMI && c.IPMI != nil:
+		s = &c.IPMI.Password
+	case c.Backend == BackendWebhook && c.Webhook != nil:
+		s = &c.Webhook.Auth
+	}
+	if s == nil {
+		return nil
+	}
+	return s.Resolve()
+}
+
+// LoadConfig reads a power config installed by apply
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read power config: %v", err)
+	}
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("failed to parse power config: %v", err)
+	}
+	// Installed files carry resolved values, but file/env still work for manual use
+	if err := cfg.ResolveSecrets(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// New creates the Waker for a non-WoL backend
+func New(cfg Config, target Target) (Waker, error) {
+	if target.Alias == "" {
+		target.Alias = cfg.Alias
+	}
+	switch cfg.Backend {
+	case BackendRedfish:
+		return newRedfish(*cfg.Redfish), nil
+	case BackendIPMI:
+		return newIPMI(*cfg.IPMI), nil
+	case BackendWebhook:
+		return newWebhook(*cfg.Webhook, target)
+	case BackendHypervisor:
+		return newHypervisor(*cfg.Hypervisor), nil
+	}
+	return nil, fmt.Errorf("backend %q has no power.Waker, use wol.Waker", cfg.Backend)
+}
+
+func validTimeout(s string) error {
+	if s == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(s); err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout %q", s)
+	}
+	return nil
+}
+
+// requestTimeout returns the configured or default request timeout
+func requestTimeout(s string) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d
+	}
+	return DefaultRequestTimeout
+}
+
+// ShutdownCommand returns the watcher shutdown command the backend needs,
+// or "" to keep the default poweroff
+func (c Config) ShutdownCommand() string {
+	if c.Backend == BackendHypervisor && c.Hypervisor != nil {
+		return c.Hypervisor.ShutdownCommand()
+	}
+	return ""
+}
+
+// powerOnThenWait retries powerOn until it succeeds, then waits for ready.
+// Unlike WoL these backends are not resent: a second "on" is pointless at
+// best and may toggle the power at worst.
+func powerOnThenWait(ctx context.Context, powerOn, ready func(context.Context) error) error {
+	for {
+		err := powerOn(ctx)
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("power on failed: %v", err)
+		case <-time.After(retryInterval):
+		}
+	}
+	return ready(ctx)
+}
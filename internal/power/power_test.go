@@ -0,0 +1,324 @@
+package power
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func noReady(context.Context) error { return nil }
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"default wol", Config{}, ""},
+		{"unknown", Config{Backend: "magic"}, "unknown power backend"},
+		{"missing section", Config{Backend: BackendIPMI}, "needs an ipmi section"},
+		{"inline secret", Config{Backend: BackendIPMI, IPMI: &IPMIConfig{Host: "bmc", Username: "admin", Password: Secret{Value: "x"}}}, "not an inline value"},
+		{"both sources", Config{Backend: BackendIPMI, IPMI: &IPMIConfig{Host: "bmc", Username: "admin", Password: Secret{File: "a", Env: "B"}}}, "only one"},
+		{"redfish url", Config{Backend: BackendRedfish, Redfish: &RedfishConfig{Endpoint: "bmc.lan", Username: "admin"}}, "http(s) URL"},
+		{"redfish timeout", Config{Backend: BackendRedfish, Redfish: &RedfishConfig{Endpoint: "https://bmc", Username: "admin", Timeout: "soon"}}, "invalid timeout"},
+		{"webhook template", Config{Backend: BackendWebhook, Webhook: &WebhookConfig{URL: "http://x/{{.IP"}}, "webhook url"},
+		{"webhook header template", Config{Backend: BackendWebhook, Webhook: &WebhookConfig{URL: "http://x/on", Headers: map[string]string{"X-Host": "{{.IP"}}}, "webhook header X-Host"},
+		{"webhook ok", Config{Backend: BackendWebhook, Webhook: &WebhookConfig{URL: "http://plug/on", Auth: Secret{Env: "TOKEN"}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("want error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestResolveSecretsAndLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "pw")
+	os.WriteFile(secret, []byte("s3cret\n"), 0600)
+
+	cfg := Config{Backend: BackendRedfish, Redfish: &RedfishConfig{Endpoint: "https://bmc", Username: "admin", Password: Secret{File: secret}}}
+	if err := cfg.ResolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if p := cfg.Redfish.Password; p.Value != "s3cret" || p.File != "" {
+		t.Fatalf("unexpected resolved secret %+v", p)
+	}
+
+	t.Setenv("AUTONFS_TEST_TOKEN", "Bearer abc")
+	path := filepath.Join(dir, "power.yaml")
+	os.WriteFile(path, []byte("backend: webhook\nwebhook:\n  url: http://plug/on\n  auth:\n    env: AUTONFS_TEST_TOKEN\n"), 0600)
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Webhook.Auth.Value != "Bearer abc" {
+		t.Errorf("auth not resolved: %+v", loaded.Webhook.Auth)
+	}
+
+	os.WriteFile(path, []byte("backend: webhook\nbogus: 1\n"), 0600)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+// fakeBMC is a minimal Redfish service
+type fakeBMC struct {
+	mu      sync.Mutex
+	state   string
+	resets  []string
+	badAuth bool
+}
+
+func (b *fakeBMC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if u, p, ok := r.BasicAuth(); !ok || u != "admin" || p != "pw" {
+		b.badAuth = true
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/redfish/v1/Systems":
+		io.WriteString(w, `{"Members":[{"@odata.id":"/redfish/v1/Systems/1"}]}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/redfish/v1/Systems/1":
+		json.NewEncoder(w).Encode(map[string]any{
+			"PowerState": b.state,
+			"Actions": map[string]any{
+				"#ComputerSystem.Reset": map[string]string{"target": "/redfish/v1/Systems/1/Actions/Reset"},
+			},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/redfish/v1/Systems/1/Actions/Reset":
+		var req struct{ ResetType string }
+		json.NewDecoder(r.Body).Decode(&req)
+		b.resets = append(b.resets, req.ResetType)
+		b.state = "On"
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRedfishWake(t *testing.T) {
+	bmc := &fakeBMC{state: "Off"}
+	srv := httptest.NewTLSServer(bmc)
+	defer srv.Close()
+
+	cfg := Config{Backend: BackendRedfish, Redfish: &RedfishConfig{
+		Endpoint: srv.URL + "/", Username: "admin", Password: Secret{Value: "pw"}, Insecure: true,
+	}}
+	w, err := New(cfg, Target{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Wake(context.Background(), noReady); err != nil {
+		t.Fatal(err)
+	}
+	// Already on: no second reset
+	if err := w.Wake(context.Background(), noReady); err != nil {
+		t.Fatal(err)
+	}
+	if len(bmc.resets) != 1 || bmc.resets[0] != "On" {
+		t.Errorf("unexpected resets %v", bmc.resets)
+	}
+	if bmc.badAuth {
+		t.Error("request without valid credentials")
+	}
+}
+
+func TestRedfishWake_RetriesUntilDeadline(t *testing.T) {
+	old := retryInterval
+	retryInterval = 10 * time.Millisecond
+	defer func() { retryInterval = old }()
+
+	srv := httptest.NewServer(&fakeBMC{state: "Off"})
+	defer srv.Close()
+
+	w := newRedfish(RedfishConfig{Endpoint: srv.URL, Username: "admin", Password: Secret{Value: "wrong"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := w.Wake(ctx, noReady)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected 401 error, got %v", err)
+	}
+}
+
+func TestIPMIWake(t *testing.T) {
+	var calls [][]string
+	var envs []string
+	status := "Chassis Power is off"
+	p := newIPMI(IPMIConfig{Host: "10.0.0.5", Username: "admin", Password: Secret{Value: "pw"}})
+	p.run = func(ctx context.Context, env []string, args ...string) (string, error) {
+		calls = append(calls, args)
+		envs = append(envs, env...)
+		if args[len(args)-1] == "on" {
+			status = "Chassis Power is on"
+		}
+		return status, nil
+	}
+
+	if err := p.Wake(context.Background(), noReady); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Wake(context.Background(), noReady); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 {
+		t.Fatalf("expected status, on, status; got %v", calls)
+	}
+	joined := strings.Join(calls[1], " ")
+	if joined != "-I lanplus -H 10.0.0.5 -U admin -E chassis power on" {
+		t.Errorf("unexpected args %q", joined)
+	}
+	for _, c := range calls {
+		if strings.Contains(strings.Join(c, " "), "pw") {
+			t.Errorf("password leaked into args: %v", c)
+		}
+	}
+	if envs[0] != "IPMI_PASSWORD=pw" {
+		t.Errorf("unexpected env %v", envs)
+	}
+}
+
+func TestWebhookWake(t *testing.T) {
+	var got struct {
+		method, path, auth, ctype, host, body string
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got.method, got.path, got.body = r.Method, r.URL.Path, string(data)
+		got.auth, got.ctype = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		got.host = r.Header.Get("X-Target")
+	}))
+	defer srv.Close()
+
+	cfg := Config{Backend: BackendWebhook, Alias: "nas", Webhook: &WebhookConfig{
+		URL:     srv.URL + "/api/services/switch/turn_on",
+		Headers: map[string]string{"Content-Type": "application/json", "X-Target": "{{.Alias}}@{{.IP}}"},
+		Body:    `{"entity_id":"switch.{{.Alias}}","ip":"{{.IP}}"}`,
+		Auth:    Secret{Value: "Bearer tok"},
+	}}
+	w, err := New(cfg, Target{IP: "192.168.1.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Wake(context.Background(), noReady); err != nil {
+		t.Fatal(err)
+	}
+	if got.method != "POST" || got.path != "/api/services/switch/turn_on" {
+		t.Errorf("unexpected request %s %s", got.method, got.path)
+	}
+	if got.body != `{"entity_id":"switch.nas","ip":"192.168.1.10"}` {
+		t.Errorf("unexpected body %s", got.body)
+	}
+	if got.auth != "Bearer tok" || got.ctype != "application/json" || got.host != "nas@192.168.1.10" {
+		t.Errorf("unexpected headers auth=%q type=%q target=%q", got.auth, got.ctype, got.host)
+	}
+}
+
+func TestWebhook_BadTemplateField(t *testing.T) {
+	_, err := New(Config{Backend: BackendWebhook, Webhook: &WebhookConfig{URL: "http://plug/{{.Nope}}"}}, Target{})
+	if err == nil {
+		t.Fatal("expected error for unknown template field")
+	}
+}
+
+// fakeHypervisor records commands and flips to running on start
+type fakeHypervisor struct {
+	cmds    []string
+	running bool
+}
+
+func (f *fakeHypervisor) RunCommand(cmd string) (string, error) {
+	f.cmds = append(f.cmds, cmd)
+	switch {
+	case strings.Contains(cmd, "domstate"):
+		if f.running {
+			return "running", nil
+		}
+		return "shut off", nil
+	case strings.Contains(cmd, " start "):
+		f.running = true
+	}
+	return "", nil
+}
+
+func TestHypervisorWake(t *testing.T) {
+	fake := &fakeHypervisor{}
+	old := dialHypervisor
+	dialHypervisor = func(alias string) (commandRunner, error) {
+		if alias != "kvm1" {
+			t.Errorf("dialed %q", alias)
+		}
+		return fake, nil
+	}
+	defer func() { dialHypervisor = old }()
+
+	cfg := Config{Backend: BackendHypervisor, Hypervisor: &HypervisorConfig{Host: "kvm1", Type: HypervisorLibvirt, VM: "nas"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(cfg, Target{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.Wake(context.Background(), noReady); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"virsh --connect qemu:///system domstate nas",
+		"virsh --connect qemu:///system start nas",
+		"virsh --connect qemu:///system domstate nas",
+	}
+	if strings.Join(fake.cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected commands:\n%s", strings.Join(fake.cmds, "\n"))
+	}
+}
+
+func TestHypervisorValidateAndShutdown(t *testing.T) {
+	bad := []HypervisorConfig{
+		{Type: HypervisorProxmox, VM: "105"},
+		{Host: "pve", Type: HypervisorProxmox, VM: "105; reboot"},
+		{Host: "pve", Type: "vmware", VM: "nas"},
+		{Host: "pve", Type: HypervisorCustom, StartCmd: "start-vm"},
+		{Host: "pve", Type: HypervisorCustom, StatusCmd: "s", StartCmd: "s", RunningMatch: "up", Shutdown: ShutdownHypervisor},
+		{Host: "pve", Type: HypervisorProxmox, VM: "105", Shutdown: "pull-the-plug"},
+	}
+	for _, c := range bad {
+		if err := c.validate(); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+
+	guest := HypervisorConfig{Host: "pve", Type: HypervisorProxmox, VM: "105"}
+	if cmd := guest.ShutdownCommand(); cmd != "" {
+		t.Errorf("guest shutdown should keep the default poweroff, got %q", cmd)
+	}
+	custom := HypervisorConfig{Host: "pve", Type: HypervisorCustom, StatusCmd: "s", StartCmd: "s", RunningMatch: "up",
+		StopCmd: "echo 'bye' | stop-vm", Shutdown: ShutdownHypervisor, ShutdownHost: "root@10.0.0.2"}
+	if err := custom.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := custom.ShutdownCommand(); cmd != `ssh -o BatchMode=yes root@10.0.0.2 'echo '\''bye'\'' | stop-vm'` {
+		t.Errorf("unexpected shutdown command %s", cmd)
+	}
+}
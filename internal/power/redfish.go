@@ -0,0 +1,145 @@
+package power
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedfishConfig reaches a BMC implementing DMTF Redfish
+type RedfishConfig struct {
+	Endpoint  string `yaml:"endpoint"`             // e.g. https://192.168.1.60
+	System    string `yaml:"system,omitempty"`     // System id, default first member of /redfish/v1/Systems
+	Username  string `yaml:"username"`             // BMC user
+	Password  Secret `yaml:"password"`             // BMC password
+	ResetType string `yaml:"reset_type,omitempty"` // Default On
+	Insecure  bool   `yaml:"insecure,omitempty"`   // Accept self-signed BMC certificates
+	Timeout   string `yaml:"timeout,omitempty"`    // Per request, default 10s
+}
+
+func (c RedfishConfig) validate() error {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("redfish endpoint must be an http(s) URL, got %q", c.Endpoint)
+	}
+	if c.Username == "" {
+		return fmt.Errorf("redfish username is required")
+	}
+	if err := validTimeout(c.Timeout); err != nil {
+		return err
+	}
+	return c.Password.validate("redfish password")
+}
+
+// redfish powers a server on with ComputerSystem.Reset
+type redfish struct {
+	cfg    RedfishConfig
+	client *http.Client
+}
+
+func newRedfish(cfg RedfishConfig) *redfish {
+	if cfg.ResetType == "" {
+		cfg.ResetType = "On"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &redfish{cfg: cfg, client: &http.Client{Transport: transport, Timeout: requestTimeout(cfg.Timeout)}}
+}
+
+func (r *redfish) Wake(ctx context.Context, ready func(context.Context) error) error {
+	return powerOnThenWait(ctx, r.powerOn, ready)
+}
+
+// redfishSystem is the part of a ComputerSystem resource we need
+type redfishSystem struct {
+	PowerState string `json:"PowerState"`
+	Actions    struct {
+		Reset struct {
+			Target string `json:"target"`
+		} `json:"#ComputerSystem.Reset"`
+	} `json:"Actions"`
+}
+
+func (r *redfish) powerOn(ctx context.Context) error {
+	path, err := r.systemPath(ctx)
+	if err != nil {
+		return err
+	}
+	var sys redfishSystem
+	if err := r.do(ctx, http.MethodGet, path, nil, &sys); err != nil {
+		return err
+	}
+	if strings.EqualFold(sys.PowerState, "On") {
+		// Already on (or booting): resetting would interrupt it
+		return nil
+	}
+
+	target := sys.Actions.Reset.Target
+	if target == "" {
+		target = path + "/Actions/ComputerSystem.Reset"
+	}
+	body, _ := json.Marshal(map[string]string{"ResetType": r.cfg.ResetType})
+	return r.do(ctx, http.MethodPost, target, body, nil)
+}
+
+// systemPath returns the @odata.id of the configured or first system
+func (r *redfish) systemPath(ctx context.Context) (string, error) {
+	if r.cfg.System != "" {
+		return "/redfish/v1/Systems/" + r.cfg.System, nil
+	}
+	var coll struct {
+		Members []struct {
+			ID string `json:"@odata.id"`
+		} `json:"Members"`
+	}
+	if err := r.do(ctx, http.MethodGet, "/redfish/v1/Systems", nil, &coll); err != nil {
+		return "", err
+	}
+	if len(coll.Members) == 0 {
+		return "", fmt.Errorf("redfish: no systems found")
+	}
+	return coll.Members[0].ID, nil
+}
+
+// do performs an authenticated request and decodes the JSON answer into out
+func (r *redfish) do(ctx context.Context, method, path string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.cfg.Endpoint+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.cfg.Username, r.cfg.Password.Value)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("redfish: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("redfish: %s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("redfish: bad response from %s: %v", path, err)
+	}
+	return nil
+}
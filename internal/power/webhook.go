@@ -0,0 +1,125 @@
+package power
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// WebhookConfig calls an HTTP endpoint that powers the server on, e.g. a
+// smart plug or a Home Assistant script. URL, Headers values and Body are
+// text/templates with .Alias, .IP and .MAC.
+type WebhookConfig struct {
+	Method     string            `yaml:"method,omitempty"`      // Default POST
+	URL        string            `yaml:"url"`                   // Templated
+	Headers    map[string]string `yaml:"headers,omitempty"`     // Extra headers, values templated, no secrets
+	Body       string            `yaml:"body,omitempty"`        // Templated
+	AuthHeader string            `yaml:"auth_header,omitempty"` // Header carrying Auth, default Authorization
+	Auth       Secret            `yaml:"auth,omitempty"`        // e.g. "Bearer <token>"
+	Timeout    string            `yaml:"timeout,omitempty"`     // Per request, default 10s
+}
+
+func (c WebhookConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("webhook url is required")
+	}
+	if _, err := template.New("url").Parse(c.URL); err != nil {
+		return fmt.Errorf("webhook url: %v", err)
+	}
+	for k, v := range c.Headers {
+		if _, err := template.New("header").Parse(v); err != nil {
+			return fmt.Errorf("webhook header %s: %v", k, err)
+		}
+	}
+	if _, err := template.New("body").Parse(c.Body); err != nil {
+		return fmt.Errorf("webhook body: %v", err)
+	}
+	if err := validTimeout(c.Timeout); err != nil {
+		return err
+	}
+	return c.Auth.validate("webhook auth")
+}
+
+// webhook powers a server on with a single HTTP request
+type webhook struct {
+	cfg     WebhookConfig
+	url     string
+	headers map[string]string
+	body    string
+	client  *http.Client
+}
+
+func newWebhook(cfg WebhookConfig, target Target) (*webhook, error) {
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.AuthHeader == "" {
+		cfg.AuthHeader = "Authorization"
+	}
+	u, err := render("url", cfg.URL, target)
+	if err != nil {
+		return nil, err
+	}
+	if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("webhook url must be http(s), got %q", u)
+	}
+	headers := make(map[string]string, len(cfg.Headers))
+	for k, v := range cfg.Headers {
+		if headers[k], err = render("header "+k, v, target); err != nil {
+			return nil, err
+		}
+	}
+	body, err := render("body", cfg.Body, target)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook{cfg: cfg, url: u, headers: headers, body: body, client: &http.Client{Timeout: requestTimeout(cfg.Timeout)}}, nil
+}
+
+func render(name, text string, target Target) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("webhook %s: %v", name, err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, target); err != nil {
+		return "", fmt.Errorf("webhook %s: %v", name, err)
+	}
+	return b.String(), nil
+}
+
+func (w *webhook) Wake(ctx context.Context, ready func(context.Context) error) error {
+	return powerOnThenWait(ctx, w.powerOn, ready)
+}
+
+func (w *webhook) powerOn(ctx context.Context) error {
+	var body io.Reader
+	if w.body != "" {
+		body = strings.NewReader(w.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, w.cfg.Method, w.url, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	if w.cfg.Auth.Value != "" {
+		req.Header.Set(w.cfg.AuthHeader, w.cfg.Auth.Value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
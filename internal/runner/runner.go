@@ -0,0 +1,26 @@
+// Package runner runs the system commands (systemctl, umount) with which the
+// client acts on its mounts.
+package runner
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Runner runs a command to completion
+type Runner interface {
+	RunCommand(name string, arg ...string) error
+}
+
+// Exec runs commands on this machine. The output of a failing command is
+// part of the error, systemctl and umount explain themselves there.
+type Exec struct{}
+
+func (Exec) RunCommand(name string, arg ...string) error {
+	out, err := exec.Command(name, arg...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(arg, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	if err := (Exec{}).RunCommand("true"); err != nil {
+		t.Fatal(err)
+	}
+	err := (Exec{}).RunCommand("sh", "-c", "echo target is busy >&2; exit 32")
+	if err == nil || !strings.Contains(err.Error(), "exit status 32: target is busy") {
+		t.Errorf("Expected the command output in the error, got %v", err)
+	}
+}
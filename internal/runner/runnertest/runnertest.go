@@ -0,0 +1,38 @@
+// Package runnertest provides a command recorder for tests of the packages
+// acting through a runner.Runner.
+package runnertest
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Recorder stands in for runner.Exec in tests: it records each command line and
+// fails the lines listed in Fail
+type Recorder struct {
+	Fail map[string]bool
+
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (r *Recorder) RunCommand(name string, arg ...string) error {
+	line := strings.Join(append([]string{name}, arg...), " ")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cmds = append(r.cmds, line)
+	if r.Fail[line] {
+		return errors.New("target is busy")
+	}
+	return nil
+}
+
+// Commands returns the recorded command lines joined by "|" and starts over
+func (r *Recorder) Commands() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := strings.Join(r.cmds, "|")
+	r.cmds = nil
+	return s
+}
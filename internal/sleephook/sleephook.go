@@ -0,0 +1,120 @@
+// Package sleephook unmounts the AutoNFS mounts before the client suspends
+// or hibernates and re-arms their automounts on resume. A mount left over a
+// suspend keeps its NFSv4 client record on the server, which then stays up
+// until the lease expires.
+package sleephook
+
+import (
+	"autonfs/internal/mountinfo"
+	"autonfs/internal/runner"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Busy mount policies
+const (
+	BusyLazy  = "lazy"  // Lazy unmount (umount -l), the default
+	BusySkip  = "skip"  // Leave the mount in place
+	BusyBlock = "block" // Abort the suspend
+	Off       = "off"   // Not handled by the hook at all
+)
+
+// ValidPolicy reports whether s is a known policy, empty meaning the default
+func ValidPolicy(s string) bool {
+	switch s {
+	case "", BusyLazy, BusySkip, BusyBlock, Off:
+		return true
+	}
+	return false
+}
+
+// Mount is one AutoNFS mount handled by the hook
+type Mount struct {
+	Path   string // Mount point
+	Unit   string // Unit name without suffix, as generated by apply
+	Policy string // Busy policy
+}
+
+// Hook runs the pre-sleep and post-resume steps
+type Hook struct {
+	MountInfo string // /proc/self/mountinfo
+	Runner    runner.Runner
+}
+
+// New returns a hook acting on the running system
+func New() *Hook {
+	return &Hook{
+		MountInfo: mountinfo.DefaultFile,
+		Runner:    runner.Exec{},
+	}
+}
+
+// Pre unmounts the mounts and disarms their automounts, so nothing wakes
+// the server between now and the suspend. With a busy block mount the
+// mounts handled so far are re-armed and an error is returned: the unit
+// running the hook fails and systemd cancels the suspend.
+func (h *Hook) Pre(mounts []Mount) error {
+	nfs, err := mountinfo.NFSMounts(h.MountInfo)
+	if err != nil {
+		slog.Warn("Reading mounts failed, trying to unmount everything", "error", err)
+	}
+	var disarmed []Mount
+	var blocked []string
+	for _, m := range mounts {
+		if _, mounted := nfs[m.Path]; err == nil && !mounted {
+			h.disarm(m)
+			disarmed = append(disarmed, m)
+			continue
+		}
+		stopErr := h.Runner.RunCommand("systemctl", "stop", m.Unit+".mount")
+		if stopErr == nil {
+			slog.Info("Unmounted before sleep", "mount", m.Path)
+			h.disarm(m)
+			disarmed = append(disarmed, m)
+			continue
+		}
+
+		switch m.Policy {
+		case BusySkip:
+			slog.Warn("Mount busy, left mounted over sleep", "mount", m.Path, "error", stopErr)
+		case BusyBlock:
+			slog.Error("Mount busy, blocking sleep", "mount", m.Path, "error", stopErr)
+			blocked = append(blocked, m.Path)
+		default:
+			if err := h.Runner.RunCommand("umount", "-l", m.Path); err != nil {
+				slog.Error("Lazy unmount failed", "mount", m.Path, "error", err)
+				continue
+			}
+			slog.Warn("Mount busy, lazily unmounted", "mount", m.Path)
+			h.disarm(m)
+			disarmed = append(disarmed, m)
+		}
+	}
+	if len(blocked) > 0 {
+		h.Post(disarmed)
+		return fmt.Errorf("busy mounts block sleep: %s", strings.Join(blocked, ", "))
+	}
+	return nil
+}
+
+// Post re-arms the automounts after resume
+func (h *Hook) Post(mounts []Mount) error {
+	var failed []string
+	for _, m := range mounts {
+		if err := h.Runner.RunCommand("systemctl", "start", m.Unit+".automount"); err != nil {
+			slog.Error("Re-arming automount failed", "mount", m.Path, "error", err)
+			failed = append(failed, m.Path)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("automounts not re-armed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (h *Hook) disarm(m Mount) {
+	if err := h.Runner.RunCommand("systemctl", "stop", m.Unit+".automount"); err != nil {
+		slog.Warn("Disarming automount failed", "mount", m.Path, "error", err)
+	}
+}
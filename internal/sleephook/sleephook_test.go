@@ -0,0 +1,77 @@
+package sleephook
+
+import (
+	"autonfs/internal/runner/runnertest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeHook returns a hook reading the given mount table
+func fakeHook(t *testing.T, mountinfo string, fail map[string]bool) (*Hook, *runnertest.Recorder) {
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	os.WriteFile(path, []byte(mountinfo), 0644)
+	rec := &runnertest.Recorder{Fail: fail}
+	return &Hook{MountInfo: path, Runner: rec}, rec
+}
+
+const mountTable = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+40 22 0:35 / /mnt/data rw,relatime shared:20 - autofs systemd-1 rw,fd=40
+41 40 0:42 / /mnt/data rw,relatime shared:21 - nfs4 192.168.1.100:/data rw,vers=4.2
+42 22 0:36 / /mnt/my\040media rw,relatime shared:22 - autofs systemd-1 rw,fd=41
+43 42 0:43 / /mnt/my\040media rw,relatime shared:23 - nfs 192.168.1.100:/media rw
+44 22 0:37 / /mnt/backup rw,relatime shared:24 - autofs systemd-1 rw,fd=42
+`
+
+func TestPre(t *testing.T) {
+	mounts := []Mount{
+		{Path: "/mnt/data", Unit: "mnt-data", Policy: BusyLazy},
+		{Path: "/mnt/my media", Unit: "mnt-my_media", Policy: BusySkip},
+		{Path: "/mnt/backup", Unit: "mnt-backup", Policy: BusyBlock},
+	}
+	h, cmds := fakeHook(t, mountTable, map[string]bool{
+		"systemctl stop mnt-data.mount":     true,
+		"systemctl stop mnt-my_media.mount": true,
+	})
+	if err := h.Pre(mounts); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"systemctl stop mnt-data.mount",
+		"umount -l /mnt/data",
+		"systemctl stop mnt-data.automount",
+		// Busy and skipped: the automount stays armed over the mount
+		"systemctl stop mnt-my_media.mount",
+		// Not mounted: only disarmed
+		"systemctl stop mnt-backup.automount",
+	}
+	if got := cmds.Commands(); got != strings.Join(want, "|") {
+		t.Errorf("commands:\n%s\nwant:\n%s", strings.ReplaceAll(got, "|", "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPre_Block(t *testing.T) {
+	mounts := []Mount{
+		{Path: "/mnt/backup", Unit: "mnt-backup", Policy: BusyLazy},
+		{Path: "/mnt/data", Unit: "mnt-data", Policy: BusyBlock},
+	}
+	h, cmds := fakeHook(t, mountTable, map[string]bool{"systemctl stop mnt-data.mount": true})
+	err := h.Pre(mounts)
+	if err == nil || !strings.Contains(err.Error(), "/mnt/data") {
+		t.Fatalf("expected busy error, got %v", err)
+	}
+	// The disarmed automount is re-armed, the suspend is cancelled
+	want := "systemctl stop mnt-backup.automount|systemctl stop mnt-data.mount|systemctl start mnt-backup.automount"
+	if got := cmds.Commands(); got != want {
+		t.Errorf("commands %v", got)
+	}
+}
+
+func TestPost(t *testing.T) {
+	h, cmds := fakeHook(t, "", map[string]bool{"systemctl start mnt-b.automount": true})
+	err := h.Post([]Mount{{Path: "/mnt/a", Unit: "mnt-a"}, {Path: "/mnt/b", Unit: "mnt-b"}})
+	if got := cmds.Commands(); err == nil || !strings.Contains(err.Error(), "/mnt/b") || got != "systemctl start mnt-a.automount|systemctl start mnt-b.automount" {
+		t.Errorf("Post = %v, commands %v", err, got)
+	}
+}
@@ -0,0 +1,146 @@
+// Package stale finds AutoNFS mounts left behind by a server that went away
+// (powered off by hand, crashed, shut down while a client was suspended).
+// Such a hard mount freezes every process touching it; the fix is to drop
+// it and re-arm the automount so the next access wakes the server again.
+package stale
+
+import (
+	"autonfs/internal/mountinfo"
+	"autonfs/internal/runner"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Check defaults
+const (
+	DefaultAttempts = 3
+	DefaultInterval = 5 * time.Second // Between reachability attempts, rides out short network blips
+	dialTimeout     = 3 * time.Second
+	statTimeout     = 5 * time.Second
+)
+
+// Mount is an AutoNFS mount to check
+type Mount struct {
+	Path string // Mount point
+	Unit string // Unit name without suffix, as generated by apply
+}
+
+// Problem is a mount found stale
+type Problem struct {
+	Mount
+	Server string
+	Reason string
+}
+
+// Checker inspects and recovers mounts
+type Checker struct {
+	MountInfo string
+	Port      int           // NFS port probed on the server
+	Attempts  int           // Reachability attempts before a server counts as gone
+	Interval  time.Duration // Between attempts
+
+	Dial   func(addr string) error
+	Stat   func(path string) error
+	Runner runner.Runner
+}
+
+// New returns a checker for the running system
+func New() *Checker {
+	return &Checker{
+		MountInfo: mountinfo.DefaultFile,
+		Port:      2049,
+		Attempts:  DefaultAttempts,
+		Interval:  DefaultInterval,
+		Dial: func(addr string) error {
+			conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+		Stat:   statWithTimeout,
+		Runner: runner.Exec{},
+	}
+}
+
+// Check returns the mounted mounts whose server is unreachable or that
+// answer with a stale file handle. Mounts that are not mounted are fine:
+// their automount wakes the server on the next access.
+func (c *Checker) Check(mounts []Mount) ([]Problem, error) {
+	nfs, err := mountinfo.NFSMounts(c.MountInfo)
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	for _, m := range mounts {
+		mi, ok := nfs[m.Path]
+		if !ok {
+			continue
+		}
+		server := mi.Server()
+		// Never stat a mount whose server is gone: on a hard mount that hangs for good
+		if err := c.reachable(server); err != nil {
+			problems = append(problems, Problem{Mount: m, Server: server, Reason: fmt.Sprintf("server unreachable: %v", err)})
+			continue
+		}
+		if err := c.Stat(m.Path); err != nil {
+			if errors.Is(err, syscall.ESTALE) {
+				problems = append(problems, Problem{Mount: m, Server: server, Reason: "stale file handle"})
+			} else if errors.Is(err, os.ErrDeadlineExceeded) {
+				problems = append(problems, Problem{Mount: m, Server: server, Reason: "not responding"})
+			} else {
+				slog.Debug("Stat failed", "mount", m.Path, "error", err)
+			}
+		}
+	}
+	return problems, nil
+}
+
+func (c *Checker) reachable(server string) error {
+	addr := net.JoinHostPort(server, fmt.Sprint(c.Port))
+	var err error
+	for i := 0; i < max(c.Attempts, 1); i++ {
+		if i > 0 {
+			time.Sleep(c.Interval)
+		}
+		if err = c.Dial(addr); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Recover drops a stale mount (forced, lazily if that fails) and restarts
+// its automount
+func (c *Checker) Recover(p Problem) error {
+	if err := c.Runner.RunCommand("umount", "-f", p.Path); err != nil {
+		slog.Warn("Forced unmount failed, unmounting lazily", "mount", p.Path, "error", err)
+		if err := c.Runner.RunCommand("umount", "-l", p.Path); err != nil {
+			return err
+		}
+	}
+	// The mount unit may be left failed, which would keep the automount from triggering
+	c.Runner.RunCommand("systemctl", "reset-failed", p.Unit+".mount")
+	return c.Runner.RunCommand("systemctl", "restart", p.Unit+".automount")
+}
+
+// statWithTimeout stats path, giving up after statTimeout. A stat stuck in
+// the kernel leaves its goroutine behind, the command exits soon anyway.
+func statWithTimeout(path string) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := os.Stat(path)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(statTimeout):
+		return os.ErrDeadlineExceeded
+	}
+}
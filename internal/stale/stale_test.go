@@ -0,0 +1,71 @@
+package stale
+
+import (
+	"autonfs/internal/runner/runnertest"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCheckRecover(t *testing.T) {
+	info := filepath.Join(t.TempDir(), "mountinfo")
+	os.WriteFile(info, []byte(`40 22 0:35 / /mnt/data rw - autofs systemd-1 rw
+41 40 0:42 / /mnt/data rw - nfs4 192.168.1.100:/data rw
+42 22 0:36 / /mnt/media rw - nfs4 192.168.1.101:/media rw
+43 22 0:37 / /mnt/ok rw - nfs4 192.168.1.102:/ok rw
+44 22 0:38 / /mnt/idle rw - autofs systemd-1 rw
+`), 0644)
+
+	var dials, stats []string
+	cmds := &runnertest.Recorder{Fail: map[string]bool{"umount -f /mnt/data": true}}
+	c := &Checker{
+		MountInfo: info,
+		Port:      2049,
+		Attempts:  2,
+		Dial: func(addr string) error {
+			dials = append(dials, addr)
+			if addr == "192.168.1.100:2049" {
+				return errors.New("no route to host")
+			}
+			return nil
+		},
+		Stat: func(path string) error {
+			stats = append(stats, path)
+			if path == "/mnt/media" {
+				return &fs.PathError{Op: "stat", Path: path, Err: syscall.ESTALE}
+			}
+			return nil
+		},
+		Runner: cmds,
+	}
+	mounts := []Mount{
+		{Path: "/mnt/data", Unit: "mnt-data"},
+		{Path: "/mnt/media", Unit: "mnt-media"},
+		{Path: "/mnt/ok", Unit: "mnt-ok"},
+		{Path: "/mnt/idle", Unit: "mnt-idle"},
+	}
+	problems, err := c.Check(mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 || problems[0].Path != "/mnt/data" || !strings.Contains(problems[0].Reason, "unreachable") ||
+		problems[1].Path != "/mnt/media" || problems[1].Reason != "stale file handle" {
+		t.Fatalf("problems %+v", problems)
+	}
+	// The unreachable server is retried, its mount never stat'ed
+	if len(dials) != 4 || strings.Join(stats, ",") != "/mnt/media,/mnt/ok" {
+		t.Errorf("dials %v, stats %v", dials, stats)
+	}
+
+	if err := c.Recover(problems[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := "umount -f /mnt/data|umount -l /mnt/data|systemctl reset-failed mnt-data.mount|systemctl restart mnt-data.automount"
+	if got := cmds.Commands(); got != want {
+		t.Errorf("recovery commands %v", got)
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"text/template"
 )
 
-// We define four core templates:
+// We define five core templates:
 // 1. Client Mount: Defines NFS mount parameters and Wake-on-LAN hook (ExecStartPre)
 // 2. Client Automount: Defines on-demand mount behavior
 // 3. Server Service: Defines the idle watcher service
-// 4. Server Exports: Defines NFS export configuration
+// 4. Server Watcher Config: Defines watcher settings, reloaded without restart
+// 5. Server Exports: Defines NFS export configuration
+// 6. Client Sleep Hook: Unmounts before suspend/hibernate, re-arms on resume
+// 7. Client Stale Check: Timer dropping hung mounts of servers that went away
+// 8. Client Agent: Runs wakes and the sleep hook, unmounts idle mounts
+// 9. Client Jobs: Timers running scheduled commands through autonfs run
 
 const ClientMountTmpl = `[Unit]
 Description=AutoNFS Mount for {{.RemoteDir}}
@@ -20,8 +25,11 @@ What={{.ServerIP}}:{{.RemoteDir}}
 Where={{.LocalDir}}
 Type=nfs
 Options={{.MountOptions}}
-# Critical: Wake up host before mount, set 10s timeout to avoid blocking indefinitely
-ExecStartPre={{.BinaryPath}} wake --mac "{{.MacAddr}}" --ip "{{.ServerIP}}" --port 2049 --timeout 10s
+# Critical: Wake up host before mount. TimeoutSec covers the wake and the NFS mount,
+# so it must exceed the wake timeout or systemd kills the wake mid-boot.
+# The ready check waits for nfsd and the export itself, not just an open port.
+TimeoutSec={{.MountTimeout}}
+ExecStartPre={{.BinaryPath}} wake --mac "{{.MacAddr}}" --ip "{{.ServerIP}}" --port 2049 --timeout {{.WakeTimeout}} --ready {{.ReadyCheck}} --export "{{.RemoteDir}}"{{if .ReadySettle}} --settle {{.ReadySettle}}{{end}}{{if .WakeBackoff}} --backoff {{.WakeBackoff}}{{end}}{{range .ExtraMACs}} --mac "{{.}}"{{end}}{{if .Broadcast}} --bcast {{.Broadcast}}{{end}}{{if .WolInterface}} --interface {{.WolInterface}}{{end}}{{range .WolPorts}} --wol-port {{.}}{{end}}{{if .WolInterval}} --resend {{.WolInterval}}{{end}}{{if .WolRaw}} --raw{{end}}{{if .WakeRelay}} --relay "{{.WakeRelay}}"{{end}}{{if .SecureOnFile}} --secureon-file {{.SecureOnFile}}{{end}}{{if .PowerConfig}} --power-config {{.PowerConfig}}{{end}}{{range .WakeSubnets}} --subnet {{.}}{{end}}{{range .GatewayMACs}} --gateway-mac {{.}}{{end}}{{range .Reachable}} --reachable {{.}}{{end}}{{if .NoBattery}} --no-battery{{end}}{{if .Alias}} --name "{{.Alias}}"{{end}} --mount "{{.LocalDir}}" --unit %n{{if .AgentSocket}} --agent {{.AgentSocket}}{{end}}
 `
 
 // Note: [Install] section removed from Mount unit to prevent enabling it directly.
@@ -30,6 +38,8 @@ ExecStartPre={{.BinaryPath}} wake --mac "{{.MacAddr}}" --ip "{{.ServerIP}}" --po
 const ClientAutomountTmpl = `[Unit]
 Description=Automount for {{.LocalDir}}
 
+# An automount has no start timeout of its own: first access blocks until the
+# mount unit succeeds or hits its TimeoutSec, so wake_timeout is not set here.
 [Automount]
 Where={{.LocalDir}}
 TimeoutIdleSec={{.IdleTimeout}}
@@ -38,13 +48,96 @@ TimeoutIdleSec={{.IdleTimeout}}
 WantedBy=multi-user.target
 `
 
+// ClientSleepTmpl is pulled in by sleep.target: ExecStart runs before the
+// suspend, ExecStop once sleep.target stops again after resume. A failing
+// ExecStart cancels the suspend, so failures are only kept for block mounts.
+const ClientSleepTmpl = `[Unit]
+Description=AutoNFS unmount before sleep
+Before=sleep.target
+StopWhenUnneeded=yes
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+TimeoutSec=120
+ExecStart={{if not .SleepBlock}}-{{end}}{{.BinaryPath}} sleep-hook pre{{range .SleepMounts}} --{{.Policy}} "{{.Path}}"{{end}}{{if .AgentSocket}} --agent {{.AgentSocket}}{{end}}
+ExecStop=-{{.BinaryPath}} sleep-hook post{{range .SleepMounts}} --{{.Policy}} "{{.Path}}"{{end}}{{if .AgentSocket}} --agent {{.AgentSocket}}{{end}}
+
+[Install]
+RequiredBy=sleep.target
+`
+
+const ClientStaleServiceTmpl = `[Unit]
+Description=AutoNFS stale mount check
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart={{.BinaryPath}} stale --recover{{range .StaleMounts}} "{{.}}"{{end}}
+`
+
+const ClientStaleTimerTmpl = `[Unit]
+Description=AutoNFS stale mount check
+
+[Timer]
+OnBootSec={{.StaleInterval}}
+OnUnitInactiveSec={{.StaleInterval}}
+
+[Install]
+WantedBy=timers.target
+`
+
+const ClientAgentServiceTmpl = `[Unit]
+Description=AutoNFS Client Agent
+After=network-online.target
+
+[Service]
+Type=simple
+ExecStart={{.BinaryPath}} agent --config /etc/autonfs/agent.yaml
+Restart=always
+RestartSec=10
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const ClientAgentConfigTmpl = `# Generated by autonfs apply.
+{{.AgentConfig}}`
+
+// ClientJobServiceTmpl runs a job with its host held awake. JobCommand is
+// quoted for systemd by the deployer. Jobs like backups run for hours.
+const ClientJobServiceTmpl = `[Unit]
+Description=AutoNFS job {{.JobName}} on {{.Alias}}
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+TimeoutStartSec=infinity
+ExecStart={{.BinaryPath}} run{{if .JobHold}} --hold {{.JobHold}}{{end}} "{{.Alias}}" -- /bin/sh -c {{.JobCommand}}
+`
+
+const ClientJobTimerTmpl = `[Unit]
+Description=AutoNFS job {{.JobName}} on {{.Alias}}
+
+[Timer]
+OnCalendar={{.JobSchedule}}
+# Catch up on a run missed while the client was off or asleep
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`
+
 const ServerServiceTmpl = `[Unit]
 Description=AutoNFS Idle Watcher
 After=network.target nfs-server.service
 
 [Service]
 Type=simple
-ExecStart={{.BinaryPath}} watch --timeout {{.IdleTimeout}} --load {{.LoadThreshold}}{{if .WatcherDryRun}} --dry-run{{end}}{{if .ShutdownCmd}} --shutdown-cmd "{{.ShutdownCmd}}"{{end}}
+ExecStart={{.BinaryPath}} watch --config /etc/autonfs/watcher.yaml
+# Settings changes are applied via SIGHUP, keeping the idle countdown
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=always
 RestartSec=10
 
@@ -52,6 +145,9 @@ RestartSec=10
 WantedBy=multi-user.target
 `
 
+const ServerWatcherConfigTmpl = `# Generated by autonfs apply. Reloaded on SIGHUP (systemctl reload autonfs-watcher).
+{{.WatcherConfig}}`
+
 const ServerExportsTmpl = `{{range .Exports}}
 {{.Path}} {{.ClientIP}}(rw,sync,no_subtree_check,no_root_squash)
 {{end}}`
@@ -62,6 +158,12 @@ type ExportInfo struct {
 	ClientIP string
 }
 
+// SleepMount is a mount handled by the sleep hook
+type SleepMount struct {
+	Path   string
+	Policy string // Busy policy: lazy, skip, block
+}
+
 // Config defines variables for template rendering
 type Config struct {
 	ServerIP      string
@@ -72,11 +174,37 @@ type Config struct {
 	BinaryPath    string
 	IdleTimeout   string
 	WakeTimeout   string
-	LoadThreshold string
-	WatcherDryRun bool
-	ShutdownCmd   string       // New field
+	MountTimeout  string       // Mount unit TimeoutSec, in seconds
+	ReadyCheck    string       // wake --ready strategy
+	ReadySettle   string       // wake --settle delay, empty for none
+	WakeBackoff   string       // wake --backoff window after a failed wake, empty for none
+	ExtraMACs     []string     // Additional WoL MACs (bonded NICs)
+	Broadcast     string       // WoL target, e.g. subnet-directed broadcast
+	WolInterface  string       // Send WoL only on this interface
+	WolPorts      []int        // WoL UDP ports, empty for wake's default
+	WolInterval   string       // WoL resend interval, empty for wake's default
+	WolRaw        bool         // Send raw Ethernet WoL frames
+	WakeRelay     string       // SSH alias sending WoL on the server's LAN
+	SecureOnFile  string       // Root-only file with the SecureOn password (never the password itself)
+	PowerConfig   string       // Root-only power backend config, empty for WoL
+	WakeSubnets   []string     // Wake policy: client subnets
+	GatewayMACs   []string     // Wake policy: default gateway MACs
+	Reachable     []string     // Wake policy: host:port pre-checks
+	NoBattery     bool         // Wake policy: not on battery
+	Alias         string       // Host alias, names the host in the wake journal
 	MountOptions  string       // New field
 	Exports       []ExportInfo // New field for multi-export
+	WatcherConfig string       // Rendered watcher YAML body
+	SleepMounts   []SleepMount // Mounts unmounted before sleep
+	SleepBlock    bool         // A busy mount may cancel the suspend
+	StaleMounts   []string     // Mount points checked for a vanished server
+	StaleInterval string       // Stale check interval, in seconds
+	AgentConfig   string       // Rendered client agent YAML body
+	AgentSocket   string       // Client agent socket, wakes and the sleep hook go through the agent when set
+	JobName       string       // Scheduled job
+	JobSchedule   string       // Job OnCalendar expression
+	JobCommand    string       // Job shell command, quoted for ExecStart
+	JobHold       string       // Job hold lease, empty for run's default
 }
 
 // Render helper function
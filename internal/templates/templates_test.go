@@ -14,7 +14,22 @@ func TestRender(t *testing.T) {
 		LocalDir:      "/mnt/data",
 		BinaryPath:    "/usr/bin/autonfs",
 		IdleTimeout:   "10m",
-		LoadThreshold: "0.8",
+		WakeTimeout:   "1m30s",
+		MountTimeout:  "120",
+		ReadyCheck:    "auto",
+		ReadySettle:   "5s",
+		WakeBackoff:   "1m0s",
+		ExtraMACs:     []string{"AA:BB:CC:DD:EE:00"},
+		Broadcast:     "192.168.1.255",
+		WolPorts:      []int{9, 7},
+		WolRaw:        true,
+		WakeRelay:     "pi",
+		PowerConfig:   "/etc/autonfs/power/nas.yaml",
+		WakeSubnets:   []string{"192.168.1.0/24"},
+		Reachable:     []string{"192.168.1.1:53"},
+		NoBattery:     true,
+		Alias:         "nas",
+		WatcherConfig: "idle_timeout: 10m0s\nload_threshold: 0.8\n",
 		Exports: []ExportInfo{
 			{Path: "/data", ClientIP: "192.168.1.100"},
 		},
@@ -35,6 +50,11 @@ func TestRender(t *testing.T) {
 				"What=192.168.1.50:/data",
 				"Where=/mnt/data",
 				"ExecStartPre=/usr/bin/autonfs wake --mac \"AA:BB:CC:DD:EE:FF\" --ip \"192.168.1.50\"",
+				"--timeout 1m30s",
+				"TimeoutSec=120",
+				"--ready auto --export \"/data\" --settle 5s --backoff 1m0s",
+				"--mac \"AA:BB:CC:DD:EE:00\" --bcast 192.168.1.255 --wol-port 9 --wol-port 7 --raw --relay \"pi\"",
+				"--power-config /etc/autonfs/power/nas.yaml --subnet 192.168.1.0/24 --reachable 192.168.1.1:53 --no-battery --name \"nas\" --mount \"/mnt/data\" --unit %n",
 			},
 		},
 		{
@@ -42,7 +62,17 @@ func TestRender(t *testing.T) {
 			tmplName: "service",
 			tmpl:     ServerServiceTmpl,
 			want: []string{
-				"ExecStart=/usr/bin/autonfs watch --timeout 10m --load 0.8",
+				"ExecStart=/usr/bin/autonfs watch --config /etc/autonfs/watcher.yaml",
+				"ExecReload=/bin/kill -HUP $MAINPID",
+			},
+		},
+		{
+			name:     "ServerWatcherConfig",
+			tmplName: "watcher",
+			tmpl:     ServerWatcherConfigTmpl,
+			want: []string{
+				"idle_timeout: 10m0s",
+				"load_threshold: 0.8",
 			},
 		},
 		{
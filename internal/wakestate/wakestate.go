@@ -0,0 +1,174 @@
+// Package wakestate coordinates wakes of the same server from several
+// processes: each mount unit runs its own `autonfs wake`, but only one of
+// them sends packets and polls, the others wait for and share its result.
+package wakestate
+
+import (
+	"autonfs/internal/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// DefaultDir holds the per-host lock and result files
+const DefaultDir = "/run/autonfs"
+
+// pollInterval is how often a waiting process retries the lock
+var pollInterval = 200 * time.Millisecond
+
+// ErrNoLock means the lock could not be set up, e.g. Dir is not writable
+var ErrNoLock = errors.New("wake lock unavailable")
+
+// Result is the outcome of the last wake of a host
+type Result struct {
+	Host     string    `json:"host"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Ready    string    `json:"ready,omitempty"` // Readiness level reached
+	Error    string    `json:"error,omitempty"` // Empty on success
+}
+
+// OK reports whether the wake succeeded
+func (r Result) OK() bool {
+	return r.Error == ""
+}
+
+// Coordinator serializes wakes of one host through a lock file in Dir
+type Coordinator struct {
+	Dir  string
+	Host string // Server address or alias, used in file names
+}
+
+// New returns a Coordinator for host under dir (DefaultDir if empty)
+func New(dir, host string) *Coordinator {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	return &Coordinator{Dir: dir, Host: host}
+}
+
+func (c *Coordinator) lockPath() string {
+	return filepath.Join(c.Dir, "wake-"+config.AliasFileName(c.Host)+".lock")
+}
+
+func (c *Coordinator) resultPath() string {
+	return filepath.Join(c.Dir, "wake-"+config.AliasFileName(c.Host)+".json")
+}
+
+// Run calls wake unless another process is already waking the host. In that
+// case it waits for the running wake and returns its result instead, with
+// shared set. A failed shared wake is returned as an error too.
+func (c *Coordinator) Run(ctx context.Context, wake func(context.Context) (string, error)) (res Result, shared bool, err error) {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return Result{}, false, fmt.Errorf("%w: %v", ErrNoLock, err)
+	}
+	f, err := os.OpenFile(c.lockPath(), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return Result{}, false, fmt.Errorf("%w: %v", ErrNoLock, err)
+	}
+	defer f.Close() // Also releases the lock
+
+	joined := time.Now()
+	locked, err := tryLock(f)
+	if err != nil {
+		return Result{}, false, err
+	}
+	if !locked {
+		if err := waitLock(ctx, f); err != nil {
+			return Result{}, false, fmt.Errorf("waiting for concurrent wake of %s: %v", c.Host, err)
+		}
+		// The wake we waited for finished after we arrived: share its outcome
+		if last, err := c.Last(); err == nil && last.Finished.After(joined) {
+			if !last.OK() {
+				return *last, true, fmt.Errorf("concurrent wake failed: %s", last.Error)
+			}
+			return *last, true, nil
+		}
+		// Its owner died without a result, take over
+	}
+
+	res = Result{Host: c.Host, Started: time.Now()}
+	res.Ready, err = wake(ctx)
+	res.Finished = time.Now()
+	if err != nil {
+		res.Error = err.Error()
+	}
+	// Without a result file waiters take over and wake again, not fatal
+	c.write(res)
+	return res, false, err
+}
+
+// Last returns the result of the last completed wake
+func (c *Coordinator) Last() (*Result, error) {
+	data, err := os.ReadFile(c.resultPath())
+	if err != nil {
+		return nil, err
+	}
+	var r Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid wake state %s: %v", c.resultPath(), err)
+	}
+	return &r, nil
+}
+
+// RecentFailure returns the last wake if it failed less than window ago
+func (c *Coordinator) RecentFailure(window time.Duration) (*Result, bool) {
+	if window <= 0 {
+		return nil, false
+	}
+	last, err := c.Last()
+	if err != nil || last.OK() || time.Since(last.Finished) >= window {
+		return nil, false
+	}
+	return last, true
+}
+
+// write replaces the result file atomically
+func (c *Coordinator) write(r Result) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := c.resultPath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %s: %v", ErrNoLock, f.Name(), err)
+}
+
+// waitLock polls instead of blocking in flock, so the wait follows ctx
+func waitLock(ctx context.Context, f *os.File) error {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		locked, err := tryLock(f)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+	}
+}
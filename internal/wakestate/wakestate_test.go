@@ -0,0 +1,138 @@
+package wakestate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	pollInterval = 5 * time.Millisecond
+}
+
+func TestRun_SharesConcurrentWake(t *testing.T) {
+	for _, wakeErr := range []error{nil, errors.New("port 2049 not reachable")} {
+		c := New(t.TempDir(), "192.168.1.50")
+		var calls atomic.Int32
+		release := make(chan struct{})
+		wake := func(ctx context.Context) (string, error) {
+			calls.Add(1)
+			<-release
+			return "exports", wakeErr
+		}
+
+		var wg sync.WaitGroup
+		results := make([]Result, 3)
+		shared := make([]bool, 3)
+		errs := make([]error, 3)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], shared[i], errs[i] = c.Run(context.Background(), wake)
+			}(i)
+		}
+		// Let every process arrive before the leader finishes
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("wake ran %d times, want 1", n)
+		}
+		nShared := 0
+		for i := range results {
+			if shared[i] {
+				nShared++
+			}
+			if (errs[i] != nil) != (wakeErr != nil) {
+				t.Errorf("process %d: err = %v, want failure %v", i, errs[i], wakeErr != nil)
+			}
+			if wakeErr == nil && results[i].Ready != "exports" {
+				t.Errorf("process %d: ready = %q", i, results[i].Ready)
+			}
+		}
+		if nShared != 2 {
+			t.Errorf("%d shared results, want 2", nShared)
+		}
+	}
+}
+
+func TestRun_SequentialWakesRunAgain(t *testing.T) {
+	c := New(t.TempDir(), "nas")
+	calls := 0
+	wake := func(ctx context.Context) (string, error) {
+		calls++
+		return "tcp", nil
+	}
+	for i := 0; i < 2; i++ {
+		if _, shared, err := c.Run(context.Background(), wake); err != nil || shared {
+			t.Fatalf("run %d: shared=%v err=%v", i, shared, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("wake ran %d times, want 2", calls)
+	}
+	last, err := c.Last()
+	if err != nil || !last.OK() || last.Host != "nas" {
+		t.Errorf("unexpected last result %+v, %v", last, err)
+	}
+}
+
+func TestRun_WaitFollowsContext(t *testing.T) {
+	c := New(t.TempDir(), "nas")
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go c.Run(context.Background(), func(ctx context.Context) (string, error) {
+		close(started)
+		<-release
+		return "", nil
+	})
+	defer close(release)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.Run(ctx, func(ctx context.Context) (string, error) {
+		t.Error("second wake must not run")
+		return "", nil
+	}); err == nil {
+		t.Error("expected error when the context expires while waiting")
+	}
+}
+
+func TestRun_NoLock(t *testing.T) {
+	c := New("/proc/autonfs-test", "nas")
+	if _, _, err := c.Run(context.Background(), nil); !errors.Is(err, ErrNoLock) {
+		t.Errorf("expected ErrNoLock, got %v", err)
+	}
+}
+
+func TestRecentFailure(t *testing.T) {
+	c := New(t.TempDir(), "nas")
+	if _, ok := c.RecentFailure(time.Minute); ok {
+		t.Fatal("no wake yet, no failure")
+	}
+	c.Run(context.Background(), func(ctx context.Context) (string, error) {
+		return "", errors.New("timeout")
+	})
+	if last, ok := c.RecentFailure(time.Minute); !ok || last.Error != "timeout" {
+		t.Errorf("expected recent failure, got %+v %v", last, ok)
+	}
+	if _, ok := c.RecentFailure(0); ok {
+		t.Error("zero window disables the back-off")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.RecentFailure(10 * time.Millisecond); ok {
+		t.Error("failure outside the window")
+	}
+
+	// A successful (e.g. forced) wake clears it
+	c.Run(context.Background(), func(ctx context.Context) (string, error) { return "tcp", nil })
+	if _, ok := c.RecentFailure(time.Minute); ok {
+		t.Error("success must clear the back-off")
+	}
+}
@@ -0,0 +1,257 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Adaptive timeout defaults
+const (
+	DefaultAdaptiveStateFile = "/var/lib/autonfs/adaptive.json"
+	defaultShortOff          = 15 * time.Minute
+	defaultAdaptiveFactor    = 1.5
+	defaultHalfLife          = 24 * time.Hour
+	maxHistory               = 50
+)
+
+// AdaptiveConfig widens the idle timeout when the server is woken again shortly after a shutdown
+type AdaptiveConfig struct {
+	Enabled   bool          `yaml:"enabled,omitempty"`
+	Min       time.Duration `yaml:"min,omitempty"`        // Lower bound, default idle_timeout
+	Max       time.Duration `yaml:"max,omitempty"`        // Upper bound, default 4x idle_timeout
+	ShortOff  time.Duration `yaml:"short_off,omitempty"`  // Off periods shorter than this count as flapping, default 15m
+	Factor    float64       `yaml:"factor,omitempty"`     // Widening factor per flap, default 1.5
+	HalfLife  time.Duration `yaml:"half_life,omitempty"`  // Decay back towards idle_timeout, default 24h
+	StateFile string        `yaml:"state_file,omitempty"` // History file, default /var/lib/autonfs/adaptive.json
+}
+
+func (c AdaptiveConfig) validate() error {
+	if c.Min < 0 || c.Max < 0 || c.ShortOff < 0 || c.HalfLife < 0 {
+		return fmt.Errorf("adaptive durations must not be negative")
+	}
+	if c.Max > 0 && c.Min > c.Max {
+		return fmt.Errorf("adaptive min (%s) exceeds max (%s)", c.Min, c.Max)
+	}
+	if c.Factor != 0 && c.Factor < 1 {
+		return fmt.Errorf("adaptive factor must be >= 1")
+	}
+	return nil
+}
+
+func (c AdaptiveConfig) withDefaults(base time.Duration) AdaptiveConfig {
+	if c.Min == 0 {
+		c.Min = base
+	}
+	if c.Max == 0 {
+		c.Max = 4 * base
+	}
+	if c.Max < c.Min {
+		c.Max = c.Min
+	}
+	if c.ShortOff == 0 {
+		c.ShortOff = defaultShortOff
+	}
+	if c.Factor == 0 {
+		c.Factor = defaultAdaptiveFactor
+	}
+	if c.HalfLife == 0 {
+		c.HalfLife = defaultHalfLife
+	}
+	return c
+}
+
+// bootRecord is one boot of the server as seen by the watcher
+type bootRecord struct {
+	At         time.Time     `json:"at"`
+	OffFor     time.Duration `json:"off_for,omitempty"` // Since the previous shutdown, 0 if unknown
+	WakeReason string        `json:"wake_reason,omitempty"`
+}
+
+// adaptiveHistory is the persisted adaptive state
+type adaptiveHistory struct {
+	Timeout   time.Duration `json:"timeout,omitempty"` // Widened timeout as of UpdatedAt
+	UpdatedAt time.Time     `json:"updated_at,omitzero"`
+	Reason    string        `json:"reason,omitempty"`
+	Shutdowns []time.Time   `json:"shutdowns,omitempty"`
+	Boots     []bootRecord  `json:"boots,omitempty"`
+}
+
+// adaptiveState keeps the shutdown/boot history and computes the effective timeout
+type adaptiveState struct {
+	path        string
+	hist        adaptiveHistory
+	pendingWake bool          // Waiting for the first activity after boot
+	lastLogged  time.Duration // Last effective timeout that was logged
+}
+
+// loadAdaptive reads the history from path (if any)
+func loadAdaptive(path string) *adaptiveState {
+	a := &adaptiveState{path: path}
+	if path == "" {
+		return a
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Read adaptive history failed", "path", path, "error", err)
+		}
+		return a
+	}
+	if err := json.Unmarshal(data, &a.hist); err != nil {
+		slog.Warn("Invalid adaptive history, starting fresh", "path", path, "error", err)
+		a.hist = adaptiveHistory{}
+	}
+	return a
+}
+
+func (a *adaptiveState) save() {
+	if a.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(a.hist, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		slog.Warn("Save adaptive history failed", "error", err)
+		return
+	}
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		slog.Warn("Save adaptive history failed", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		slog.Warn("Save adaptive history failed", "error", err)
+	}
+}
+
+// effective returns the adaptive idle timeout at now for base timeout
+func (a *adaptiveState) effective(cfg AdaptiveConfig, base time.Duration, now time.Time) time.Duration {
+	cfg = cfg.withDefaults(base)
+	eff := base
+	if a.hist.Timeout > base {
+		// Exponential decay of the widening towards base
+		elapsed := now.Sub(a.hist.UpdatedAt)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		extra := float64(a.hist.Timeout - base)
+		eff = base + time.Duration(extra*math.Pow(0.5, float64(elapsed)/float64(cfg.HalfLife)))
+	}
+	return clampDuration(eff, cfg.Min, cfg.Max).Round(time.Second)
+}
+
+// recordShutdown remembers a shutdown about to happen
+func (a *adaptiveState) recordShutdown(now time.Time) {
+	a.hist.Shutdowns = appendBounded(a.hist.Shutdowns, now)
+	a.save()
+}
+
+// recordBoot registers a boot at bootAt and widens the timeout if the
+// server was only off for a short time
+func (a *adaptiveState) recordBoot(cfg AdaptiveConfig, base time.Duration, bootAt, now time.Time) {
+	cfg = cfg.withDefaults(base)
+	if n := len(a.hist.Boots); n > 0 {
+		if d := bootAt.Sub(a.hist.Boots[n-1].At); d > -time.Minute && d < time.Minute {
+			// Same boot, the watcher was merely restarted
+			a.pendingWake = a.hist.Boots[n-1].WakeReason == ""
+			return
+		}
+	}
+
+	rec := bootRecord{At: bootAt}
+	if n := len(a.hist.Shutdowns); n > 0 {
+		last := a.hist.Shutdowns[n-1]
+		// Only a shutdown after the previous boot belongs to this off period
+		if bn := len(a.hist.Boots); bootAt.After(last) && (bn == 0 || last.After(a.hist.Boots[bn-1].At)) {
+			rec.OffFor = bootAt.Sub(last)
+		}
+	}
+
+	if rec.OffFor > 0 && rec.OffFor < cfg.ShortOff {
+		cur := a.effective(cfg, base, now)
+		widened := clampDuration(time.Duration(float64(cur)*cfg.Factor), cfg.Min, cfg.Max).Round(time.Second)
+		a.hist.Timeout = widened
+		a.hist.UpdatedAt = now
+		a.hist.Reason = fmt.Sprintf("woken after only %s off (< %s)", rec.OffFor.Round(time.Second), cfg.ShortOff)
+		slog.Info("Adaptive idle timeout widened", "from", cur, "to", widened, "reason", a.hist.Reason)
+	}
+
+	a.hist.Boots = appendBounded(a.hist.Boots, rec)
+	a.pendingWake = true
+	a.save()
+}
+
+// recordWakeReason stores the first activity seen after boot
+func (a *adaptiveState) recordWakeReason(reason string) {
+	if !a.pendingWake || len(a.hist.Boots) == 0 {
+		return
+	}
+	a.pendingWake = false
+	a.hist.Boots[len(a.hist.Boots)-1].WakeReason = reason
+	a.save()
+}
+
+// reason explains the current effective timeout
+func (a *adaptiveState) reason(eff, base time.Duration) string {
+	if eff <= base || a.hist.Reason == "" {
+		return "base idle_timeout"
+	}
+	return fmt.Sprintf("%s (since %s, decaying)", a.hist.Reason, a.hist.UpdatedAt.Format(time.DateTime))
+}
+
+// logIfChanged logs the effective timeout when it moved by at least a minute
+func (a *adaptiveState) logIfChanged(eff, base time.Duration) {
+	diff := eff - a.lastLogged
+	if diff < 0 {
+		diff = -diff
+	}
+	if a.lastLogged != 0 && diff < time.Minute {
+		return
+	}
+	a.lastLogged = eff
+	slog.Info("Adaptive idle timeout", "effective", eff, "base", base, "reason", a.reason(eff, base))
+}
+
+func clampDuration(d, lo, hi time.Duration) time.Duration {
+	if d < lo {
+		return lo
+	}
+	if hi > 0 && d > hi {
+		return hi
+	}
+	return d
+}
+
+func appendBounded[T any](s []T, v T) []T {
+	s = append(s, v)
+	if len(s) > maxHistory {
+		s = s[len(s)-maxHistory:]
+	}
+	return s
+}
+
+// bootTime derives the boot time from /proc/uptime, falling back to now
+func (m *Monitor) bootTime(now time.Time) time.Time {
+	data, err := m.OS.ReadFile(m.ProcUptime)
+	if err != nil {
+		return now
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return now
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return now
+	}
+	return now.Add(-time.Duration(secs * float64(time.Second))).Truncate(time.Second)
+}
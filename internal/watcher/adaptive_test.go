@@ -0,0 +1,95 @@
+package watcher
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdaptive_WidenAndDecay(t *testing.T) {
+	cfg := AdaptiveConfig{Enabled: true, Max: 60 * time.Minute, ShortOff: 15 * time.Minute, Factor: 2, HalfLife: 24 * time.Hour}
+	base := 20 * time.Minute
+	a := loadAdaptive(filepath.Join(t.TempDir(), "adaptive.json"))
+
+	t0 := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	a.recordBoot(cfg, base, t0, t0)
+	if got := a.effective(cfg, base, t0); got != base {
+		t.Fatalf("Initial timeout = %v, want %v", got, base)
+	}
+
+	// Long off period: no change
+	a.recordShutdown(t0.Add(time.Hour))
+	boot := t0.Add(5 * time.Hour)
+	a.recordBoot(cfg, base, boot, boot)
+	if got := a.effective(cfg, base, boot); got != base {
+		t.Errorf("Long off period should not widen, got %v", got)
+	}
+
+	// Woken 3 minutes after shutdown: doubled
+	a.recordShutdown(boot.Add(time.Hour))
+	boot = boot.Add(time.Hour + 3*time.Minute)
+	a.recordBoot(cfg, base, boot, boot)
+	if got := a.effective(cfg, base, boot); got != 40*time.Minute {
+		t.Errorf("Expected widened timeout 40m, got %v", got)
+	}
+	if a.reason(40*time.Minute, base) == "base idle_timeout" {
+		t.Error("Expected the widening reason to be reported")
+	}
+
+	// Flapping again: capped at max
+	a.recordShutdown(boot.Add(time.Hour))
+	boot = boot.Add(time.Hour + 3*time.Minute)
+	a.recordBoot(cfg, base, boot, boot)
+	if got := a.effective(cfg, base, boot); got != 60*time.Minute {
+		t.Errorf("Expected timeout capped at 60m, got %v", got)
+	}
+
+	// One half-life later the extra 40m is halved
+	if got := a.effective(cfg, base, boot.Add(24*time.Hour)); got != 40*time.Minute {
+		t.Errorf("Expected decayed timeout 40m, got %v", got)
+	}
+
+	// Watcher restart within the same boot must not count as a new boot
+	reloaded := loadAdaptive(a.path)
+	reloaded.recordBoot(cfg, base, boot.Add(2*time.Second), boot.Add(10*time.Minute))
+	if n := len(reloaded.hist.Boots); n != 4 {
+		t.Errorf("Expected 4 boots in persisted history, got %d", n)
+	}
+	if got := reloaded.effective(cfg, base, boot); got != 60*time.Minute {
+		t.Errorf("Persisted timeout = %v, want 60m", got)
+	}
+}
+
+func TestMonitor_Poll_AdaptiveStatus(t *testing.T) {
+	dir := t.TempDir()
+	m, fos := newFakeMonitor()
+	fos.files["/proc/uptime"] = "60.00 100.00"
+	m.ShutdownFunc = func() error { return nil }
+
+	// Previous shutdown 2 minutes before this boot
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	statePath := filepath.Join(dir, "adaptive.json")
+	prev := loadAdaptive(statePath)
+	prev.hist.Shutdowns = []time.Time{now.Add(-3 * time.Minute)}
+	prev.save()
+
+	cfg := WatchConfig{
+		IdleTimeout:   10 * time.Minute,
+		LoadThreshold: 0.5,
+		StatusFile:    filepath.Join(dir, "status.json"),
+		Adaptive:      AdaptiveConfig{Enabled: true, StateFile: statePath},
+	}.withDefaults()
+	m.state = watchState{idleStart: now}
+	m.poll(cfg, now)
+
+	st, err := ReadStatus(cfg.StatusFile)
+	if err != nil {
+		t.Fatalf("ReadStatus failed: %v", err)
+	}
+	if st.IdleTimeout != 15*time.Minute || st.BaseTimeout != 10*time.Minute {
+		t.Errorf("Expected adaptive 15m over base 10m, got %+v", st)
+	}
+	if st.State != "idle" || st.TimeoutReason == "" {
+		t.Errorf("Unexpected status: %+v", st)
+	}
+}
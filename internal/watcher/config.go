@@ -0,0 +1,242 @@
+package watcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Activity source names accepted in WatchConfig.Sources
+const (
+	SourceLoad         = "load"
+	SourceNFSv4Clients = "nfsv4_clients"
+	SourceNFSOps       = "nfs_ops"
+	SourceHolds        = "holds"
+)
+
+// DefaultSources are used when WatchConfig.Sources is empty
+var DefaultSources = []string{SourceLoad, SourceNFSv4Clients, SourceNFSOps, SourceHolds}
+
+// DefaultPollInterval is used when WatchConfig.PollInterval is zero
+const DefaultPollInterval = 10 * time.Second
+
+// WatchConfig monitor configuration
+type WatchConfig struct {
+	IdleTimeout   time.Duration  `yaml:"idle_timeout,omitempty"`
+	LoadThreshold float64        `yaml:"load_threshold,omitempty"`
+	PollInterval  time.Duration  `yaml:"poll_interval,omitempty"` // Check interval, default 10s
+	DryRun        bool           `yaml:"dry_run,omitempty"`
+	ShutdownCmd   string         `yaml:"shutdown_cmd,omitempty"` // Custom shutdown command (run via sh -c)
+	Sources       []string       `yaml:"sources,omitempty"`      // Enabled activity sources, default all
+	Probes        []ProbeConfig  `yaml:"probes,omitempty"`       // External activity checks
+	Schedules     []Schedule     `yaml:"schedules,omitempty"`    // Time windows with special behavior
+	Hooks         HooksConfig    `yaml:"hooks,omitempty"`
+	Logging       LoggingConfig  `yaml:"logging,omitempty"`
+	Adaptive      AdaptiveConfig `yaml:"adaptive,omitempty"`
+	StatusFile    string         `yaml:"status_file,omitempty"`  // Publish state here for `autonfs status`
+	JournalFile   string         `yaml:"journal_file,omitempty"` // Append boots and shutdowns here for `autonfs stats`
+	HoldDir       string         `yaml:"hold_dir,omitempty"`     // Keep-awake files (holds source), default DefaultHoldDir
+}
+
+// Schedule defines a recurring time window (local time).
+// Inside the window the server is either kept awake or uses a different idle timeout.
+type Schedule struct {
+	Name        string        `yaml:"name,omitempty"`
+	Days        []string      `yaml:"days,omitempty"` // mon..sun, empty = every day
+	Start       string        `yaml:"start"`          // "HH:MM"
+	End         string        `yaml:"end"`            // "HH:MM", may wrap past midnight
+	KeepAwake   bool          `yaml:"keep_awake,omitempty"`
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+}
+
+// HooksConfig defines shell commands run on state changes
+type HooksConfig struct {
+	OnActive    []string `yaml:"on_active,omitempty"`    // Idle -> Active
+	OnIdle      []string `yaml:"on_idle,omitempty"`      // Active -> Idle
+	PreShutdown []string `yaml:"pre_shutdown,omitempty"` // Non-zero exit vetoes the shutdown
+}
+
+// ParseWatchConfig parses YAML content on top of base.
+// Keys missing from data keep the value from base.
+func ParseWatchConfig(data []byte, base WatchConfig) (WatchConfig, error) {
+	cfg := base
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return WatchConfig{}, fmt.Errorf("failed to parse watcher config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return WatchConfig{}, err
+	}
+	return cfg, nil
+}
+
+// LoadWatchConfig reads and parses a watcher config file on top of base
+func LoadWatchConfig(path string, base WatchConfig) (WatchConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return WatchConfig{}, fmt.Errorf("failed to read watcher config: %v", err)
+	}
+	return ParseWatchConfig(data, base)
+}
+
+// Validate ensures the watcher configuration is valid
+func (c WatchConfig) Validate() error {
+	if c.IdleTimeout < 0 {
+		return fmt.Errorf("idle_timeout must not be negative")
+	}
+	if c.PollInterval < 0 {
+		return fmt.Errorf("poll_interval must not be negative")
+	}
+	for _, s := range c.Sources {
+		switch s {
+		case SourceLoad, SourceNFSv4Clients, SourceNFSOps, SourceHolds:
+		default:
+			return fmt.Errorf("unknown activity source %q", s)
+		}
+	}
+	if err := c.Logging.validate(); err != nil {
+		return err
+	}
+	if err := c.Adaptive.validate(); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, p := range c.Probes {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate probe name %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	for i, s := range c.Schedules {
+		if err := s.validate(); err != nil {
+			return fmt.Errorf("schedule #%d (%s): %v", i, s.Name, err)
+		}
+	}
+	return nil
+}
+
+// withDefaults fills zero values with defaults
+func (c WatchConfig) withDefaults() WatchConfig {
+	if c.PollInterval == 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+	if len(c.Sources) == 0 {
+		c.Sources = DefaultSources
+	}
+	if c.HoldDir == "" {
+		c.HoldDir = DefaultHoldDir
+	}
+	if c.Adaptive.StateFile == "" {
+		c.Adaptive.StateFile = DefaultAdaptiveStateFile
+	}
+	c.Logging = c.Logging.withDefaults()
+	return c
+}
+
+// sourceEnabled reports whether the named activity source is enabled
+func (c WatchConfig) sourceEnabled(name string) bool {
+	for _, s := range c.Sources {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// activeSchedule returns the first schedule matching t, or nil
+func (c WatchConfig) activeSchedule(t time.Time) *Schedule {
+	for i := range c.Schedules {
+		if c.Schedules[i].Contains(t) {
+			return &c.Schedules[i]
+		}
+	}
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseWeekday accepts short or long English day names ("mon", "Monday")
+func parseWeekday(d string) (time.Weekday, bool) {
+	d = strings.ToLower(d)
+	if len(d) > 3 {
+		d = d[:3]
+	}
+	wd, ok := weekdays[d]
+	return wd, ok
+}
+
+func (s Schedule) validate() error {
+	if _, err := parseClock(s.Start); err != nil {
+		return fmt.Errorf("invalid start: %v", err)
+	}
+	if _, err := parseClock(s.End); err != nil {
+		return fmt.Errorf("invalid end: %v", err)
+	}
+	for _, d := range s.Days {
+		if _, ok := parseWeekday(d); !ok {
+			return fmt.Errorf("invalid day %q", d)
+		}
+	}
+	if !s.KeepAwake && s.IdleTimeout <= 0 {
+		return fmt.Errorf("either keep_awake or idle_timeout must be set")
+	}
+	return nil
+}
+
+// Contains reports whether t falls inside the schedule window
+func (s Schedule) Contains(t time.Time) bool {
+	start, err1 := parseClock(s.Start)
+	end, err2 := parseClock(s.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	day := t.Weekday()
+	inWindow := false
+	if start <= end {
+		inWindow = now >= start && now < end
+	} else {
+		// Window wraps past midnight, the morning part belongs to the previous day
+		if now >= start {
+			inWindow = true
+		} else if now < end {
+			inWindow = true
+			day = (day + 6) % 7
+		}
+	}
+	if !inWindow {
+		return false
+	}
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if wd, ok := parseWeekday(d); ok && wd == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses "HH:MM" into a duration since midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,120 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseWatchConfig(t *testing.T) {
+	data := `
+idle_timeout: 20m
+load_threshold: 1.5
+sources: [load, nfsv4_clients]
+schedules:
+  - name: backup
+    days: [mon, Friday]
+    start: "01:00"
+    end: "03:00"
+    keep_awake: true
+hooks:
+  pre_shutdown: ["sync"]
+`
+	base := WatchConfig{IdleTimeout: 30 * time.Minute, LoadThreshold: 0.5, DryRun: true}
+	cfg, err := ParseWatchConfig([]byte(data), base)
+	if err != nil {
+		t.Fatalf("ParseWatchConfig failed: %v", err)
+	}
+	if cfg.IdleTimeout != 20*time.Minute {
+		t.Errorf("Expected idle_timeout 20m, got %v", cfg.IdleTimeout)
+	}
+	if cfg.LoadThreshold != 1.5 {
+		t.Errorf("Expected load_threshold 1.5, got %v", cfg.LoadThreshold)
+	}
+	if !cfg.DryRun {
+		t.Error("Expected dry_run to be kept from base")
+	}
+	if cfg.sourceEnabled(SourceNFSOps) {
+		t.Error("nfs_ops should be disabled")
+	}
+	if len(cfg.Schedules) != 1 || len(cfg.Hooks.PreShutdown) != 1 {
+		t.Errorf("Schedules/Hooks not parsed: %+v", cfg)
+	}
+}
+
+func TestParseWatchConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"unknown key", "idle_timout: 5m"},
+		{"unknown source", "sources: [cpu]"},
+		{"bad schedule time", "schedules: [{start: '25:00', end: '03:00', keep_awake: true}]"},
+		{"schedule without effect", "schedules: [{start: '01:00', end: '03:00'}]"},
+		{"bad day", "schedules: [{days: [someday], start: '01:00', end: '03:00', keep_awake: true}]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseWatchConfig([]byte(tt.yaml), WatchConfig{}); err == nil {
+				t.Errorf("Expected error for %q", tt.yaml)
+			}
+		})
+	}
+}
+
+func TestLoadWatchConfig_Empty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.yaml")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	base := WatchConfig{IdleTimeout: time.Minute}
+	cfg, err := LoadWatchConfig(path, base)
+	if err != nil {
+		t.Fatalf("LoadWatchConfig failed: %v", err)
+	}
+	if cfg.IdleTimeout != time.Minute {
+		t.Errorf("Expected base to be kept, got %v", cfg.IdleTimeout)
+	}
+}
+
+func TestScheduleContains(t *testing.T) {
+	// 2024-01-01 is a Monday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 1, day, hour, min, 0, 0, time.Local)
+	}
+	night := Schedule{Days: []string{"mon"}, Start: "22:00", End: "02:00", KeepAwake: true}
+
+	tests := []struct {
+		name string
+		s    Schedule
+		t    time.Time
+		want bool
+	}{
+		{"inside same day", Schedule{Start: "08:00", End: "18:00"}, at(1, 12, 0), true},
+		{"before window", Schedule{Start: "08:00", End: "18:00"}, at(1, 7, 59), false},
+		{"end is exclusive", Schedule{Start: "08:00", End: "18:00"}, at(1, 18, 0), false},
+		{"wrong day", Schedule{Days: []string{"tue"}, Start: "08:00", End: "18:00"}, at(1, 12, 0), false},
+		{"wrap evening", night, at(1, 23, 0), true},
+		{"wrap morning belongs to previous day", night, at(2, 1, 0), true},
+		{"wrap morning of wrong day", night, at(1, 1, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.s.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchConfig_Defaults(t *testing.T) {
+	cfg := WatchConfig{}.withDefaults()
+	if cfg.Adaptive.StateFile != DefaultAdaptiveStateFile {
+		t.Errorf("Expected adaptive history in %s, got %q", DefaultAdaptiveStateFile, cfg.Adaptive.StateFile)
+	}
+	cfg = WatchConfig{Adaptive: AdaptiveConfig{StateFile: "/tmp/adaptive.json"}}.withDefaults()
+	if cfg.Adaptive.StateFile != "/tmp/adaptive.json" {
+		t.Errorf("Expected state_file to be kept, got %q", cfg.Adaptive.StateFile)
+	}
+}
@@ -0,0 +1,214 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Logging modes accepted in LoggingConfig.Mode
+const (
+	LogModeEvents = "events" // State changes, milestones and periodic summaries only
+	LogModePoll   = "poll"   // One INFO line per poll (legacy)
+)
+
+// Default event logging settings
+var (
+	DefaultSummaryInterval = time.Hour
+	DefaultMilestones      = []time.Duration{10 * time.Minute, 5 * time.Minute, time.Minute}
+)
+
+// LoggingConfig controls how the watcher reports its state
+type LoggingConfig struct {
+	Mode            string          `yaml:"mode,omitempty"`             // events (default) or poll
+	Format          string          `yaml:"format,omitempty"`           // text (default) or json
+	SummaryInterval time.Duration   `yaml:"summary_interval,omitempty"` // events mode, default 1h
+	Milestones      []time.Duration `yaml:"milestones,omitempty"`       // Countdown marks, default 10m, 5m, 1m
+}
+
+func (c LoggingConfig) validate() error {
+	switch c.Mode {
+	case "", LogModeEvents, LogModePoll:
+	default:
+		return fmt.Errorf("unknown logging mode %q", c.Mode)
+	}
+	switch c.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown logging format %q", c.Format)
+	}
+	if c.SummaryInterval < 0 {
+		return fmt.Errorf("summary_interval must not be negative")
+	}
+	for _, ms := range c.Milestones {
+		if ms <= 0 {
+			return fmt.Errorf("milestones must be positive")
+		}
+	}
+	return nil
+}
+
+func (c LoggingConfig) withDefaults() LoggingConfig {
+	if c.Mode == "" {
+		c.Mode = LogModeEvents
+	}
+	if c.Format == "" {
+		c.Format = "text"
+	}
+	if c.SummaryInterval == 0 {
+		c.SummaryInterval = DefaultSummaryInterval
+	}
+	if len(c.Milestones) == 0 {
+		c.Milestones = DefaultMilestones
+	}
+	// Largest first, so they are crossed in order while counting down
+	ms := append([]time.Duration(nil), c.Milestones...)
+	sort.Slice(ms, func(i, j int) bool { return ms[i] > ms[j] })
+	c.Milestones = ms
+	return c
+}
+
+// pollResult is the outcome of one poll, used for reporting
+type pollResult struct {
+	Active   bool
+	Reason   string
+	Load     float64
+	Ops      uint64
+	Clients  []string
+	IdleFor  time.Duration
+	TimeLeft time.Duration
+}
+
+// eventLog tracks what has already been reported in events mode
+type eventLog struct {
+	started     bool
+	active      bool
+	since       time.Time // Start of the current state
+	firstReason string    // First activity reason of the current active period
+	lastReason  string    // Latest activity reason
+	lastSummary time.Time
+	milestone   int // Milestones already reported in the current countdown
+	activePolls int
+	idlePolls   int
+}
+
+// armMilestones re-arms the countdown milestones below timeLeft,
+// e.g. when going idle or after a vetoed or simulated shutdown
+func (e *eventLog) armMilestones(milestones []time.Duration, timeLeft time.Duration) {
+	e.milestone = 0
+	for e.milestone < len(milestones) && milestones[e.milestone] >= timeLeft {
+		e.milestone++
+	}
+}
+
+// report logs one poll result according to the logging mode
+func (m *Monitor) report(cfg LoggingConfig, now time.Time, r pollResult) {
+	e := &m.state.events
+
+	if cfg.Mode == LogModePoll {
+		logPoll(slog.LevelInfo, r)
+		return
+	}
+	logPoll(slog.LevelDebug, r)
+
+	if !e.started || r.Active != e.active {
+		m.reportChange(cfg, now, r)
+	} else if r.Active {
+		if r.Reason != e.lastReason {
+			slog.Debug("Activity reason changed", "reason", r.Reason, "previous", e.lastReason)
+		}
+		e.lastReason = r.Reason
+	} else {
+		m.reportMilestones(cfg, r)
+	}
+
+	if r.Active {
+		e.activePolls++
+	} else {
+		e.idlePolls++
+	}
+
+	if now.Sub(e.lastSummary) >= cfg.SummaryInterval {
+		attrs := []any{"state", stateName(r.Active), "for", now.Sub(e.since).Truncate(time.Second),
+			"active_polls", e.activePolls, "idle_polls", e.idlePolls, "load", r.Load}
+		if r.Active {
+			attrs = append(attrs, "reason", r.Reason)
+		} else {
+			attrs = append(attrs, "shutdown_in", r.TimeLeft.Round(time.Second))
+		}
+		slog.Info("SUMMARY", attrs...)
+		e.lastSummary = now
+		e.activePolls, e.idlePolls = 0, 0
+	}
+}
+
+// reportChange logs an idle <-> active transition
+func (m *Monitor) reportChange(cfg LoggingConfig, now time.Time, r pollResult) {
+	e := &m.state.events
+	prevFor := now.Sub(e.since).Truncate(time.Second)
+
+	if r.Active {
+		attrs := []any{"reason", r.Reason, "load", r.Load, "ops", r.Ops}
+		if e.started {
+			attrs = append(attrs, "idle_for", prevFor)
+		}
+		slog.Info("ACTIVE", attrs...)
+		e.firstReason = r.Reason
+		e.lastReason = r.Reason
+	} else {
+		attrs := []any{"shutdown_in", r.TimeLeft.Round(time.Second)}
+		if e.started {
+			attrs = append(attrs, "active_for", prevFor, "first_reason", e.firstReason, "last_reason", e.lastReason)
+		}
+		slog.Info("IDLE", attrs...)
+		e.firstReason = ""
+		e.lastReason = ""
+		// Milestones already behind us are not worth reporting
+		e.armMilestones(cfg.Milestones, r.TimeLeft)
+	}
+
+	if !e.started {
+		e.lastSummary = now
+	}
+	e.started = true
+	e.active = r.Active
+	e.since = now
+}
+
+// reportMilestones logs countdown marks crossed since the last poll
+func (m *Monitor) reportMilestones(cfg LoggingConfig, r pollResult) {
+	e := &m.state.events
+	crossed := time.Duration(0)
+	for e.milestone < len(cfg.Milestones) && r.TimeLeft <= cfg.Milestones[e.milestone] {
+		crossed = cfg.Milestones[e.milestone]
+		e.milestone++
+	}
+	if crossed > 0 {
+		slog.Info("COUNTDOWN", "shutdown_in", r.TimeLeft.Round(time.Second), "milestone", crossed, "idle_for", r.IdleFor.Truncate(time.Second))
+	}
+}
+
+// logPoll logs the per-poll details
+func logPoll(level slog.Level, r pollResult) {
+	if r.Active {
+		slog.Log(context.Background(), level, "ACTIVE", "reason", r.Reason, "load", r.Load, "ops", r.Ops)
+		return
+	}
+	// Round timeLeft for nicer display
+	displayTimeLeft := r.TimeLeft.Round(time.Second)
+	if r.TimeLeft < time.Second {
+		displayTimeLeft = r.TimeLeft // Show ms if < 1s
+	}
+	slog.Log(context.Background(), level, "IDLE", "clients", strings.Join(r.Clients, ","), "ops", r.Ops, "load", r.Load,
+		"idle_duration", r.IdleFor.Truncate(time.Second), "shutdown_in", displayTimeLeft)
+}
+
+func stateName(active bool) string {
+	if active {
+		return "active"
+	}
+	return "idle"
+}
@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs redirects the default logger into a buffer (INFO and above)
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// messages extracts the msg= values from captured text logs
+func messages(buf *bytes.Buffer) []string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		for _, f := range strings.Fields(line) {
+			if v, ok := strings.CutPrefix(f, "msg="); ok {
+				msgs = append(msgs, v)
+			}
+		}
+	}
+	return msgs
+}
+
+func TestReport_EventsMode(t *testing.T) {
+	buf := captureLogs(t)
+	m := NewMonitor(&fakeOS{})
+	cfg := LoggingConfig{SummaryInterval: time.Hour, Milestones: []time.Duration{time.Minute, 5 * time.Minute}}.withDefaults()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	active := pollResult{Active: true, Reason: "Client Connected (10.0.0.2)"}
+	idle := func(left time.Duration) pollResult {
+		return pollResult{IdleFor: 10*time.Minute - left, TimeLeft: left}
+	}
+
+	m.report(cfg, start, active)
+	m.report(cfg, start.Add(10*time.Second), active) // No change, no log
+	m.report(cfg, start.Add(20*time.Second), idle(10*time.Minute))
+	m.report(cfg, start.Add(30*time.Second), idle(6*time.Minute)) // No milestone yet
+	m.report(cfg, start.Add(40*time.Second), idle(4*time.Minute)) // 5m crossed
+	m.report(cfg, start.Add(50*time.Second), idle(3*time.Minute))
+	m.report(cfg, start.Add(60*time.Second), idle(30*time.Second)) // 1m crossed
+	m.report(cfg, start.Add(time.Hour), idle(0))                   // Summary
+
+	want := []string{"ACTIVE", "IDLE", "COUNTDOWN", "COUNTDOWN", "SUMMARY"}
+	if got := messages(buf); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Logged %v, want %v\n%s", got, want, buf.String())
+	}
+	if !strings.Contains(buf.String(), `first_reason="Client Connected (10.0.0.2)"`) {
+		t.Errorf("IDLE transition should report the first activity reason:\n%s", buf.String())
+	}
+}
+
+func TestReport_PollMode(t *testing.T) {
+	buf := captureLogs(t)
+	m := NewMonitor(&fakeOS{})
+	cfg := LoggingConfig{Mode: LogModePoll}.withDefaults()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		m.report(cfg, now, pollResult{TimeLeft: time.Minute})
+	}
+	if got := messages(buf); len(got) != 3 {
+		t.Errorf("Expected one line per poll, got %v", got)
+	}
+}
+
+func TestLoggingConfig_Invalid(t *testing.T) {
+	for _, c := range []LoggingConfig{{Mode: "verbose"}, {Format: "xml"}, {Milestones: []time.Duration{0}}} {
+		if err := c.validate(); err == nil {
+			t.Errorf("Expected error for %+v", c)
+		}
+	}
+}
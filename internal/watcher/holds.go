@@ -0,0 +1,48 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHoldDir holds the keep-awake files, each one keeping the server
+// up: written by `autonfs run` over SSH, or by hand (touch) for maintenance
+const DefaultHoldDir = "/run/autonfs/holds"
+
+// FormatHold returns the content of a hold file expiring at expires. A
+// client that dies without removing its hold only keeps the server up until
+// then; an empty file holds until it is removed.
+func FormatHold(expires time.Time, owner string) string {
+	return fmt.Sprintf("%d %s\n", expires.Unix(), owner)
+}
+
+// checkHolds returns the names of the holds in dir that have not expired
+func (m *Monitor) checkHolds(dir string, now time.Time) []string {
+	entries, err := m.OS.ReadDir(dir)
+	if err != nil {
+		// Normal when nothing ever held the server
+		return nil
+	}
+	var holds []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := m.OS.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			if expires, err := strconv.ParseInt(fields[0], 10, 64); err == nil && !now.Before(time.Unix(expires, 0)) {
+				continue
+			}
+		}
+		holds = append(holds, e.Name())
+	}
+	sort.Strings(holds)
+	return holds
+}
@@ -0,0 +1,36 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitor_Poll_Holds(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 2, 0, 0, 0, time.Local)
+	os.WriteFile(filepath.Join(dir, "backup"), []byte(FormatHold(now.Add(time.Minute), "laptop run restic")), 0644)
+	os.WriteFile(filepath.Join(dir, "old"), []byte(FormatHold(now.Add(-time.Minute), "laptop")), 0644)
+	os.WriteFile(filepath.Join(dir, "maintenance"), nil, 0644) // touched by hand
+
+	m := NewMonitor(nil)
+	if holds := m.checkHolds(dir, now); strings.Join(holds, ",") != "backup,maintenance" {
+		t.Errorf("holds = %v", holds)
+	}
+
+	shutdowns := 0
+	m.ShutdownFunc = func() error { shutdowns++; return nil }
+	m.state = watchState{idleStart: now.Add(-time.Hour)}
+	cfg := WatchConfig{IdleTimeout: time.Minute, Sources: []string{SourceHolds}, HoldDir: dir}.withDefaults()
+	if r := m.poll(cfg, now); !r.Active || !strings.Contains(r.Reason, "backup") || shutdowns != 0 {
+		t.Fatalf("poll with holds = %+v, shutdowns %d", r, shutdowns)
+	}
+
+	// Released and expired: the countdown runs again
+	os.Remove(filepath.Join(dir, "maintenance"))
+	if r := m.poll(cfg, now.Add(2*time.Minute)); r.Active || shutdowns != 1 {
+		t.Errorf("poll after holds = %+v, shutdowns %d", r, shutdowns)
+	}
+}
@@ -0,0 +1,44 @@
+package watcher
+
+import (
+	"autonfs/internal/journal"
+	"log/slog"
+	"time"
+)
+
+// journalBoot records the current boot once per watcher run. A restarted
+// watcher finds the boot already on record and skips it.
+func (m *Monitor) journalBoot(path string, now time.Time) {
+	if path == "" || m.bootJournaled {
+		return
+	}
+	m.bootJournaled = true
+	bootAt := m.bootTime(now)
+	entries, err := journal.ReadFile(path)
+	if err != nil {
+		slog.Debug("Read journal failed", "error", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Event != journal.EventBoot {
+			continue
+		}
+		d := entries[i].Time.Sub(bootAt)
+		if d > -time.Minute && d < time.Minute {
+			return
+		}
+		break
+	}
+	if err := journal.Append(path, journal.Entry{Time: bootAt, Event: journal.EventBoot}); err != nil {
+		slog.Warn("Write journal failed", "error", err)
+	}
+}
+
+// journalShutdown records a shutdown about to happen
+func (m *Monitor) journalShutdown(path string, now time.Time, reason string) {
+	if path == "" {
+		return
+	}
+	if err := journal.Append(path, journal.Entry{Time: now, Event: journal.EventShutdown, Reason: reason}); err != nil {
+		slog.Warn("Write journal failed", "error", err)
+	}
+}
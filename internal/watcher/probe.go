@@ -0,0 +1,129 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Probe failure policies accepted in ProbeConfig.OnError
+const (
+	ProbeOnErrorIdle   = "idle"
+	ProbeOnErrorActive = "active"
+)
+
+const defaultProbeTimeout = 10 * time.Second
+
+// ProbeConfig defines an external command used as an activity source.
+// Exit code 0 means active, the first line of stdout is the reason.
+type ProbeConfig struct {
+	Name     string        `yaml:"name"`
+	Command  string        `yaml:"command"`            // Run via sh -c
+	Timeout  time.Duration `yaml:"timeout,omitempty"`  // Default 10s, at most half the poll interval
+	Interval time.Duration `yaml:"interval,omitempty"` // Default every poll
+	OnError  string        `yaml:"on_error,omitempty"` // idle (default) or active, on error/timeout
+}
+
+func (p ProbeConfig) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("probe missing name")
+	}
+	if p.Command == "" {
+		return fmt.Errorf("probe %s missing command", p.Name)
+	}
+	if p.Timeout < 0 || p.Interval < 0 {
+		return fmt.Errorf("probe %s durations must not be negative", p.Name)
+	}
+	switch p.OnError {
+	case "", ProbeOnErrorIdle, ProbeOnErrorActive:
+	default:
+		return fmt.Errorf("probe %s: unknown on_error policy %q", p.Name, p.OnError)
+	}
+	return nil
+}
+
+// probeState caches the last result of a probe between its runs
+type probeState struct {
+	lastRun time.Time
+	active  bool
+	reason  string
+}
+
+// runProbes runs the due probes concurrently and reports the first active one (in config order).
+// Probes run inside the poll, so their timeout is capped to keep a hanging one from stalling it.
+func (m *Monitor) runProbes(probes []ProbeConfig, pollInterval time.Duration, now time.Time) (bool, string) {
+	if len(probes) == 0 {
+		return false, ""
+	}
+	if m.probes == nil {
+		m.probes = make(map[string]*probeState)
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		st, ok := m.probes[p.Name]
+		if !ok {
+			st = &probeState{}
+			m.probes[p.Name] = st
+		}
+		if !st.lastRun.IsZero() && now.Sub(st.lastRun) < p.Interval {
+			continue // Cached result still fresh
+		}
+		st.lastRun = now
+		wg.Add(1)
+		go func(p ProbeConfig, st *probeState) {
+			defer wg.Done()
+			st.active, st.reason = m.runProbe(p, probeTimeout(p, pollInterval))
+		}(p, st)
+	}
+	wg.Wait()
+
+	for _, p := range probes {
+		if st := m.probes[p.Name]; st.active {
+			return true, st.reason
+		}
+	}
+	return false, ""
+}
+
+// probeTimeout returns the configured timeout, capped at half the poll interval
+func probeTimeout(p ProbeConfig, pollInterval time.Duration) time.Duration {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+	if limit := pollInterval / 2; limit > 0 && timeout > limit {
+		timeout = limit
+	}
+	return timeout
+}
+
+// runProbe executes one probe and applies its failure policy
+func (m *Monitor) runProbe(p ProbeConfig, timeout time.Duration) (bool, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out, code, err := m.OS.CommandOutput(ctx, "sh", "-c", p.Command)
+	if err != nil {
+		active := p.OnError == ProbeOnErrorActive
+		slog.Warn("Probe failed", "probe", p.Name, "error", err, "treat_as", stateName(active))
+		return active, fmt.Sprintf("Probe %s (failed: %v)", p.Name, err)
+	}
+	slog.Debug("Probe result", "probe", p.Name, "exit", code)
+	if code != 0 {
+		return false, ""
+	}
+
+	line := ""
+	if sc := bufio.NewScanner(bytes.NewReader(out)); sc.Scan() {
+		line = sc.Text()
+	}
+	if line == "" {
+		return true, fmt.Sprintf("Probe %s", p.Name)
+	}
+	return true, fmt.Sprintf("Probe %s (%s)", p.Name, line)
+}
@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunProbes(t *testing.T) {
+	m, fos := newFakeMonitor()
+	fos.outputs = map[string]fakeOutput{
+		"sh -c scan-running": {stdout: "files:scan for alice\nmore output", exit: 0},
+		"sh -c stream":       {exit: 1},
+		"sh -c broken":       {err: context.DeadlineExceeded},
+	}
+	now := time.Now()
+
+	active, reason := m.runProbes([]ProbeConfig{{Name: "jellyfin", Command: "stream"}, {Name: "nextcloud", Command: "scan-running"}}, DefaultPollInterval, now)
+	if !active || reason != "Probe nextcloud (files:scan for alice)" {
+		t.Errorf("Expected nextcloud probe active, got %v %q", active, reason)
+	}
+
+	// Failure policy
+	if active, _ := m.runProbes([]ProbeConfig{{Name: "b1", Command: "broken"}}, DefaultPollInterval, now); active {
+		t.Error("Failed probe with default policy should count as idle")
+	}
+	if active, _ := m.runProbes([]ProbeConfig{{Name: "b2", Command: "broken", OnError: ProbeOnErrorActive}}, DefaultPollInterval, now); !active {
+		t.Error("Failed probe with on_error=active should count as active")
+	}
+}
+
+func TestRunProbes_Interval(t *testing.T) {
+	m, fos := newFakeMonitor()
+	fos.outputs = map[string]fakeOutput{"sh -c check": {exit: 0}}
+	probes := []ProbeConfig{{Name: "slow", Command: "check", Interval: time.Minute}}
+
+	start := time.Now()
+	m.runProbes(probes, DefaultPollInterval, start)
+	// Cached result is reused inside the interval
+	fos.outputs["sh -c check"] = fakeOutput{exit: 1}
+	if active, _ := m.runProbes(probes, DefaultPollInterval, start.Add(30*time.Second)); !active {
+		t.Error("Expected cached active result within interval")
+	}
+	if active, _ := m.runProbes(probes, DefaultPollInterval, start.Add(61*time.Second)); active {
+		t.Error("Expected probe to re-run after interval")
+	}
+	if len(fos.cmds) != 2 {
+		t.Errorf("Expected 2 probe runs, got %v", fos.cmds)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	tests := []struct {
+		timeout, poll, want time.Duration
+	}{
+		{0, time.Minute, defaultProbeTimeout},
+		{0, 10 * time.Second, 5 * time.Second},
+		{time.Hour, 10 * time.Second, 5 * time.Second},
+		{2 * time.Second, 10 * time.Second, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := probeTimeout(ProbeConfig{Timeout: tt.timeout}, tt.poll); got != tt.want {
+			t.Errorf("probeTimeout(%v, poll %v) = %v, want %v", tt.timeout, tt.poll, got, tt.want)
+		}
+	}
+}
+
+func TestRealOSOperator_CommandOutput(t *testing.T) {
+	o := &RealOSOperator{}
+	out, code, err := o.CommandOutput(context.Background(), "sh", "-c", "echo hello; exit 3")
+	if err != nil || code != 3 || string(out) != "hello\n" {
+		t.Errorf("Got %q code=%d err=%v", out, code, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := o.CommandOutput(ctx, "sleep", "5"); err == nil {
+		t.Error("Expected timeout error")
+	}
+}
+
+func TestProbeConfig_Invalid(t *testing.T) {
+	cfg := WatchConfig{Probes: []ProbeConfig{{Name: "a", Command: "x"}, {Name: "a", Command: "y"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected duplicate probe name error")
+	}
+	if err := (ProbeConfig{Name: "a", Command: "x", OnError: "ignore"}).validate(); err == nil {
+		t.Error("Expected invalid on_error error")
+	}
+}
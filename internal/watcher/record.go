@@ -0,0 +1,304 @@
+package watcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recording file layout inside a record directory
+const (
+	recordMetaFile    = "meta.json"
+	recordSamplesFile = "samples.jsonl"
+)
+
+// Sample operations
+const (
+	opPoll    = "poll"
+	opRead    = "read"
+	opReadDir = "readdir"
+	opExec    = "exec"
+)
+
+// recordMeta describes a recording
+type recordMeta struct {
+	Version  int       `json:"version"`
+	Hostname string    `json:"hostname"`
+	Started  time.Time `json:"started"`
+}
+
+// sample is one line of samples.jsonl
+type sample struct {
+	Time    time.Time     `json:"t"`
+	Op      string        `json:"op"`
+	Path    string        `json:"path,omitempty"`
+	Data    string        `json:"data,omitempty"`
+	Entries []recordedDir `json:"entries,omitempty"`
+	Exit    int           `json:"exit,omitempty"`
+	Err     string        `json:"err,omitempty"`
+}
+
+// recordedDir is a directory entry snapshot
+type recordedDir struct {
+	Name string `json:"name"`
+	Dir  bool   `json:"dir"`
+}
+
+// pollMarker is implemented by operators that need to know when a poll starts
+type pollMarker interface {
+	MarkPoll(t time.Time)
+}
+
+// Recorder is an OSOperator that snapshots everything the watcher reads
+type Recorder struct {
+	OS  OSOperator
+	Now func() time.Time
+
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewRecorder creates dir and starts a recording wrapping osOp
+func NewRecorder(dir string, osOp OSOperator) (*Recorder, error) {
+	if osOp == nil {
+		osOp = &RealOSOperator{}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create record dir: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	meta, _ := json.MarshalIndent(recordMeta{Version: 1, Hostname: hostname, Started: time.Now()}, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, recordMetaFile), meta, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write record meta: %v", err)
+	}
+
+	// Append, so a restarted watcher continues the same recording
+	f, err := os.OpenFile(filepath.Join(dir, recordSamplesFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open samples file: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	return &Recorder{OS: osOp, Now: time.Now, f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// Close flushes and closes the recording
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+func (r *Recorder) write(s sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Recording must never break the watcher, write errors are ignored
+	_ = r.enc.Encode(s)
+}
+
+// MarkPoll starts a new poll in the recording and flushes the previous one
+func (r *Recorder) MarkPoll(t time.Time) {
+	r.mu.Lock()
+	r.w.Flush()
+	r.mu.Unlock()
+	r.write(sample{Time: t, Op: opPoll})
+}
+
+func (r *Recorder) ReadFile(name string) ([]byte, error) {
+	data, err := r.OS.ReadFile(name)
+	s := sample{Time: r.Now(), Op: opRead, Path: name, Data: string(data)}
+	if err != nil {
+		s.Err = err.Error()
+	}
+	r.write(s)
+	return data, err
+}
+
+func (r *Recorder) ReadDir(name string) ([]os.DirEntry, error) {
+	entries, err := r.OS.ReadDir(name)
+	s := sample{Time: r.Now(), Op: opReadDir, Path: name}
+	for _, e := range entries {
+		s.Entries = append(s.Entries, recordedDir{Name: e.Name(), Dir: e.IsDir()})
+	}
+	if err != nil {
+		s.Err = err.Error()
+	}
+	r.write(s)
+	return entries, err
+}
+
+// RunCommand is passed through, actions are not part of the recording
+func (r *Recorder) RunCommand(name string, arg ...string) error {
+	return r.OS.RunCommand(name, arg...)
+}
+
+// CommandOutput records probe results
+func (r *Recorder) CommandOutput(ctx context.Context, name string, arg ...string) ([]byte, int, error) {
+	out, code, err := r.OS.CommandOutput(ctx, name, arg...)
+	s := sample{Time: r.Now(), Op: opExec, Path: commandKey(name, arg), Data: string(out), Exit: code}
+	if err != nil {
+		s.Err = err.Error()
+	}
+	r.write(s)
+	return out, code, err
+}
+
+// commandKey identifies a command line in a recording
+func commandKey(name string, arg []string) string {
+	return strings.Join(append([]string{name}, arg...), " ")
+}
+
+// Recording is a loaded record directory, grouped by poll
+type Recording struct {
+	Hostname string
+	Polls    []RecordedPoll
+}
+
+// RecordedPoll holds everything read during one poll
+type RecordedPoll struct {
+	Time    time.Time
+	samples map[string]sample // key: op + path
+}
+
+// LoadRecording reads a record directory written by Recorder
+func LoadRecording(dir string) (*Recording, error) {
+	rec := &Recording{}
+	if data, err := os.ReadFile(filepath.Join(dir, recordMetaFile)); err == nil {
+		var meta recordMeta
+		if err := json.Unmarshal(data, &meta); err == nil {
+			rec.Hostname = meta.Hostname
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, recordSamplesFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var s sample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			// A torn last line is expected if the watcher was killed
+			continue
+		}
+		if s.Op == opPoll {
+			rec.Polls = append(rec.Polls, RecordedPoll{Time: s.Time, samples: map[string]sample{}})
+			continue
+		}
+		if len(rec.Polls) == 0 {
+			continue
+		}
+		rec.Polls[len(rec.Polls)-1].samples[s.Op+":"+s.Path] = s
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording (line %d): %v", line, err)
+	}
+	if len(rec.Polls) == 0 {
+		return nil, fmt.Errorf("recording %s contains no polls", dir)
+	}
+	sort.SliceStable(rec.Polls, func(i, j int) bool { return rec.Polls[i].Time.Before(rec.Polls[j].Time) })
+	return rec, nil
+}
+
+// ReplayOperator is an OSOperator serving a recording, one poll at a time
+type ReplayOperator struct {
+	rec  *Recording
+	poll int
+}
+
+// NewReplayOperator creates a replay positioned at the first poll
+func NewReplayOperator(rec *Recording) *ReplayOperator {
+	return &ReplayOperator{rec: rec}
+}
+
+// Seek moves to poll i
+func (o *ReplayOperator) Seek(i int) {
+	o.poll = i
+}
+
+// Now is the virtual clock: the time of the current poll
+func (o *ReplayOperator) Now() time.Time {
+	return o.rec.Polls[o.poll].Time
+}
+
+func (o *ReplayOperator) lookup(op, name string) (sample, error) {
+	s, ok := o.rec.Polls[o.poll].samples[op+":"+name]
+	if !ok {
+		return s, fs.ErrNotExist
+	}
+	if s.Err != "" {
+		return s, fmt.Errorf("%s", s.Err)
+	}
+	return s, nil
+}
+
+func (o *ReplayOperator) ReadFile(name string) ([]byte, error) {
+	s, err := o.lookup(opRead, name)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s.Data), nil
+}
+
+func (o *ReplayOperator) ReadDir(name string) ([]os.DirEntry, error) {
+	s, err := o.lookup(opReadDir, name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]os.DirEntry, 0, len(s.Entries))
+	for _, e := range s.Entries {
+		entries = append(entries, replayEntry{d: e})
+	}
+	return entries, nil
+}
+
+// RunCommand succeeds without doing anything: hooks never veto in a replay
+func (o *ReplayOperator) RunCommand(name string, arg ...string) error {
+	return nil
+}
+
+// CommandOutput replays a recorded probe run, unknown commands are reported as idle
+func (o *ReplayOperator) CommandOutput(ctx context.Context, name string, arg ...string) ([]byte, int, error) {
+	s, ok := o.rec.Polls[o.poll].samples[opExec+":"+commandKey(name, arg)]
+	if !ok {
+		return nil, 1, nil
+	}
+	if s.Err != "" {
+		return []byte(s.Data), s.Exit, fmt.Errorf("%s", s.Err)
+	}
+	return []byte(s.Data), s.Exit, nil
+}
+
+// replayEntry implements os.DirEntry for recorded entries
+type replayEntry struct {
+	d recordedDir
+}
+
+func (e replayEntry) Name() string { return e.d.Name }
+func (e replayEntry) IsDir() bool  { return e.d.Dir }
+func (e replayEntry) Type() fs.FileMode {
+	if e.d.Dir {
+		return fs.ModeDir
+	}
+	return 0
+}
+func (e replayEntry) Info() (fs.FileInfo, error) { return nil, fs.ErrNotExist }
@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+)
+
+// recordScenario records polls once a minute: busy for 5 minutes, idle for 30, busy again for 5
+func recordScenario(t *testing.T, dir string) time.Time {
+	fos := &fakeOS{files: map[string]string{"/proc/net/rpc/nfsd": "proc3 2 0 0\n"}}
+	rec, err := NewRecorder(dir, fos)
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	m := NewMonitor(rec)
+	m.ShutdownFunc = func() error { return nil }
+	m.state = watchState{idleStart: start}
+	cfg := WatchConfig{IdleTimeout: 24 * time.Hour, LoadThreshold: 0.5}.withDefaults()
+
+	for i := 0; i < 40; i++ {
+		now := start.Add(time.Duration(i) * time.Minute)
+		load := "0.01 0 0 1/1 1"
+		if i < 5 || i >= 35 {
+			load = "2.00 0 0 1/1 1"
+		}
+		fos.mu.Lock()
+		fos.files["/proc/loadavg"] = load
+		fos.mu.Unlock()
+		rec.Now = func() time.Time { return now }
+		rec.MarkPoll(now)
+		m.poll(cfg, now)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return start
+}
+
+func TestRecordAndSimulate(t *testing.T) {
+	dir := t.TempDir()
+	start := recordScenario(t, dir)
+
+	rec, err := LoadRecording(dir)
+	if err != nil {
+		t.Fatalf("LoadRecording failed: %v", err)
+	}
+	if len(rec.Polls) != 40 {
+		t.Fatalf("Expected 40 polls, got %d", len(rec.Polls))
+	}
+
+	// 10m timeout: idle from minute 4 (last active poll), shutdown once idle > 10m
+	res := Simulate(rec, WatchConfig{IdleTimeout: 10 * time.Minute, LoadThreshold: 0.5})
+	if len(res.Shutdowns) != 1 {
+		t.Fatalf("Expected 1 shutdown, got %+v", res.Shutdowns)
+	}
+	s := res.Shutdowns[0]
+	if want := start.Add(15 * time.Minute); !s.At.Equal(want) {
+		t.Errorf("Shutdown at %v, want %v", s.At, want)
+	}
+	if want := start.Add(35 * time.Minute); !s.WokeAt.Equal(want) {
+		t.Errorf("Woken at %v, want %v", s.WokeAt, want)
+	}
+	if s.Reason == "" {
+		t.Error("Expected a wake reason")
+	}
+	if res.ActivePolls != 10 {
+		t.Errorf("Expected 10 active polls, got %d", res.ActivePolls)
+	}
+
+	// Higher load threshold: never active, shuts down after the first timeout and stays off
+	res = Simulate(rec, WatchConfig{IdleTimeout: 10 * time.Minute, LoadThreshold: 5})
+	if len(res.Shutdowns) != 1 || !res.Shutdowns[0].WokeAt.IsZero() {
+		t.Errorf("Expected a single shutdown without wake, got %+v", res.Shutdowns)
+	}
+
+	// Long timeout: no shutdown at all
+	res = Simulate(rec, WatchConfig{IdleTimeout: time.Hour, LoadThreshold: 0.5})
+	if len(res.Shutdowns) != 0 {
+		t.Errorf("Expected no shutdown, got %+v", res.Shutdowns)
+	}
+}
+
+func TestLoadRecording_Empty(t *testing.T) {
+	if _, err := LoadRecording(t.TempDir()); err == nil {
+		t.Error("Expected error for missing recording")
+	}
+}
@@ -0,0 +1,78 @@
+package watcher
+
+import "time"
+
+// SimShutdown is one shutdown the watcher would have performed during a replay
+type SimShutdown struct {
+	At     time.Time
+	WokeAt time.Time // Next activity after the shutdown, zero if none until the end
+	Reason string    // Activity that would have woken the server
+}
+
+// OffFor is how long the server would have stayed off
+func (s SimShutdown) OffFor(end time.Time) time.Duration {
+	if s.WokeAt.IsZero() {
+		return end.Sub(s.At)
+	}
+	return s.WokeAt.Sub(s.At)
+}
+
+// SimulationResult summarizes a replay
+type SimulationResult struct {
+	Start       time.Time
+	End         time.Time
+	Polls       int
+	ActivePolls int
+	Shutdowns   []SimShutdown
+}
+
+// Simulate runs the decision logic against a recording with a virtual clock.
+// Instead of powering off, shutdowns are recorded; the server is then considered
+// off until the next poll with activity, which counts as a wake.
+func Simulate(rec *Recording, cfg WatchConfig) SimulationResult {
+	cfg = cfg.withDefaults()
+	cfg.DryRun = false
+	cfg.ShutdownCmd = ""
+
+	cfg.StatusFile = ""
+	cfg.JournalFile = ""
+
+	replay := NewReplayOperator(rec)
+	m := NewMonitor(replay)
+	// Adaptive history lives in memory only, starting from a clean slate
+	m.adaptive = loadAdaptive("")
+
+	res := SimulationResult{
+		Start: rec.Polls[0].Time,
+		End:   rec.Polls[len(rec.Polls)-1].Time,
+		Polls: len(rec.Polls),
+	}
+	off := false
+	m.ShutdownFunc = func() error {
+		if !off {
+			res.Shutdowns = append(res.Shutdowns, SimShutdown{At: replay.Now()})
+			off = true
+		}
+		// The real machine would be gone, restart the countdown for the next cycle
+		m.state.idleStart = replay.Now()
+		return nil
+	}
+
+	m.state = watchState{idleStart: res.Start}
+	for i := range rec.Polls {
+		replay.Seek(i)
+		r := m.poll(cfg, replay.Now())
+		if r.Active {
+			res.ActivePolls++
+			if off {
+				last := &res.Shutdowns[len(res.Shutdowns)-1]
+				last.WokeAt = replay.Now()
+				last.Reason = r.Reason
+				off = false
+				m.adaptive.recordBoot(cfg.Adaptive, cfg.IdleTimeout, replay.Now(), replay.Now())
+				m.adaptive.recordWakeReason(r.Reason)
+			}
+		}
+	}
+	return res
+}
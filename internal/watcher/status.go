@@ -0,0 +1,57 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultStatusFile is where the deployed watcher publishes its state
+const DefaultStatusFile = "/run/autonfs/watcher-status.json"
+
+// Status is the watcher state published to WatchConfig.StatusFile after every poll
+type Status struct {
+	UpdatedAt     time.Time     `json:"updated_at"`
+	State         string        `json:"state"` // active or idle
+	Reason        string        `json:"reason,omitempty"`
+	IdleFor       time.Duration `json:"idle_for"`
+	ShutdownIn    time.Duration `json:"shutdown_in"`
+	IdleTimeout   time.Duration `json:"idle_timeout"`      // Effective timeout
+	BaseTimeout   time.Duration `json:"base_idle_timeout"` // Configured timeout
+	TimeoutReason string        `json:"idle_timeout_reason,omitempty"`
+	DryRun        bool          `json:"dry_run,omitempty"`
+}
+
+// writeStatus publishes the poll result, errors are not fatal for the watcher
+func (m *Monitor) writeStatus(path string, st Status) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadStatus reads a status file written by a running watcher
+func ReadStatus(path string) (*Status, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var st Status
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("invalid status file %s: %v", path, err)
+	}
+	return &st, nil
+}
@@ -18,6 +18,9 @@ type OSOperator interface {
 	ReadFile(name string) ([]byte, error)
 	ReadDir(name string) ([]os.DirEntry, error)
 	RunCommand(name string, arg ...string) error
+	// CommandOutput runs a command and returns its stdout and exit code.
+	// err is only set if the command could not run to completion (not found, timeout...).
+	CommandOutput(ctx context.Context, name string, arg ...string) (stdout []byte, exitCode int, err error)
 }
 
 // RealOSOperator implements OSOperator using real OS calls
@@ -35,21 +38,46 @@ func (o *RealOSOperator) RunCommand(name string, arg ...string) error {
 	return exec.Command(name, arg...).Run()
 }
 
+func (o *RealOSOperator) CommandOutput(ctx context.Context, name string, arg ...string) ([]byte, int, error) {
+	cmd := exec.CommandContext(ctx, name, arg...)
+	// Do not wait for grandchildren holding stdout after a timeout
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return out, -1, ctx.Err()
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return out, exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return out, -1, err
+	}
+	return out, 0, nil
+}
+
 // Monitor responsible for system state monitoring
 type Monitor struct {
 	ProcLoadAvg  string
 	ProcRPC      string
 	ProcNFSv4    string // /proc/fs/nfsd/clients/
+	ProcUptime   string
 	ShutdownFunc func() error
 	OS           OSOperator
+
+	reload   chan WatchConfig
+	state    watchState
+	adaptive *adaptiveState // Created on first use when adaptive timeouts are enabled
+	probes   map[string]*probeState
+
+	bootJournaled bool // Current boot is in the journal
 }
 
-// WatchConfig monitor configuration
-type WatchConfig struct {
-	IdleTimeout   time.Duration
-	LoadThreshold float64
-	PollInterval  time.Duration // Check interval, default 10s
-	DryRun        bool
+// watchState is the idle bookkeeping that survives config reloads
+type watchState struct {
+	idleStart time.Time
+	lastOps   uint64
+	active    bool
+	events    eventLog
 }
 
 // NewMonitor creates a new metrics monitor
@@ -61,7 +89,9 @@ func NewMonitor(osOp OSOperator) *Monitor {
 		ProcLoadAvg: "/proc/loadavg",
 		ProcRPC:     "/proc/net/rpc/nfsd",
 		ProcNFSv4:   "/proc/fs/nfsd/clients",
+		ProcUptime:  "/proc/uptime",
 		OS:          osOp,
+		reload:      make(chan WatchConfig, 1),
 	}
 	m.ShutdownFunc = func() error {
 		return m.OS.RunCommand("systemctl", "poweroff")
@@ -69,110 +99,236 @@ func NewMonitor(osOp OSOperator) *Monitor {
 	return m
 }
 
+// Reload hands a new configuration to a running Watch loop.
+// The idle countdown is kept; only a pending, not yet applied config is replaced.
+func (m *Monitor) Reload(cfg WatchConfig) {
+	for {
+		select {
+		case m.reload <- cfg:
+			return
+		default:
+			select {
+			case <-m.reload:
+			default:
+			}
+		}
+	}
+}
+
 // Watch starts the monitoring loop (Blocking)
 func (m *Monitor) Watch(ctx context.Context, cfg WatchConfig) error {
-	interval := cfg.PollInterval
-	if interval == 0 {
-		interval = 10 * time.Second
-	}
+	cfg = cfg.withDefaults()
 
 	slog.Info("=== AutoNFS Watcher Started ===")
-	slog.Info("Config", "idle_timeout", cfg.IdleTimeout, "load_threshold", cfg.LoadThreshold, "interval", interval, "dry_run", cfg.DryRun)
+	logConfig(cfg)
 
-	idleStart := time.Now()
-	ticker := time.NewTicker(interval)
+	m.state = watchState{idleStart: time.Now()}
+	ticker := time.NewTicker(cfg.PollInterval)
 	defer ticker.Stop()
 
-	var lastOps uint64 = 0
-
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case newCfg := <-m.reload:
+			cfg = newCfg.withDefaults()
+			ticker.Reset(cfg.PollInterval)
+			slog.Info("Config reloaded", "idle_for", time.Since(m.state.idleStart).Truncate(time.Second))
+			logConfig(cfg)
 		case <-ticker.C:
-			// --- Data Collection Phase ---
-
-			// 1. Get Load
-			isLowLoad, loadVal, err := m.checkLoad(cfg.LoadThreshold)
-			if err != nil {
-				slog.Error("Read Load failed", "error", err)
+			now := time.Now()
+			if r, ok := m.OS.(pollMarker); ok {
+				r.MarkPoll(now)
 			}
+			m.poll(cfg, now)
+		}
+	}
+}
 
-			// 2. Get NFSv4 Clients
-			clients, err := m.getNFSv4Clients()
-			if err != nil {
-				// Normal behavior if not mounted or NFSv4 not active
-			}
+func logConfig(cfg WatchConfig) {
+	slog.Info("Config", "idle_timeout", cfg.IdleTimeout, "load_threshold", cfg.LoadThreshold, "interval", cfg.PollInterval,
+		"dry_run", cfg.DryRun, "sources", strings.Join(cfg.Sources, ","), "schedules", len(cfg.Schedules), "log_mode", cfg.Logging.Mode)
+}
 
-			// 3. Get NFS Ops Delta
-			currOps, err := m.getNFSProcCount()
-			var opsDelta uint64 = 0
-			if err == nil {
-				if lastOps > 0 {
-					opsDelta = currOps - lastOps
-				}
-				lastOps = currOps
-			} else {
-				// Only log critical RPC read errors
-				slog.Warn("Read RPC failed", "error", err)
-			}
+// poll runs one collect/decide/act cycle at time now
+func (m *Monitor) poll(cfg WatchConfig, now time.Time) pollResult {
+	m.journalBoot(cfg.JournalFile, now)
+
+	// --- Data Collection Phase ---
+
+	// 1. Get Load
+	isLowLoad, loadVal := true, 0.0
+	if cfg.sourceEnabled(SourceLoad) {
+		var err error
+		isLowLoad, loadVal, err = m.checkLoad(cfg.LoadThreshold)
+		if err != nil {
+			slog.Error("Read Load failed", "error", err)
+		}
+	}
+
+	// 2. Get NFSv4 Clients
+	var clients []string
+	if cfg.sourceEnabled(SourceNFSv4Clients) {
+		// Error is normal behavior if not mounted or NFSv4 not active
+		clients, _ = m.getNFSv4Clients()
+	}
 
-			// --- Decision Phase ---
-
-			// Reasons to be Active:
-			// 1. High Load -> Busy
-			// 2. Connected NFSv4 Clients -> Mounted (Strongest Active Signal)
-			// 3. High Ops Delta -> Data Transfer (Fallback)
-
-			isActive := false
-			activeReason := ""
-
-			if !isLowLoad {
-				isActive = true
-				activeReason = fmt.Sprintf("High Load (%.2f)", loadVal)
-			} else if len(clients) > 0 {
-				isActive = true
-				clientList := strings.Join(clients, ", ")
-				activeReason = fmt.Sprintf("Client Connected (%s)", clientList)
-			} else if opsDelta > 0 {
-				isActive = true
-				activeReason = fmt.Sprintf("NFS Activity (Delta %d)", opsDelta)
+	// 3. Get NFS Ops Delta
+	var opsDelta uint64 = 0
+	if cfg.sourceEnabled(SourceNFSOps) {
+		currOps, err := m.getNFSProcCount()
+		if err == nil {
+			if m.state.lastOps > 0 && currOps >= m.state.lastOps {
+				opsDelta = currOps - m.state.lastOps
 			}
+			m.state.lastOps = currOps
+		} else {
+			// Only log critical RPC read errors
+			slog.Warn("Read RPC failed", "error", err)
+		}
+	}
 
-			// --- Logging & Action Phase ---
-
-			if isActive {
-				idleStart = time.Now()
-				slog.Info("ACTIVE", "reason", activeReason, "load", loadVal, "ops", opsDelta)
-			} else {
-				rawIdleDur := time.Since(idleStart)
-				displayIdleDur := rawIdleDur.Truncate(time.Second)
-				timeLeft := cfg.IdleTimeout - rawIdleDur
-				if timeLeft < 0 {
-					timeLeft = 0
-				}
-				// Round timeLeft for nicer display
-				displayTimeLeft := timeLeft.Round(time.Second)
-				if timeLeft < time.Second {
-					displayTimeLeft = timeLeft // Show ms if < 1s
-				}
+	// 4. Get keep-awake holds
+	var holds []string
+	if cfg.sourceEnabled(SourceHolds) {
+		holds = m.checkHolds(cfg.HoldDir, now)
+	}
 
-				slog.Info("IDLE", "clients", 0, "ops", opsDelta, "load", loadVal, "idle_duration", displayIdleDur, "shutdown_in", displayTimeLeft)
+	// 5. Run custom probes (each on its own interval)
+	probeActive, probeReason := m.runProbes(cfg.Probes, cfg.PollInterval, now)
+
+	// --- Decision Phase ---
+
+	// Reasons to be Active:
+	// 1. High Load -> Busy
+	// 2. Connected NFSv4 Clients -> Mounted (Strongest Active Signal)
+	// 3. High Ops Delta -> Data Transfer (Fallback)
+	// 4. Keep-awake hold (e.g. a job run through `autonfs run`)
+	// 5. Custom probe reported activity
+	// 6. Keep-awake schedule window
+
+	isActive := false
+	activeReason := ""
+	idleTimeout := cfg.IdleTimeout
+	timeoutReason := "idle_timeout"
+	sched := cfg.activeSchedule(now)
+	if cfg.Adaptive.Enabled {
+		a := m.adaptiveState(cfg, now)
+		idleTimeout = a.effective(cfg.Adaptive, cfg.IdleTimeout, now)
+		timeoutReason = "adaptive: " + a.reason(idleTimeout, cfg.IdleTimeout)
+		a.logIfChanged(idleTimeout, cfg.IdleTimeout)
+	}
 
-				if rawIdleDur > cfg.IdleTimeout {
-					slog.Info("SHUTDOWN", "reason", "Idle threshold reached")
-					if !cfg.DryRun {
-						if err := m.ShutdownFunc(); err != nil {
-							slog.Error("Shutdown failed", "error", err)
-						}
-					} else {
-						slog.Info("DRY-RUN", "action", "Simulated poweroff command")
-						idleStart = time.Now() // Reset to avoid log flooding
-					}
-				}
+	if !isLowLoad {
+		isActive = true
+		activeReason = fmt.Sprintf("High Load (%.2f)", loadVal)
+	} else if len(clients) > 0 {
+		isActive = true
+		clientList := strings.Join(clients, ", ")
+		activeReason = fmt.Sprintf("Client Connected (%s)", clientList)
+	} else if opsDelta > 0 {
+		isActive = true
+		activeReason = fmt.Sprintf("NFS Activity (Delta %d)", opsDelta)
+	} else if len(holds) > 0 {
+		isActive = true
+		activeReason = fmt.Sprintf("Hold (%s)", strings.Join(holds, ", "))
+	} else if probeActive {
+		isActive = true
+		activeReason = probeReason
+	} else if sched != nil && sched.KeepAwake {
+		isActive = true
+		activeReason = fmt.Sprintf("Schedule (%s)", sched.Name)
+	}
+	if sched != nil && sched.IdleTimeout > 0 {
+		idleTimeout = sched.IdleTimeout
+		timeoutReason = fmt.Sprintf("schedule (%s)", sched.Name)
+	}
+
+	// --- Logging & Action Phase ---
+
+	if isActive != m.state.active {
+		if isActive {
+			m.runHooks("on_active", cfg.Hooks.OnActive)
+		} else {
+			m.runHooks("on_idle", cfg.Hooks.OnIdle)
+		}
+		m.state.active = isActive
+	}
+
+	result := pollResult{Active: isActive, Reason: activeReason, Load: loadVal, Ops: opsDelta, Clients: clients}
+	status := Status{UpdatedAt: now, State: stateName(isActive), Reason: activeReason, IdleTimeout: idleTimeout,
+		BaseTimeout: cfg.IdleTimeout, TimeoutReason: timeoutReason, DryRun: cfg.DryRun}
+	defer func() {
+		if err := m.writeStatus(cfg.StatusFile, status); err != nil {
+			slog.Debug("Write status failed", "error", err)
+		}
+	}()
+
+	if isActive {
+		m.state.idleStart = now
+		if m.adaptive != nil {
+			m.adaptive.recordWakeReason(activeReason)
+		}
+		m.report(cfg.Logging, now, result)
+		return result
+	}
+
+	rawIdleDur := now.Sub(m.state.idleStart)
+	timeLeft := idleTimeout - rawIdleDur
+	if timeLeft < 0 {
+		timeLeft = 0
+	}
+	result.IdleFor = rawIdleDur
+	result.TimeLeft = timeLeft
+	status.IdleFor = rawIdleDur
+	status.ShutdownIn = timeLeft
+	m.report(cfg.Logging, now, result)
+
+	if rawIdleDur > idleTimeout {
+		if err := m.runHooks("pre_shutdown", cfg.Hooks.PreShutdown); err != nil {
+			slog.Info("SHUTDOWN vetoed by hook, restarting countdown", "error", err)
+			m.state.idleStart = now
+			m.state.events.armMilestones(cfg.Logging.Milestones, idleTimeout)
+			return result
+		}
+		slog.Info("SHUTDOWN", "reason", "Idle threshold reached", "idle_timeout", idleTimeout)
+		if !cfg.DryRun {
+			if m.adaptive != nil && cfg.Adaptive.Enabled {
+				m.adaptive.recordShutdown(now)
+			}
+			m.journalShutdown(cfg.JournalFile, now, fmt.Sprintf("idle for %s", idleTimeout))
+			if err := m.shutdown(cfg); err != nil {
+				slog.Error("Shutdown failed", "error", err)
 			}
+		} else {
+			slog.Info("DRY-RUN", "action", "Simulated poweroff command")
+			m.state.idleStart = now // Reset to avoid log flooding
+			m.state.events.armMilestones(cfg.Logging.Milestones, idleTimeout)
 		}
 	}
+	return result
+}
+
+// adaptiveState returns the adaptive history, loading it and registering
+// the current boot on first use
+func (m *Monitor) adaptiveState(cfg WatchConfig, now time.Time) *adaptiveState {
+	if m.adaptive == nil {
+		m.adaptive = loadAdaptive(cfg.Adaptive.StateFile)
+		m.adaptive.recordBoot(cfg.Adaptive, cfg.IdleTimeout, m.bootTime(now), now)
+	}
+	return m.adaptive
+}
+
+// runHooks runs each hook command via sh -c, stopping at the first failure
+func (m *Monitor) runHooks(event string, cmds []string) error {
+	for _, c := range cmds {
+		slog.Debug("Running hook", "event", event, "cmd", c)
+		if err := m.OS.RunCommand("sh", "-c", c); err != nil {
+			slog.Warn("Hook failed", "event", event, "cmd", c, "error", err)
+			return err
+		}
+	}
+	return nil
 }
 
 // checkLoad checks system load
@@ -260,7 +416,10 @@ func (m *Monitor) getNFSProcCount() (uint64, error) {
 	return totalOps, nil
 }
 
-func (m *Monitor) shutdown() error {
-	cmd := exec.Command("systemctl", "poweroff")
-	return cmd.Run()
+// shutdown powers off using the custom command if configured, ShutdownFunc otherwise
+func (m *Monitor) shutdown(cfg WatchConfig) error {
+	if cfg.ShutdownCmd != "" {
+		return m.OS.RunCommand("sh", "-c", cfg.ShutdownCmd)
+	}
+	return m.ShutdownFunc()
 }
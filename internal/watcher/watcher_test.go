@@ -1,9 +1,12 @@
 package watcher
 
 import (
+	"autonfs/internal/journal"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -185,3 +188,186 @@ func TestMonitor_Watch_Integration_V2(t *testing.T) {
 		t.Error("Timed out waiting for shutdown")
 	}
 }
+
+// fakeOS serves files from memory and records commands
+type fakeOS struct {
+	mu      sync.Mutex
+	files   map[string]string
+	cmds    []string
+	fail    map[string]bool // command line -> fail
+	outputs map[string]fakeOutput
+}
+
+func (f *fakeOS) ReadFile(name string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(c), nil
+}
+
+func (f *fakeOS) ReadDir(name string) ([]os.DirEntry, error) {
+	return nil, os.ErrNotExist
+}
+
+func (f *fakeOS) RunCommand(name string, arg ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	line := strings.Join(append([]string{name}, arg...), " ")
+	f.cmds = append(f.cmds, line)
+	if f.fail[line] {
+		return fmt.Errorf("exit status 1")
+	}
+	return nil
+}
+
+func (f *fakeOS) CommandOutput(ctx context.Context, name string, arg ...string) ([]byte, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	line := strings.Join(append([]string{name}, arg...), " ")
+	f.cmds = append(f.cmds, line)
+	if out, ok := f.outputs[line]; ok {
+		return []byte(out.stdout), out.exit, out.err
+	}
+	return nil, 1, nil
+}
+
+// fakeOutput is a canned CommandOutput result
+type fakeOutput struct {
+	stdout string
+	exit   int
+	err    error
+}
+
+func newFakeMonitor() (*Monitor, *fakeOS) {
+	fos := &fakeOS{files: map[string]string{
+		"/proc/loadavg":      "0.00 0.00 0.00 1/100 1",
+		"/proc/net/rpc/nfsd": "proc3 2 0 0\nproc4 2 0 0\n",
+	}, fail: map[string]bool{}}
+	return NewMonitor(fos), fos
+}
+
+func TestMonitor_Poll_ScheduleAndHooks(t *testing.T) {
+	m, fos := newFakeMonitor()
+	shutdowns := 0
+	m.ShutdownFunc = func() error { shutdowns++; return nil }
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	m.state = watchState{idleStart: start, active: true}
+	cfg := WatchConfig{
+		IdleTimeout:   5 * time.Minute,
+		LoadThreshold: 0.5,
+		Schedules:     []Schedule{{Name: "work", Start: "12:00", End: "13:00", KeepAwake: true}},
+		Hooks: HooksConfig{
+			OnIdle:      []string{"echo idle"},
+			PreShutdown: []string{"check"},
+		},
+	}.withDefaults()
+
+	// Inside keep-awake window: no shutdown even after the timeout
+	m.poll(cfg, start.Add(59*time.Minute))
+	if shutdowns != 0 || !m.state.active {
+		t.Fatalf("Expected active during schedule, shutdowns=%d", shutdowns)
+	}
+
+	// Outside window: becomes idle, on_idle runs
+	m.poll(cfg, start.Add(61*time.Minute))
+	if m.state.active {
+		t.Fatal("Expected idle after schedule window")
+	}
+
+	// Pre-shutdown hook vetoes the shutdown
+	fos.fail["sh -c check"] = true
+	m.poll(cfg, start.Add(65*time.Minute))
+	if shutdowns != 0 {
+		t.Fatal("Shutdown should be vetoed by pre_shutdown hook")
+	}
+
+	fos.fail["sh -c check"] = false
+	m.poll(cfg, start.Add(68*time.Minute))
+	if shutdowns != 0 {
+		t.Fatal("Veto should restart the countdown")
+	}
+	m.poll(cfg, start.Add(71*time.Minute))
+	if shutdowns != 1 {
+		t.Fatalf("Expected 1 shutdown, got %d", shutdowns)
+	}
+
+	want := []string{"sh -c echo idle", "sh -c check", "sh -c check"}
+	if strings.Join(fos.cmds, "|") != strings.Join(want, "|") {
+		t.Errorf("Hook commands = %v, want %v", fos.cmds, want)
+	}
+}
+
+func TestMonitor_Poll_ShutdownCmd(t *testing.T) {
+	m, fos := newFakeMonitor()
+	m.ShutdownFunc = func() error { t.Error("ShutdownFunc must not be used with shutdown_cmd"); return nil }
+	start := time.Now()
+	m.state = watchState{idleStart: start}
+
+	m.poll(WatchConfig{IdleTimeout: time.Second, LoadThreshold: 0.5, ShutdownCmd: "halt -p"}.withDefaults(), start.Add(2*time.Second))
+	if len(fos.cmds) != 1 || fos.cmds[0] != "sh -c halt -p" {
+		t.Errorf("Expected custom shutdown command, got %v", fos.cmds)
+	}
+}
+
+func TestMonitor_Poll_Journal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	cfg := WatchConfig{IdleTimeout: time.Minute, LoadThreshold: 0.5, JournalFile: path}.withDefaults()
+
+	run := func(now time.Time) {
+		m, fos := newFakeMonitor()
+		fos.files["/proc/uptime"] = "600.00 1000.00"
+		m.ShutdownFunc = func() error { return nil }
+		m.state = watchState{idleStart: now}
+		m.poll(cfg, now)
+		m.poll(cfg, now.Add(2*time.Minute))
+	}
+	run(start)
+	// Restarted watcher on the same boot: no second boot entry
+	run(start.Add(10 * time.Second))
+
+	entries, err := journal.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, e := range entries {
+		events = append(events, e.Event)
+	}
+	if strings.Join(events, ",") != "boot,shutdown,shutdown" {
+		t.Fatalf("journal events = %v", events)
+	}
+	if !entries[0].Time.Equal(start.Add(-10*time.Minute)) || entries[1].Reason == "" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestMonitor_Reload_KeepsCountdown(t *testing.T) {
+	m, _ := newFakeMonitor()
+	shutdown := make(chan struct{}, 1)
+	m.ShutdownFunc = func() error {
+		select {
+		case shutdown <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Long timeout first, then shorten it: the time already spent idle must count
+	go m.Watch(ctx, WatchConfig{IdleTimeout: time.Hour, LoadThreshold: 0.5, PollInterval: 20 * time.Millisecond})
+	time.Sleep(300 * time.Millisecond)
+	m.Reload(WatchConfig{IdleTimeout: 250 * time.Millisecond, LoadThreshold: 0.5, PollInterval: 20 * time.Millisecond})
+
+	select {
+	case <-shutdown:
+	case <-time.After(150 * time.Millisecond):
+		t.Error("Expected immediate shutdown after reload since idle time already exceeds the new timeout")
+	}
+}
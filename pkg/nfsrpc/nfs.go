@@ -0,0 +1,99 @@
+package nfsrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Program versions and procedures used here
+const (
+	portmapVersion = 2
+	pmapGetPort    = 3
+	ipProtoTCP     = 6
+
+	mountVersion = 3
+	mountExport  = 5
+
+	nfsVersion = 3
+	procNull   = 0
+)
+
+// DefaultPortmapPort is where rpcbind listens
+const DefaultPortmapPort = 111
+
+// Export is one entry of the server's export list
+type Export struct {
+	Dir    string
+	Groups []string // Allowed clients, empty means everyone
+}
+
+// Ping calls the NULL procedure of prog/vers at addr
+func Ping(ctx context.Context, addr string, prog, vers uint32) error {
+	_, err := Call(ctx, addr, prog, vers, procNull, nil)
+	return err
+}
+
+// PingNFS checks that nfsd answers RPCs at addr. A version mismatch still
+// proves that the NFS program is being served (e.g. NFSv4-only servers).
+func PingNFS(ctx context.Context, addr string) error {
+	err := Ping(ctx, addr, ProgNFS, nfsVersion)
+	if ae, ok := err.(*AcceptError); ok && ae.Stat == ProgMismatch {
+		return nil
+	}
+	return err
+}
+
+// GetPort asks the portmapper at pmapAddr for the TCP port of prog/vers.
+// 0 means the program is not registered.
+func GetPort(ctx context.Context, pmapAddr string, prog, vers uint32) (int, error) {
+	var w xdrWriter
+	w.uint32(prog)
+	w.uint32(vers)
+	w.uint32(ipProtoTCP)
+	w.uint32(0)
+	res, err := Call(ctx, pmapAddr, ProgPortmap, portmapVersion, pmapGetPort, w.buf)
+	if err != nil {
+		return 0, err
+	}
+	r := xdrReader{buf: res}
+	port := r.uint32()
+	if r.err != nil {
+		return 0, fmt.Errorf("portmap: bad reply: %v", r.err)
+	}
+	return int(port), nil
+}
+
+// ListExports calls MOUNT EXPORT on the mountd at addr
+func ListExports(ctx context.Context, addr string) ([]Export, error) {
+	res, err := Call(ctx, addr, ProgMount, mountVersion, mountExport, nil)
+	if err != nil {
+		return nil, err
+	}
+	r := xdrReader{buf: res}
+	var exports []Export
+	for r.bool() {
+		e := Export{Dir: r.string()}
+		for r.bool() {
+			e.Groups = append(e.Groups, r.string())
+		}
+		exports = append(exports, e)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("mount: bad export list: %v", r.err)
+	}
+	return exports, nil
+}
+
+// MountdAddr resolves the mountd address of host through its portmapper
+func MountdAddr(ctx context.Context, host string, pmapPort int) (string, error) {
+	port, err := GetPort(ctx, net.JoinHostPort(host, strconv.Itoa(pmapPort)), ProgMount, mountVersion)
+	if err != nil {
+		return "", err
+	}
+	if port == 0 {
+		return "", fmt.Errorf("mountd not registered with portmapper")
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
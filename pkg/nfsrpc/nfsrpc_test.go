@@ -0,0 +1,304 @@
+package nfsrpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// handler answers one call with an accept status and encoded results
+type handler func(prog, vers, proc uint32, args []byte) (uint32, []byte)
+
+// fakeServer is a local ONC RPC server over TCP
+type fakeServer struct {
+	ln     net.Listener
+	mu     sync.Mutex
+	handle handler
+}
+
+func newFakeServer(t *testing.T, h handler) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, handle: h}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) setHandler(h handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handle = h
+}
+
+func (s *fakeServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msg, err := readRecord(conn)
+		if err != nil {
+			return
+		}
+		r := xdrReader{buf: msg}
+		xid := r.uint32()
+		r.uint32() // call
+		r.uint32() // rpc version
+		prog, vers, proc := r.uint32(), r.uint32(), r.uint32()
+		r.uint32() // cred
+		r.opaque()
+		r.uint32() // verf
+		r.opaque()
+
+		s.mu.Lock()
+		h := s.handle
+		s.mu.Unlock()
+		stat, res := h(prog, vers, proc, r.buf)
+
+		var w xdrWriter
+		w.uint32(xid)
+		w.uint32(msgReply)
+		w.uint32(replyAccept)
+		w.uint32(authNone)
+		w.uint32(0)
+		w.uint32(stat)
+		if stat == ProgMismatch {
+			w.uint32(4) // low
+			w.uint32(4) // high
+		}
+		w.buf = append(w.buf, res...)
+		if err := writeRecord(conn, w.buf); err != nil {
+			return
+		}
+	}
+}
+
+// nfsHandler serves NULL for the given NFS version only
+func nfsHandler(version uint32) handler {
+	return func(prog, vers, proc uint32, args []byte) (uint32, []byte) {
+		if prog != ProgNFS {
+			return ProgUnavail, nil
+		}
+		if vers != version {
+			return ProgMismatch, nil
+		}
+		return Success, nil
+	}
+}
+
+// mountdHandler serves EXPORT with the given paths
+func mountdHandler(paths ...string) handler {
+	return func(prog, vers, proc uint32, args []byte) (uint32, []byte) {
+		if prog != ProgMount || proc != mountExport {
+			return ProgUnavail, nil
+		}
+		var w xdrWriter
+		for _, p := range paths {
+			w.bool(true)
+			w.string(p)
+			w.bool(true)
+			w.string("192.168.1.0/24")
+			w.bool(false)
+		}
+		w.bool(false)
+		return Success, w.buf
+	}
+}
+
+// portmapHandler maps MOUNT to port (0 = not registered)
+func portmapHandler(port int) handler {
+	return func(prog, vers, proc uint32, args []byte) (uint32, []byte) {
+		if prog != ProgPortmap || proc != pmapGetPort {
+			return ProgUnavail, nil
+		}
+		r := xdrReader{buf: args}
+		var w xdrWriter
+		if r.uint32() == ProgMount {
+			w.uint32(uint32(port))
+		} else {
+			w.uint32(0)
+		}
+		return Success, w.buf
+	}
+}
+
+func TestPingNFS(t *testing.T) {
+	ctx := context.Background()
+
+	v3 := newFakeServer(t, nfsHandler(3))
+	if err := PingNFS(ctx, v3.addr()); err != nil {
+		t.Errorf("PingNFS v3 failed: %v", err)
+	}
+
+	// NFSv4-only servers answer v3 with a version mismatch
+	v4 := newFakeServer(t, nfsHandler(4))
+	if err := PingNFS(ctx, v4.addr()); err != nil {
+		t.Errorf("PingNFS should accept a version mismatch: %v", err)
+	}
+
+	other := newFakeServer(t, func(prog, vers, proc uint32, args []byte) (uint32, []byte) { return ProgUnavail, nil })
+	err := PingNFS(ctx, other.addr())
+	if ae, ok := err.(*AcceptError); !ok || ae.Stat != ProgUnavail {
+		t.Errorf("Expected ProgUnavail, got %v", err)
+	}
+}
+
+func TestListExports(t *testing.T) {
+	srv := newFakeServer(t, mountdHandler("/data", "/volume1/archive"))
+	exports, err := ListExports(context.Background(), srv.addr())
+	if err != nil {
+		t.Fatalf("ListExports failed: %v", err)
+	}
+	if len(exports) != 2 || exports[0].Dir != "/data" || exports[1].Dir != "/volume1/archive" {
+		t.Fatalf("Unexpected exports: %+v", exports)
+	}
+	if len(exports[0].Groups) != 1 || exports[0].Groups[0] != "192.168.1.0/24" {
+		t.Errorf("Unexpected groups: %v", exports[0].Groups)
+	}
+}
+
+func TestGetPort(t *testing.T) {
+	pmap := newFakeServer(t, portmapHandler(20048))
+	port, err := GetPort(context.Background(), pmap.addr(), ProgMount, 3)
+	if err != nil || port != 20048 {
+		t.Errorf("GetPort = %d, %v; want 20048", port, err)
+	}
+	port, err = GetPort(context.Background(), pmap.addr(), 100099, 1)
+	if err != nil || port != 0 {
+		t.Errorf("GetPort unregistered = %d, %v; want 0", port, err)
+	}
+}
+
+func TestCall_ContextCancel(t *testing.T) {
+	// A server that never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := Ping(ctx, ln.Addr().String(), ProgNFS, 3); err == nil {
+		t.Fatal("Expected error from silent server")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Call did not honor the context deadline")
+	}
+}
+
+func TestReadyCheck(t *testing.T) {
+	nfs := newFakeServer(t, nfsHandler(3))
+	mountd := newFakeServer(t, mountdHandler("/data"))
+	pmap := newFakeServer(t, portmapHandler(mountd.port()))
+	noMountd := newFakeServer(t, portmapHandler(0))
+
+	tests := []struct {
+		name      string
+		check     ReadyCheck
+		wantLevel string
+		wantErr   bool
+	}{
+		{"tcp", ReadyCheck{Strategy: ReadyTCP}, ReadyTCP, false},
+		{"rpc", ReadyCheck{Strategy: ReadyRPC}, ReadyRPC, false},
+		{"exports present", ReadyCheck{Strategy: ReadyExports, PortmapPort: pmap.port(), Exports: []string{"/data"}}, ReadyExports, false},
+		{"exports missing", ReadyCheck{Strategy: ReadyExports, PortmapPort: pmap.port(), Exports: []string{"/other"}}, "", true},
+		{"auto with mountd", ReadyCheck{Strategy: ReadyAuto, PortmapPort: pmap.port(), Exports: []string{"/data"}}, ReadyExports, false},
+		{"auto without exports", ReadyCheck{Strategy: ReadyAuto}, ReadyRPC, false},
+		{"auto falls back after grace", ReadyCheck{Strategy: ReadyAuto, PortmapPort: noMountd.port(), Exports: []string{"/data"}, ExportsGrace: 100 * time.Millisecond}, ReadyRPC, false},
+		{"auto waits for missing export", ReadyCheck{Strategy: ReadyAuto, PortmapPort: pmap.port(), Exports: []string{"/other"}, ExportsGrace: 100 * time.Millisecond}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.check
+			c.Host = "127.0.0.1"
+			c.Port = nfs.port()
+			c.Interval = 50 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+			defer cancel()
+
+			level, err := c.Wait(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Wait() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if level != tt.wantLevel {
+				t.Errorf("Wait() level = %q, want %q", level, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestReadyCheck_WaitsForExports(t *testing.T) {
+	nfs := newFakeServer(t, nfsHandler(3))
+	mountd := newFakeServer(t, mountdHandler())
+	pmap := newFakeServer(t, portmapHandler(mountd.port()))
+
+	// The export shows up once the "RAID" is assembled
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		mountd.setHandler(mountdHandler("/data"))
+	}()
+
+	c := ReadyCheck{
+		Strategy:    ReadyExports,
+		Host:        "127.0.0.1",
+		Port:        nfs.port(),
+		PortmapPort: pmap.port(),
+		Exports:     []string{"/data"},
+		Interval:    50 * time.Millisecond,
+		Settle:      100 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Wait(ctx); err != nil {
+		t.Fatalf("Wait() failed: %v", err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("Wait() returned after %v, before the export appeared and settled", d)
+	}
+}
+
+func TestReadyCheck_NotListening(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	c := ReadyCheck{Strategy: ReadyRPC, Host: "127.0.0.1", Port: port, Interval: 50 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := c.Wait(ctx); err == nil {
+		t.Error("Expected timeout error for closed port " + strconv.Itoa(port))
+	}
+}
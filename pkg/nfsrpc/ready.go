@@ -0,0 +1,162 @@
+package nfsrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Readiness strategies, weakest first
+const (
+	ReadyTCP     = "tcp"     // NFS port accepts connections
+	ReadyRPC     = "rpc"     // nfsd answers a NULL call
+	ReadyExports = "exports" // mountd lists all expected exports
+	ReadyAuto    = "auto"    // exports if mountd is reachable, else rpc
+)
+
+// Readiness defaults
+const (
+	DefaultReadyInterval = time.Second
+	DefaultExportsGrace  = 15 * time.Second
+	attemptTimeout       = 3 * time.Second
+)
+
+// ValidStrategy reports whether s names a readiness strategy
+func ValidStrategy(s string) bool {
+	switch s {
+	case ReadyTCP, ReadyRPC, ReadyExports, ReadyAuto:
+		return true
+	}
+	return false
+}
+
+// ReadyCheck decides when an NFS server can actually serve a mount
+type ReadyCheck struct {
+	Strategy    string
+	Host        string
+	Port        int           // NFS port, default 2049
+	PortmapPort int           // rpcbind port, default 111
+	Exports     []string      // Paths that must be exported (exports/auto)
+	Settle      time.Duration // Extra wait once ready
+	Interval    time.Duration // Between attempts, default 1s
+	// ExportsGrace is how long auto waits for mountd after nfsd answered
+	// before settling for rpc (NFSv4-only servers have no mountd), default 15s
+	ExportsGrace time.Duration
+}
+
+func (c ReadyCheck) withDefaults() ReadyCheck {
+	if c.Strategy == "" {
+		c.Strategy = ReadyAuto
+	}
+	if c.Port == 0 {
+		c.Port = 2049
+	}
+	if c.PortmapPort == 0 {
+		c.PortmapPort = DefaultPortmapPort
+	}
+	if c.Interval == 0 {
+		c.Interval = DefaultReadyInterval
+	}
+	if c.ExportsGrace == 0 {
+		c.ExportsGrace = DefaultExportsGrace
+	}
+	return c
+}
+
+// Wait polls until the server is ready or ctx is done, then waits Settle.
+// It returns the strategy that was satisfied.
+func (c ReadyCheck) Wait(ctx context.Context) (string, error) {
+	c = c.withDefaults()
+	if !ValidStrategy(c.Strategy) {
+		return "", fmt.Errorf("unknown readiness strategy %q", c.Strategy)
+	}
+
+	var nfsUp time.Time // First successful NULL call, for the auto grace period
+	var lastErr error
+	for {
+		level, err := c.attempt(ctx, &nfsUp)
+		if err == nil {
+			if c.Settle > 0 {
+				select {
+				case <-ctx.Done():
+					return "", fmt.Errorf("%s ready but settle interrupted: %v", level, ctx.Err())
+				case <-time.After(c.Settle):
+				}
+			}
+			return level, nil
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("%s not ready: %v", c.Host, lastErr)
+		case <-time.After(c.Interval):
+		}
+	}
+}
+
+// attempt runs one check and returns the satisfied strategy
+func (c ReadyCheck) attempt(ctx context.Context, nfsUp *time.Time) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+	nfsAddr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+
+	if c.Strategy == ReadyTCP {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", nfsAddr)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return ReadyTCP, nil
+	}
+
+	if err := PingNFS(ctx, nfsAddr); err != nil {
+		return "", fmt.Errorf("nfs null call: %v", err)
+	}
+	if nfsUp.IsZero() {
+		*nfsUp = time.Now()
+	}
+	if c.Strategy == ReadyRPC || (c.Strategy == ReadyAuto && len(c.Exports) == 0) {
+		return ReadyRPC, nil
+	}
+
+	addr, err := MountdAddr(ctx, c.Host, c.PortmapPort)
+	if err != nil {
+		if c.Strategy == ReadyAuto && time.Since(*nfsUp) >= c.ExportsGrace {
+			// No mountd (NFSv4-only), nfsd answering is the best we can tell
+			return ReadyRPC, nil
+		}
+		return "", fmt.Errorf("mountd lookup: %v", err)
+	}
+	// A mountd that answers without the export means it is not there yet
+	if err := c.checkExports(ctx, addr); err != nil {
+		return "", err
+	}
+	return ReadyExports, nil
+}
+
+// checkExports verifies that mountd at addr exports every expected path
+func (c ReadyCheck) checkExports(ctx context.Context, addr string) error {
+	exports, err := ListExports(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("export list: %v", err)
+	}
+	have := make(map[string]bool, len(exports))
+	for _, e := range exports {
+		have[e.Dir] = true
+	}
+	var missing []string
+	for _, p := range c.Exports {
+		if !have[p] {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("not exported yet: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
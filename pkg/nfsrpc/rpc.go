@@ -0,0 +1,235 @@
+// Package nfsrpc implements the few ONC RPC (RFC 5531) calls needed to tell
+// whether an NFS server is really ready to serve mounts, in pure Go.
+package nfsrpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+)
+
+// Well-known RPC programs
+const (
+	ProgPortmap = 100000
+	ProgNFS     = 100003
+	ProgMount   = 100005
+)
+
+// RPC message constants
+const (
+	rpcVersion   = 2
+	msgCall      = 0
+	msgReply     = 1
+	replyAccept  = 0
+	authNone     = 0
+	lastFragment = 1 << 31
+	maxReplySize = 1 << 20 // Export lists are small, anything larger is bogus
+)
+
+// Accept status values of an accepted reply
+const (
+	Success      = 0
+	ProgUnavail  = 1
+	ProgMismatch = 2
+	ProcUnavail  = 3
+	GarbageArgs  = 4
+	SystemErr    = 5
+)
+
+// AcceptError is returned when the server accepted the call but did not run it
+type AcceptError struct {
+	Stat uint32
+}
+
+func (e *AcceptError) Error() string {
+	switch e.Stat {
+	case ProgUnavail:
+		return "rpc: program unavailable"
+	case ProgMismatch:
+		return "rpc: program version mismatch"
+	case ProcUnavail:
+		return "rpc: procedure unavailable"
+	case GarbageArgs:
+		return "rpc: garbage arguments"
+	case SystemErr:
+		return "rpc: system error"
+	}
+	return fmt.Sprintf("rpc: accept status %d", e.Stat)
+}
+
+// ErrDenied is returned when the server rejected the call (auth or RPC version)
+var ErrDenied = errors.New("rpc: call denied")
+
+// Call performs one RPC over TCP and returns the encoded results.
+// The deadline of ctx bounds the whole exchange.
+func Call(ctx context.Context, addr string, prog, vers, proc uint32, args []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	// Unblock reads when ctx is cancelled without a deadline
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	xid := rand.Uint32()
+	var w xdrWriter
+	w.uint32(xid)
+	w.uint32(msgCall)
+	w.uint32(rpcVersion)
+	w.uint32(prog)
+	w.uint32(vers)
+	w.uint32(proc)
+	w.uint32(authNone) // cred
+	w.uint32(0)
+	w.uint32(authNone) // verf
+	w.uint32(0)
+	w.buf = append(w.buf, args...)
+
+	if err := writeRecord(conn, w.buf); err != nil {
+		return nil, err
+	}
+	reply, err := readRecord(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return parseReply(reply, xid)
+}
+
+// parseReply checks the reply header and returns the results
+func parseReply(data []byte, xid uint32) ([]byte, error) {
+	r := xdrReader{buf: data}
+	if got := r.uint32(); got != xid {
+		return nil, fmt.Errorf("rpc: xid mismatch (got %d, want %d)", got, xid)
+	}
+	if r.uint32() != msgReply {
+		return nil, fmt.Errorf("rpc: not a reply")
+	}
+	if r.uint32() != replyAccept {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, ErrDenied
+	}
+	r.uint32() // verf flavor
+	r.opaque() // verf body
+	stat := r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if stat != Success {
+		return nil, &AcceptError{Stat: stat}
+	}
+	return r.buf, nil
+}
+
+// writeRecord sends msg as a single record marking fragment
+func writeRecord(w io.Writer, msg []byte) error {
+	out := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(out, lastFragment|uint32(len(msg)))
+	copy(out[4:], msg)
+	_, err := w.Write(out)
+	return err
+}
+
+// readRecord reads fragments until the last one of a record
+func readRecord(r io.Reader) ([]byte, error) {
+	var rec []byte
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, err
+		}
+		h := binary.BigEndian.Uint32(hdr[:])
+		n := int(h &^ lastFragment)
+		if len(rec)+n > maxReplySize {
+			return nil, fmt.Errorf("rpc: record too large")
+		}
+		frag := make([]byte, n)
+		if _, err := io.ReadFull(r, frag); err != nil {
+			return nil, err
+		}
+		rec = append(rec, frag...)
+		if h&lastFragment != 0 {
+			return rec, nil
+		}
+	}
+}
+
+// xdrWriter encodes XDR (RFC 4506) values
+type xdrWriter struct {
+	buf []byte
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+func (w *xdrWriter) bool(v bool) {
+	if v {
+		w.uint32(1)
+	} else {
+		w.uint32(0)
+	}
+}
+
+func (w *xdrWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.buf = append(w.buf, s...)
+	for len(w.buf)%4 != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// xdrReader decodes XDR values, the first error sticks
+type xdrReader struct {
+	buf []byte
+	err error
+}
+
+func (r *xdrReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 4 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *xdrReader) bool() bool {
+	return r.uint32() != 0
+}
+
+func (r *xdrReader) opaque() []byte {
+	n := int(r.uint32())
+	if r.err != nil {
+		return nil
+	}
+	padded := (n + 3) &^ 3
+	if n < 0 || len(r.buf) < padded {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[padded:]
+	return v
+}
+
+func (r *xdrReader) string() string {
+	return string(r.opaque())
+}
@@ -1,6 +1,7 @@
 package sshutil
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"os"
@@ -160,6 +161,30 @@ func (c *Client) RunCommand(cmd string) (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
+// RunCommandInput executes cmd with stdin fed from input, keeping secrets
+// off the remote command line
+func (c *Client) RunCommandInput(cmd string, input []byte) (string, error) {
+	if c.conn == nil {
+		if err := c.Connect(); err != nil {
+			return "", err
+		}
+	}
+
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %v", err)
+	}
+	defer session.Close()
+
+	session.Stdin = bytes.NewReader(input)
+	output, err := session.CombinedOutput(cmd)
+	if err != nil {
+		return string(output), fmt.Errorf("command execution failed: %v\nOutput: %s", err, string(output))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
 // RunTerminal executes command with PTY (interactive, supports sudo password input)
 // Stdin/Stdout/Stderr are piped directly, and local terminal is set to Raw Mode
 func (c *Client) RunTerminal(cmd string) error {
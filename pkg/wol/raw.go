@@ -0,0 +1,90 @@
+package wol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// EtherTypeWoL is the EtherType of raw Wake-on-LAN frames
+const EtherTypeWoL = 0x0842
+
+// Raw sending errors
+var (
+	ErrNeedNetRaw     = errors.New("raw WoL frames need CAP_NET_RAW (run as root or `setcap cap_net_raw+ep` the binary)")
+	ErrRawUnsupported = errors.New("raw WoL frames are only supported on Linux")
+)
+
+// frameSender writes a complete Ethernet frame on an interface
+type frameSender interface {
+	SendFrame(ifi *net.Interface, frame []byte) error
+}
+
+// broadcastMAC is the Ethernet broadcast address
+var broadcastMAC = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// etherFrame builds an Ethernet II frame carrying payload as EtherType 0x0842
+func etherFrame(dst, src net.HardwareAddr, payload []byte) []byte {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, dst...)
+	frame = append(frame, src...)
+	frame = append(frame, EtherTypeWoL>>8, EtherTypeWoL&0xff)
+	return append(frame, payload...)
+}
+
+// rawInterfaces returns the Ethernet interfaces to send raw frames on
+func (w *Waker) rawInterfaces() ([]net.Interface, error) {
+	ifaces, err := w.interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var eth []net.Interface
+	for _, ifi := range ifaces {
+		if len(ifi.HardwareAddr) == 6 {
+			eth = append(eth, ifi)
+		}
+	}
+	if len(eth) == 0 {
+		return nil, fmt.Errorf("no Ethernet interface to send raw WoL frames on")
+	}
+	return eth, nil
+}
+
+// sendRaw sends each packet as a raw frame, both to the target MAC (for
+// switches that learned it) and to the broadcast address. It returns
+// the number of frames sent.
+func (w *Waker) sendRaw(packets []MagicPacket) (int, error) {
+	ifaces, err := w.rawInterfaces()
+	if err != nil {
+		return 0, err
+	}
+	sender := w.raw
+	if sender == nil {
+		sender = rawSender
+	}
+
+	var errs []error
+	sent := 0
+	for i := range ifaces {
+		ifi := &ifaces[i]
+		for _, p := range packets {
+			// The target MAC is repeated right after the 6 byte header
+			target := net.HardwareAddr(p[6:12])
+			for _, dst := range []net.HardwareAddr{target, broadcastMAC} {
+				if err := sender.SendFrame(ifi, etherFrame(dst, ifi.HardwareAddr, p)); err != nil {
+					if errors.Is(err, ErrNeedNetRaw) || errors.Is(err, ErrRawUnsupported) {
+						// Same result on every interface, give up right away
+						return sent, err
+					}
+					errs = append(errs, fmt.Errorf("%s: %v", ifi.Name, err))
+					continue
+				}
+				sent++
+			}
+		}
+	}
+	if sent == 0 {
+		return 0, errors.Join(errs...)
+	}
+	return sent, nil
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package wol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// packetSender sends frames through an AF_PACKET socket
+type packetSender struct{}
+
+var rawSender frameSender = packetSender{}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+func (packetSender) SendFrame(ifi *net.Interface, frame []byte) error {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(EtherTypeWoL)))
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			return ErrNeedNetRaw
+		}
+		return fmt.Errorf("packet socket: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: htons(EtherTypeWoL),
+		Ifindex:  ifi.Index,
+		Halen:    6,
+	}
+	copy(addr.Addr[:], frame[0:6])
+	if err := syscall.Sendto(fd, frame, 0, addr); err != nil {
+		return fmt.Errorf("send frame: %v", err)
+	}
+	return nil
+}
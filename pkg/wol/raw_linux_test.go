@@ -0,0 +1,62 @@
+//go:build linux
+
+package wol
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestPacketSender_Loopback sends a real frame on lo and reads it back
+// through a packet socket. Needs CAP_NET_RAW, skipped otherwise.
+func TestPacketSender_Loopback(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface")
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(EtherTypeWoL)))
+	if err != nil {
+		t.Skipf("packet socket not permitted: %v", err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(EtherTypeWoL), Ifindex: lo.Index}); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	tv := syscall.NsecToTimeval(int64(time.Second))
+	syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+
+	packet, _ := NewMagicPacket("aa:bb:cc:dd:ee:ff")
+	frame := etherFrame(broadcastMAC, net.HardwareAddr{0, 0, 0, 0, 0, 0}, packet)
+	if err := (packetSender{}).SendFrame(lo, frame); err != nil {
+		t.Fatalf("SendFrame failed: %v", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			t.Fatalf("frame not received: %v", err)
+		}
+		if n >= len(frame) && bytes.Equal(buf[14:14+len(packet)], packet) {
+			return
+		}
+	}
+}
+
+func TestPacketSender_NeedsNetRaw(t *testing.T) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(EtherTypeWoL)))
+	if err == nil {
+		syscall.Close(fd)
+		t.Skip("running with CAP_NET_RAW")
+	}
+	lo, _ := net.InterfaceByName("lo")
+	err = (packetSender{}).SendFrame(lo, make([]byte, 116))
+	if !errors.Is(err, ErrNeedNetRaw) {
+		t.Errorf("Expected ErrNeedNetRaw, got %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package wol
+
+import "net"
+
+// unsupportedSender is used where AF_PACKET does not exist
+type unsupportedSender struct{}
+
+var rawSender frameSender = unsupportedSender{}
+
+func (unsupportedSender) SendFrame(ifi *net.Interface, frame []byte) error {
+	return ErrRawUnsupported
+}
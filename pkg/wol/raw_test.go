@@ -0,0 +1,130 @@
+package wol
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFrameSender records frames instead of sending them
+type fakeFrameSender struct {
+	mu     sync.Mutex
+	frames [][]byte
+	ifaces []string
+	err    error
+}
+
+func (f *fakeFrameSender) SendFrame(ifi *net.Interface, frame []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.frames = append(f.frames, append([]byte(nil), frame...))
+	f.ifaces = append(f.ifaces, ifi.Name)
+	return nil
+}
+
+// ethernetInterface returns an interface raw frames could be sent on, or skips
+func ethernetInterface(t *testing.T) net.Interface {
+	t.Helper()
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skip("cannot list interfaces")
+	}
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagLoopback == 0 && len(ifi.HardwareAddr) == 6 {
+			return ifi
+		}
+	}
+	t.Skip("no Ethernet interface available")
+	return net.Interface{}
+}
+
+func TestEtherFrame(t *testing.T) {
+	dst := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	src := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	packet, _ := NewMagicPacket(dst.String())
+
+	frame := etherFrame(dst, src, packet)
+	if len(frame) != 14+102 {
+		t.Fatalf("Frame length = %d, want %d", len(frame), 14+102)
+	}
+	if !bytes.Equal(frame[0:6], dst) || !bytes.Equal(frame[6:12], src) {
+		t.Errorf("Bad addresses: %x", frame[0:12])
+	}
+	if frame[12] != 0x08 || frame[13] != 0x42 {
+		t.Errorf("EtherType = %x, want 0842", frame[12:14])
+	}
+	if !bytes.Equal(frame[14:], packet) {
+		t.Errorf("Payload is not the magic packet")
+	}
+}
+
+func TestWaker_Raw(t *testing.T) {
+	ifi := ethernetInterface(t)
+	fake := &fakeFrameSender{}
+	w := &Waker{MACs: []string{"aa:bb:cc:dd:ee:ff"}, Interface: ifi.Name, Raw: true, raw: fake}
+	if err := w.SendOnce(context.Background()); err != nil {
+		t.Fatalf("SendOnce failed: %v", err)
+	}
+
+	// One frame to the target MAC, one to broadcast
+	if len(fake.frames) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(fake.frames))
+	}
+	if !bytes.Equal(fake.frames[0][0:6], []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}) {
+		t.Errorf("First frame not sent to the target MAC: %x", fake.frames[0][0:6])
+	}
+	if !bytes.Equal(fake.frames[1][0:6], broadcastMAC) {
+		t.Errorf("Second frame not broadcast: %x", fake.frames[1][0:6])
+	}
+	if !bytes.Equal(fake.frames[0][6:12], ifi.HardwareAddr) || fake.ifaces[0] != ifi.Name {
+		t.Errorf("Frame not sent from %s", ifi.Name)
+	}
+}
+
+func TestWaker_RawFallsBackToUDP(t *testing.T) {
+	ethernetInterface(t)
+	port, counts := listenPackets(t)
+	fake := &fakeFrameSender{err: ErrNeedNetRaw}
+	var reported []error
+	w := &Waker{
+		MACs:       []string{"aa:bb:cc:dd:ee:ff"},
+		Targets:    []string{"127.0.0.1"},
+		Ports:      []int{port},
+		Raw:        true,
+		raw:        fake,
+		OnFallback: func(err error) { reported = append(reported, err) },
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.SendOnce(context.Background()); err != nil {
+			t.Fatalf("SendOnce failed: %v", err)
+		}
+	}
+
+	if len(reported) != 1 || reported[0] != ErrNeedNetRaw {
+		t.Errorf("Expected the CAP_NET_RAW error reported once, got %v", reported)
+	}
+	deadline := time.Now().Add(time.Second)
+	for counts()["aa:bb:cc:dd:ee:ff"] < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := counts()["aa:bb:cc:dd:ee:ff"]; n < 2 {
+		t.Errorf("Expected UDP fallback packets, got %d", n)
+	}
+}
+
+func TestWaker_RawRetriesTransientErrors(t *testing.T) {
+	ifi := ethernetInterface(t)
+	fake := &fakeFrameSender{err: fmt.Errorf("network is down")}
+	w := &Waker{MACs: []string{"aa:bb:cc:dd:ee:ff"}, Interface: ifi.Name, Raw: true, raw: fake}
+	w.SendOnce(context.Background())
+	if w.rawOff {
+		t.Error("Transient errors must not disable raw sending")
+	}
+}
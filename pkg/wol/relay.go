@@ -0,0 +1,97 @@
+package wol
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RemoteRunner runs a shell command on another machine, e.g. *sshutil.Client
+type RemoteRunner interface {
+	RunCommandInput(cmd string, input []byte) (string, error)
+}
+
+// relayPython is the fallback sender for relays without autonfs. Packets
+// arrive hex encoded on stdin, so SecureOn passwords never show up in ps.
+const relayPython = `import socket, sys
+s = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+s.setsockopt(socket.SOL_SOCKET, socket.SO_BROADCAST, 1)
+targets = sys.argv[1].split(",")
+ports = [int(p) for p in sys.argv[2].split(",")]
+for line in sys.stdin.read().split():
+    data = bytes.fromhex(line)
+    for t in targets:
+        for p in ports:
+            s.sendto(data, (t, p))
+`
+
+// sendRelay sends one round of packets from the relay host
+func (w *Waker) sendRelay(packets []MagicPacket) error {
+	targets := w.Targets
+	if len(targets) == 0 {
+		targets = []string{LimitedBroadcast}
+	}
+	for _, t := range targets {
+		// Targets end up in a remote shell command
+		if net.ParseIP(t) == nil {
+			return fmt.Errorf("invalid WoL target %q", t)
+		}
+	}
+	ports := w.Ports
+	if len(ports) == 0 {
+		ports = DefaultPorts
+	}
+
+	if w.relayBinary == "" {
+		out, err := w.Relay.RunCommandInput("command -v autonfs || command -v /usr/local/bin/autonfs || true", nil)
+		if err != nil {
+			return fmt.Errorf("relay: %v", err)
+		}
+		w.relayBinary = "-"
+		if path := strings.TrimSpace(out); path != "" {
+			w.relayBinary = path
+		}
+	}
+
+	if w.relayBinary != "-" {
+		// Same sender as here, including raw frames on the relay's interfaces
+		args := []string{w.relayBinary, "wake", "--send-only"}
+		for _, mac := range w.MACs {
+			args = append(args, "--mac", mac)
+		}
+		for _, t := range targets {
+			args = append(args, "--bcast", t)
+		}
+		for _, p := range ports {
+			args = append(args, "--wol-port", strconv.Itoa(p))
+		}
+		if w.Raw {
+			args = append(args, "--raw")
+		}
+		var input []byte
+		if len(w.Password) > 0 {
+			args = append(args, "--secureon-file", "/dev/stdin")
+			input = []byte(hex.EncodeToString(w.Password) + "\n")
+		}
+		if _, err := w.Relay.RunCommandInput(strings.Join(args, " "), input); err != nil {
+			return fmt.Errorf("relay: %v", err)
+		}
+		return nil
+	}
+
+	var input strings.Builder
+	for _, p := range packets {
+		input.WriteString(hex.EncodeToString(p) + "\n")
+	}
+	portList := make([]string, len(ports))
+	for i, p := range ports {
+		portList[i] = strconv.Itoa(p)
+	}
+	cmd := fmt.Sprintf("python3 -c '%s' %s %s", relayPython, strings.Join(targets, ","), strings.Join(portList, ","))
+	if _, err := w.Relay.RunCommandInput(cmd, []byte(input.String())); err != nil {
+		return fmt.Errorf("relay has no autonfs, python3 fallback failed: %v", err)
+	}
+	return nil
+}
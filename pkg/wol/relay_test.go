@@ -0,0 +1,106 @@
+package wol
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRunner records relay commands
+type fakeRunner struct {
+	binary string // Answer to the autonfs lookup
+	cmds   []string
+	inputs [][]byte
+}
+
+func (f *fakeRunner) RunCommandInput(cmd string, input []byte) (string, error) {
+	f.cmds = append(f.cmds, cmd)
+	f.inputs = append(f.inputs, input)
+	if strings.HasPrefix(cmd, "command -v") {
+		return f.binary, nil
+	}
+	return "", nil
+}
+
+// shellRunner runs relay commands locally, standing in for an SSH host
+type shellRunner struct{}
+
+func (shellRunner) RunCommandInput(cmd string, input []byte) (string, error) {
+	c := exec.Command("sh", "-c", cmd)
+	c.Stdin = bytes.NewReader(input)
+	out, err := c.CombinedOutput()
+	return string(out), err
+}
+
+func TestWaker_RelayAutonfs(t *testing.T) {
+	runner := &fakeRunner{binary: "/usr/local/bin/autonfs\n"}
+	w := &Waker{
+		MACs:     []string{"aa:bb:cc:dd:ee:ff"},
+		Password: []byte{1, 2, 3, 4, 5, 6},
+		Targets:  []string{"192.168.1.255"},
+		Ports:    []int{9},
+		Relay:    runner,
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.SendOnce(context.Background()); err != nil {
+			t.Fatalf("SendOnce failed: %v", err)
+		}
+	}
+
+	// The lookup runs once, then one send per round
+	if len(runner.cmds) != 3 {
+		t.Fatalf("Expected 3 relay commands, got %v", runner.cmds)
+	}
+	want := "/usr/local/bin/autonfs wake --send-only --mac aa:bb:cc:dd:ee:ff --bcast 192.168.1.255 --wol-port 9 --secureon-file /dev/stdin"
+	if runner.cmds[1] != want {
+		t.Errorf("Relay command = %q, want %q", runner.cmds[1], want)
+	}
+	if string(runner.inputs[1]) != "010203040506\n" {
+		t.Errorf("Password not passed on stdin: %q", runner.inputs[1])
+	}
+}
+
+func TestWaker_RelayRejectsBadTarget(t *testing.T) {
+	w := &Waker{MACs: []string{"aa:bb:cc:dd:ee:ff"}, Targets: []string{"1.2.3.4; reboot"}, Relay: &fakeRunner{}}
+	if err := w.SendOnce(context.Background()); err == nil {
+		t.Error("Expected error for a target that is not an IP")
+	}
+}
+
+func TestWaker_RelayPythonFallback(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not available")
+	}
+	port, counts := listenPackets(t)
+
+	runner := &fakeRunner{}
+	w := &Waker{MACs: []string{"aa:bb:cc:dd:ee:ff"}, Targets: []string{"127.0.0.1"}, Ports: []int{port}, Relay: runner}
+	if err := w.SendOnce(context.Background()); err != nil {
+		t.Fatalf("SendOnce failed: %v", err)
+	}
+	cmd, input := runner.cmds[1], runner.inputs[1]
+	if !strings.HasPrefix(cmd, "python3 -c") || strings.Contains(cmd, "aabbccddeeff") {
+		t.Errorf("Unexpected fallback command: %q", cmd)
+	}
+	packet, _ := NewMagicPacket("aa:bb:cc:dd:ee:ff")
+	if string(input) != hex.EncodeToString(packet)+"\n" {
+		t.Errorf("Packet not passed on stdin: %q", input)
+	}
+
+	// Run the generated command for real, as the relay would
+	if out, err := (shellRunner{}).RunCommandInput(cmd, input); err != nil {
+		t.Fatalf("Fallback sender failed: %v\n%s", err, out)
+	}
+	deadline := time.Now().Add(time.Second)
+	for counts()["aa:bb:cc:dd:ee:ff"] == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if counts()["aa:bb:cc:dd:ee:ff"] == 0 {
+		t.Error("Fallback sender did not deliver the packet to port " + strconv.Itoa(port))
+	}
+}
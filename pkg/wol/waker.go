@@ -0,0 +1,279 @@
+package wol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Waker defaults
+const (
+	DefaultResendInterval = 2 * time.Second
+	LimitedBroadcast      = "255.255.255.255"
+)
+
+// DefaultPorts are the usual WoL ports: discard (9) and echo (7)
+var DefaultPorts = []int{9, 7}
+
+// Waker sends magic packets for one host over every useful path:
+// each MAC, each target address, each port, on every interface (or a
+// chosen one), repeated until the host is ready.
+type Waker struct {
+	MACs      []string      // Several MACs for bonded NICs
+	Password  []byte        // Optional SecureOn password (4 or 6 bytes)
+	Targets   []string      // Broadcast/unicast IPs, default 255.255.255.255
+	Ports     []int         // Default 9 and 7
+	Interface string        // Only send on this interface, empty for all
+	Interval  time.Duration // Resend interval, default 2s
+
+	// Raw sends EtherType 0x0842 frames instead of UDP datagrams. Without
+	// CAP_NET_RAW (or off Linux) it falls back to UDP and reports why
+	// through OnFallback, once.
+	Raw        bool
+	OnFallback func(err error)
+
+	// Relay sends the packets from another machine on the server's LAN
+	// instead of from here, e.g. an always-on host reached over SSH
+	Relay RemoteRunner
+
+	raw         frameSender // Test seam, default AF_PACKET
+	relayBinary string      // autonfs on the relay, "-" if missing, "" until probed
+	rawOff      bool        // Raw sending can never work here
+	reported    bool
+}
+
+// endpoint is one local/remote address pair to send to
+type endpoint struct {
+	laddr *net.UDPAddr // nil lets the kernel pick the route
+	raddr *net.UDPAddr
+}
+
+func (w *Waker) packets() ([]MagicPacket, error) {
+	if len(w.MACs) == 0 {
+		return nil, fmt.Errorf("no MAC address given")
+	}
+	packets := make([]MagicPacket, 0, len(w.MACs))
+	for _, mac := range w.MACs {
+		p, err := NewMagicPacket(mac, w.Password...)
+		if err != nil {
+			return nil, fmt.Errorf("magic packet for %s: %v", mac, err)
+		}
+		packets = append(packets, p)
+	}
+	return packets, nil
+}
+
+// endpoints lists where to send, deduplicated
+func (w *Waker) endpoints() ([]endpoint, error) {
+	targets := w.Targets
+	if len(targets) == 0 {
+		targets = []string{LimitedBroadcast}
+	}
+	ports := w.Ports
+	if len(ports) == 0 {
+		ports = DefaultPorts
+	}
+
+	type pair struct{ local, remote string }
+	var eps []endpoint
+	seen := map[pair]bool{}
+	add := func(local net.IP, remote string) {
+		for _, port := range ports {
+			p := pair{remote: net.JoinHostPort(remote, strconv.Itoa(port))}
+			if local != nil {
+				p.local = local.String()
+			}
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			ep := endpoint{raddr: &net.UDPAddr{IP: net.ParseIP(remote), Port: port}}
+			if local != nil {
+				ep.laddr = &net.UDPAddr{IP: local}
+			}
+			eps = append(eps, ep)
+		}
+	}
+
+	ifaces, err := w.interfaces()
+	if err != nil {
+		return nil, err
+	}
+	if w.Interface == "" {
+		// Plain routing first, it is what works on single-homed clients
+		for _, t := range targets {
+			add(nil, t)
+		}
+	}
+	for _, ifi := range ifaces {
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			// Binding the source address makes the packet leave this interface
+			for _, t := range targets {
+				add(ipnet.IP, t)
+			}
+			if ifi.Flags&net.FlagBroadcast != 0 {
+				add(ipnet.IP, directedBroadcast(ipnet).String())
+				add(ipnet.IP, LimitedBroadcast)
+			}
+		}
+	}
+	if len(eps) == 0 {
+		return nil, fmt.Errorf("no usable IPv4 address on interface %q", w.Interface)
+	}
+	return eps, nil
+}
+
+// interfaces returns the chosen interface, or all that are up
+func (w *Waker) interfaces() ([]net.Interface, error) {
+	if w.Interface != "" {
+		ifi, err := net.InterfaceByName(w.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("interface %q: %v", w.Interface, err)
+		}
+		return []net.Interface{*ifi}, nil
+	}
+	all, err := net.Interfaces()
+	if err != nil {
+		// Routing alone still works
+		return nil, nil
+	}
+	var up []net.Interface
+	for _, ifi := range all {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagLoopback == 0 {
+			up = append(up, ifi)
+		}
+	}
+	return up, nil
+}
+
+// SendOnce sends every packet to every endpoint once. It fails only if no
+// packet could be sent at all.
+func (w *Waker) SendOnce(ctx context.Context) error {
+	packets, err := w.packets()
+	if err != nil {
+		return err
+	}
+	if w.Relay != nil {
+		return w.sendRelay(packets)
+	}
+	if w.Raw && !w.rawOff {
+		_, err := w.sendRaw(packets)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, ErrNeedNetRaw) || errors.Is(err, ErrRawUnsupported) {
+			w.rawOff = true
+		}
+		if !w.reported && w.OnFallback != nil {
+			w.OnFallback(err)
+		}
+		w.reported = true
+	}
+
+	eps, err := w.endpoints()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	sent := 0
+	for _, ep := range eps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		conn, err := net.DialUDP("udp4", ep.laddr, ep.raddr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, p := range packets {
+			if _, err := conn.Write(p); err != nil {
+				errs = append(errs, err)
+			} else {
+				sent++
+			}
+		}
+		conn.Close()
+	}
+	if sent == 0 {
+		return fmt.Errorf("no magic packet sent: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Wake sends magic packets every Interval until ready returns nil or ctx is
+// done. Send failures are not fatal, the host may still wake from a later round.
+func (w *Waker) Wake(ctx context.Context, ready func(context.Context) error) error {
+	if _, err := w.packets(); err != nil {
+		return err
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultResendInterval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sendErr := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last error
+		for {
+			if err := w.SendOnce(ctx); err != nil && ctx.Err() == nil {
+				last = err
+			}
+			select {
+			case <-ctx.Done():
+				sendErr <- last
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	err := ready(ctx)
+	cancel()
+	if last := <-sendErr; err != nil && last != nil {
+		return fmt.Errorf("%v (last send error: %v)", err, last)
+	}
+	return err
+}
+
+// directedBroadcast is the subnet-directed broadcast address of n
+func directedBroadcast(n *net.IPNet) net.IP {
+	ip := n.IP.To4()
+	mask := n.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	out := make(net.IP, net.IPv4len)
+	for i := range out {
+		out[i] = ip[i] | ^mask[i]
+	}
+	return out
+}
+
+// DirectedBroadcast returns the subnet-directed broadcast address for an
+// IPv4 address and prefix length, e.g. 192.168.1.50/24 -> 192.168.1.255
+func DirectedBroadcast(ip string, prefix int) (string, error) {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return "", fmt.Errorf("not an IPv4 address: %q", ip)
+	}
+	if prefix < 0 || prefix > 32 {
+		return "", fmt.Errorf("invalid prefix length %d", prefix)
+	}
+	return directedBroadcast(&net.IPNet{IP: parsed, Mask: net.CIDRMask(prefix, 32)}).String(), nil
+}
@@ -1,22 +1,29 @@
 package wol
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net"
+	"os"
+	"strings"
 	"time"
 )
 
-// MagicPacket is 102 Bytes long (6 bytes header + 16 * 6 bytes MAC)
-type MagicPacket [102]byte
+// MagicPacket is 102 Bytes long (6 bytes header + 16 * 6 bytes MAC),
+// followed by an optional 4 or 6 byte SecureOn password
+type MagicPacket []byte
 
-// NewMagicPacket creates a WoL packet
-func NewMagicPacket(macAddr string) (*MagicPacket, error) {
+// NewMagicPacket creates a WoL packet, with an optional SecureOn password
+func NewMagicPacket(macAddr string, password ...byte) (MagicPacket, error) {
 	mac, err := net.ParseMAC(macAddr)
 	if err != nil {
 		return nil, err
 	}
+	if len(password) != 0 && len(password) != 4 && len(password) != 6 {
+		return nil, fmt.Errorf("SecureOn password must be 4 or 6 bytes, got %d", len(password))
+	}
 
-	var packet MagicPacket
+	packet := make(MagicPacket, 102, 102+len(password))
 	// Header: 6 bytes of 0xFF
 	copy(packet[0:], []byte{255, 255, 255, 255, 255, 255})
 	// Body: MAC repeated 16 times
@@ -25,22 +32,59 @@ func NewMagicPacket(macAddr string) (*MagicPacket, error) {
 		copy(packet[offset:], mac)
 		offset += 6
 	}
-	return &packet, nil
+	return append(packet, password...), nil
 }
 
 // Send broadcasts the WoL packet
-func (mp *MagicPacket) Send(broadcastIP string) error {
-	addr := fmt.Sprintf("%s:9", broadcastIP) // Port 9 is standard for WoL
+func (mp MagicPacket) Send(broadcastIP string) error {
+	addr := net.JoinHostPort(broadcastIP, "9") // Port 9 is standard for WoL
 	conn, err := net.Dial("udp", addr)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	_, err = conn.Write(mp[:])
+	_, err = conn.Write(mp)
 	return err
 }
 
+// ParsePassword parses a SecureOn password written as a MAC (6 bytes,
+// aa:bb:cc:dd:ee:ff), an IPv4 address (4 bytes, 1.2.3.4) or plain hex
+func ParsePassword(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(s); ip != nil && ip.To4() != nil && strings.Count(s, ".") == 3 {
+		return []byte(ip.To4()), nil
+	}
+	if mac, err := net.ParseMAC(s); err == nil && len(mac) == 6 {
+		return []byte(mac), nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || (len(b) != 4 && len(b) != 6) {
+		return nil, fmt.Errorf("SecureOn password must be 4 or 6 bytes (aa:bb:cc:dd:ee:ff, 1.2.3.4 or hex)")
+	}
+	return b, nil
+}
+
+// LoadPassword reads a SecureOn password from a file or, if file is empty,
+// from the environment variable env. Both empty means no password.
+func LoadPassword(file, env string) ([]byte, error) {
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SecureOn password: %v", err)
+		}
+		return ParsePassword(string(data))
+	case env != "":
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return nil, fmt.Errorf("SecureOn password variable %s is not set", env)
+		}
+		return ParsePassword(v)
+	}
+	return nil, nil
+}
+
 // WaitForPort waits for the target TCP port to open
 func WaitForPort(ip string, port int, timeout time.Duration) error {
 	target := fmt.Sprintf("%s:%d", ip, port)
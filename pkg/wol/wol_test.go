@@ -2,7 +2,11 @@ package wol
 
 import (
 	"bytes"
+	"context"
 	"net"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -99,3 +103,205 @@ func TestSend_Integration(t *testing.T) {
 	// Let's modify `Send` to support custom address for testing? Or just skip low-port test.
 	t.Log("Skipping Send integration test due to privileged port 9 requirement")
 }
+
+func TestDirectedBroadcast(t *testing.T) {
+	tests := []struct {
+		ip      string
+		prefix  int
+		want    string
+		wantErr bool
+	}{
+		{"192.168.1.50", 24, "192.168.1.255", false},
+		{"10.1.2.3", 16, "10.1.255.255", false},
+		{"172.16.5.4", 22, "172.16.7.255", false},
+		{"192.168.1.50", 33, "", true},
+		{"fe80::1", 64, "", true},
+	}
+	for _, tt := range tests {
+		got, err := DirectedBroadcast(tt.ip, tt.prefix)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DirectedBroadcast(%s/%d) error = %v, wantErr %v", tt.ip, tt.prefix, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DirectedBroadcast(%s/%d) = %s, want %s", tt.ip, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+// listenPackets counts magic packets per MAC received on a local UDP port
+func listenPackets(t *testing.T) (int, func() map[string]int) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n >= 102 {
+				mu.Lock()
+				counts[net.HardwareAddr(buf[6:12]).String()]++
+				mu.Unlock()
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port, func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		out := map[string]int{}
+		for k, v := range counts {
+			out[k] = v
+		}
+		return out
+	}
+}
+
+func TestWaker_SendOnce(t *testing.T) {
+	port, counts := listenPackets(t)
+	w := &Waker{
+		MACs:      []string{"aa:bb:cc:dd:ee:01", "aa:bb:cc:dd:ee:02"},
+		Targets:   []string{"127.0.0.1"},
+		Ports:     []int{port},
+		Interface: "lo",
+	}
+	if err := w.SendOnce(context.Background()); err != nil {
+		t.Fatalf("SendOnce failed: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c := counts()
+		if c["aa:bb:cc:dd:ee:01"] > 0 && c["aa:bb:cc:dd:ee:02"] > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected packets for both MACs, got %v", counts())
+}
+
+func TestWaker_WakeResendsUntilReady(t *testing.T) {
+	port, counts := listenPackets(t)
+	w := &Waker{
+		MACs:      []string{"aa:bb:cc:dd:ee:ff"},
+		Targets:   []string{"127.0.0.1"},
+		Ports:     []int{port},
+		Interface: "lo",
+		Interval:  50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	err := w.Wake(context.Background(), func(ctx context.Context) error {
+		time.Sleep(300 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Wake failed: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Wake did not return once ready")
+	}
+	// Give the last packets time to arrive
+	time.Sleep(50 * time.Millisecond)
+	if n := counts()["aa:bb:cc:dd:ee:ff"]; n < 3 {
+		t.Errorf("Expected packets to be resent, got %d", n)
+	}
+
+	// Sending stops once ready
+	after := counts()["aa:bb:cc:dd:ee:ff"]
+	time.Sleep(150 * time.Millisecond)
+	if n := counts()["aa:bb:cc:dd:ee:ff"]; n != after {
+		t.Errorf("Packets still sent after ready: %d -> %d", after, n)
+	}
+}
+
+func TestWaker_Errors(t *testing.T) {
+	ready := func(context.Context) error { return nil }
+	if err := (&Waker{}).Wake(context.Background(), ready); err == nil {
+		t.Error("Expected error without MACs")
+	}
+	if err := (&Waker{MACs: []string{"nope"}}).Wake(context.Background(), ready); err == nil {
+		t.Error("Expected error for invalid MAC")
+	}
+	if err := (&Waker{MACs: []string{"aa:bb:cc:dd:ee:ff"}, Interface: "does-not-exist0"}).SendOnce(context.Background()); err == nil {
+		t.Error("Expected error for unknown interface")
+	}
+}
+
+func TestNewMagicPacket_SecureOn(t *testing.T) {
+	pw := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	packet, err := NewMagicPacket("AA:BB:CC:DD:EE:FF", pw...)
+	if err != nil {
+		t.Fatalf("NewMagicPacket failed: %v", err)
+	}
+	if len(packet) != 108 || !bytes.Equal(packet[102:], pw) {
+		t.Errorf("Password not appended: len=%d tail=%x", len(packet), packet[102:])
+	}
+
+	packet, err = NewMagicPacket("AA:BB:CC:DD:EE:FF", 192, 168, 1, 1)
+	if err != nil || len(packet) != 106 {
+		t.Errorf("4-byte password: len=%d err=%v", len(packet), err)
+	}
+
+	if _, err := NewMagicPacket("AA:BB:CC:DD:EE:FF", 1, 2, 3, 4, 5); err == nil {
+		t.Error("Expected error for 5-byte password")
+	}
+}
+
+func TestParsePassword(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []byte
+		wantErr bool
+	}{
+		{"01:02:03:04:05:06\n", []byte{1, 2, 3, 4, 5, 6}, false},
+		{"01-02-03-04-05-06", []byte{1, 2, 3, 4, 5, 6}, false},
+		{"192.168.1.1", []byte{192, 168, 1, 1}, false},
+		{"0a0b0c0d", []byte{10, 11, 12, 13}, false},
+		{"0a0b0c", nil, true},
+		{"secret", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePassword(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePassword(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("ParsePassword(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPassword(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secureon")
+	if err := os.WriteFile(file, []byte("aa:bb:cc:dd:ee:ff\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pw, err := LoadPassword(file, "")
+	if err != nil || len(pw) != 6 {
+		t.Errorf("LoadPassword(file) = %v, %v", pw, err)
+	}
+
+	t.Setenv("AUTONFS_TEST_SECUREON", "10.0.0.1")
+	pw, err = LoadPassword("", "AUTONFS_TEST_SECUREON")
+	if err != nil || !bytes.Equal(pw, []byte{10, 0, 0, 1}) {
+		t.Errorf("LoadPassword(env) = %v, %v", pw, err)
+	}
+
+	if _, err := LoadPassword("", "AUTONFS_TEST_UNSET_VAR"); err == nil {
+		t.Error("Expected error for unset variable")
+	}
+	if pw, err := LoadPassword("", ""); pw != nil || err != nil {
+		t.Errorf("Expected no password, got %v, %v", pw, err)
+	}
+}